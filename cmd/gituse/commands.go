@@ -0,0 +1,515 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// コミット作成結果の出力
+type commitOutput struct {
+	Sha     string   `json:"sha"`
+	Tree    string   `json:"tree"`
+	Parents []string `json:"parents"`
+	Message string   `json:"message"`
+	Url     string   `json:"html_url,omitempty"`
+}
+
+// dry-run時の出力
+type planOutput struct {
+	Branch        string            `json:"branch"`
+	BaseCommitSha string            `json:"base_commit"`
+	Entries       []planEntryOutput `json:"entries"`
+	Summary       string            `json:"summary"`
+}
+
+type planEntryOutput struct {
+	Path    string `json:"path"`
+	Action  string `json:"action"`
+	OldMode string `json:"old_mode,omitempty"`
+	NewMode string `json:"new_mode,omitempty"`
+	OldSha  string `json:"old_sha,omitempty"`
+	NewSha  string `json:"new_sha,omitempty"`
+	OldSize int    `json:"old_size"`
+	NewSize int    `json:"new_size"`
+}
+
+func newCommitOutput(resp *githubapi.CreateCommitResponse) *commitOutput {
+	output := &commitOutput{
+		Sha:     resp.Sha,
+		Tree:    resp.Tree.Sha,
+		Parents: []string{},
+		Message: resp.Message,
+		Url:     resp.Html_url,
+	}
+	for _, parent := range resp.Parents {
+		output.Parents = append(output.Parents, parent.Sha)
+	}
+	return output
+}
+
+func newPlanOutput(plan *service.CommitPlan) *planOutput {
+	output := &planOutput{
+		Branch:        plan.Branch,
+		BaseCommitSha: plan.BaseCommitSha,
+		Entries:       []planEntryOutput{},
+		Summary:       plan.String(),
+	}
+	for _, entry := range plan.Entries {
+		output.Entries = append(output.Entries, planEntryOutput{
+			Path:    entry.Path,
+			Action:  string(entry.Action),
+			OldMode: entry.OldMode,
+			NewMode: entry.NewMode,
+			OldSha:  entry.OldSha,
+			NewSha:  entry.NewSha,
+			OldSize: entry.OldSize,
+			NewSize: entry.NewSize,
+		})
+	}
+	return output
+}
+
+// CommitElementでコミットを作成する。dryRunの場合は変更内容のみ返す
+func commitElements(gitInfo *service.GitInfo, message string, elementList []*service.CommitElement, dryRun bool) (any, error) {
+	if dryRun {
+		plan, err := gitInfo.PlanCommitByElement(message, elementList)
+		if err != nil {
+			return nil, err
+		}
+		return newPlanOutput(plan), nil
+	}
+	resp, err := gitInfo.CreateCommitByElement(message, elementList)
+	if err != nil {
+		return nil, err
+	}
+	return newCommitOutput(resp), nil
+}
+
+// gituse commit-dir [flags] <dir>
+func runCommitDir(args []string) (any, error) {
+	fs := flag.NewFlagSet("commit-dir", flag.ContinueOnError)
+	common := addCommonFlags(fs)
+	message := fs.String("m", "", "commit message (required)")
+	prefix := fs.String("prefix", "", "directory in the repository to place the files in")
+	mirror := fs.Bool("mirror", false, "delete files under -prefix that do not exist in the local directory")
+	dryRun := fs.Bool("dry-run", false, "print the changes without creating the commit")
+	showProgress := fs.Bool("progress", false, "print progress to stderr")
+	cachePath := fs.String("cache", "", "file to cache blob shas of local files in, to skip reading unchanged files")
+	normalizeEol := fs.Bool("normalize-eol", false, "convert CRLF to LF in text files, following .gitattributes")
+	var deleteList stringList
+	fs.Var(&deleteList, "delete", "repository path to delete (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gituse commit-dir -m <message> [flags] <dir>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if *message == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return nil, errUsage
+	}
+	conf, err := common.load()
+	if err != nil {
+		return nil, err
+	}
+	if err := conf.requireAuthor(); err != nil {
+		return nil, err
+	}
+	gitInfo, err := conf.gitInfo()
+	if err != nil {
+		return nil, err
+	}
+	gitInfo.SetLineEndingNormalization(*normalizeEol)
+
+	option := &service.LocalDirOption{Prefix: *prefix, Mirror: *mirror}
+	if *showProgress {
+		printer := newProgressPrinter(os.Stderr)
+		defer printer.finish()
+		option.Progress = printer.print
+		gitInfo.SetProgressFunc(printer.print)
+	}
+	elementList, err := service.MakeCommitElementListByLocalPathWithOption(fs.Arg(0), option)
+	if err != nil {
+		return nil, err
+	}
+	for _, repoPath := range deleteList {
+		element, err := service.MakeCommitElementForDelete(repoPath)
+		if err != nil {
+			return nil, err
+		}
+		elementList = append(elementList, element)
+	}
+	if *cachePath == "" {
+		return commitElements(gitInfo, *message, elementList, *dryRun)
+	}
+	cache, err := service.OpenBlobCache(*cachePath, 0)
+	if err != nil {
+		return nil, err
+	}
+	gitInfo.SetBlobCache(cache)
+	result, err := commitElements(gitInfo, *message, elementList, *dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if err := cache.Save(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// gituse commit [flags] [<repoPath>=<localFile>...]
+func runCommit(args []string) (any, error) {
+	fs := flag.NewFlagSet("commit", flag.ContinueOnError)
+	common := addCommonFlags(fs)
+	message := fs.String("m", "", "commit message (required)")
+	stdinPath := fs.String("stdin", "", "repository path to write stdin content to")
+	dryRun := fs.Bool("dry-run", false, "print the changes without creating the commit")
+	showProgress := fs.Bool("progress", false, "print progress to stderr")
+	normalizeEol := fs.Bool("normalize-eol", false, "convert CRLF to LF in text files, following .gitattributes")
+	var deleteList stringList
+	fs.Var(&deleteList, "delete", "repository path to delete (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gituse commit -m <message> [flags] [<repoPath>=<localFile>...]")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if *message == "" || (fs.NArg() == 0 && *stdinPath == "" && len(deleteList) == 0) {
+		fs.Usage()
+		return nil, errUsage
+	}
+	conf, err := common.load()
+	if err != nil {
+		return nil, err
+	}
+	if err := conf.requireAuthor(); err != nil {
+		return nil, err
+	}
+	gitInfo, err := conf.gitInfo()
+	if err != nil {
+		return nil, err
+	}
+	gitInfo.SetLineEndingNormalization(*normalizeEol)
+
+	if *showProgress {
+		printer := newProgressPrinter(os.Stderr)
+		defer printer.finish()
+		gitInfo.SetProgressFunc(printer.print)
+	}
+	var elementList []*service.CommitElement
+	for _, arg := range fs.Args() {
+		repoPath, localPath, ok := strings.Cut(arg, "=")
+		if !ok || repoPath == "" || localPath == "" {
+			return nil, fmt.Errorf("invalid file argument %q. use <repoPath>=<localFile>.", arg)
+		}
+		data, err := os.ReadFile(localPath)
+		if err != nil {
+			return nil, err
+		}
+		element, err := service.MakeCommitElementByBytes(repoPath, data)
+		if err != nil {
+			return nil, err
+		}
+		elementList = append(elementList, element)
+	}
+	if *stdinPath != "" {
+		element, err := service.MakeCommitElementByReader(*stdinPath, os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		elementList = append(elementList, element)
+	}
+	for _, repoPath := range deleteList {
+		element, err := service.MakeCommitElementForDelete(repoPath)
+		if err != nil {
+			return nil, err
+		}
+		elementList = append(elementList, element)
+	}
+	return commitElements(gitInfo, *message, elementList, *dryRun)
+}
+
+// read の出力
+type fileOutput struct {
+	Path     string `json:"path"`
+	Encoding string `json:"encoding"` //utf-8 または base64
+	Content  string `json:"content"`
+	Size     int    `json:"size"`
+}
+
+// gituse read [flags] <path>...
+func runRead(args []string) (any, error) {
+	fs := flag.NewFlagSet("read", flag.ContinueOnError)
+	common := addCommonFlags(fs)
+	raw := fs.Bool("raw", false, "write the file content to stdout as is instead of JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gituse read [flags] <path>...")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return nil, errUsage
+	}
+	conf, err := common.load()
+	if err != nil {
+		return nil, err
+	}
+	gitInfo, err := conf.gitInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	outputList := []*fileOutput{}
+	for _, repoPath := range fs.Args() {
+		data, err := gitInfo.GetFileContent(repoPath)
+		if err != nil {
+			return nil, err
+		}
+		if *raw {
+			os.Stdout.Write(data)
+			continue
+		}
+		output := &fileOutput{Path: repoPath, Size: len(data)}
+		if utf8.Valid(data) {
+			output.Encoding = "utf-8"
+			output.Content = string(data)
+		} else {
+			output.Encoding = "base64"
+			output.Content = base64.StdEncoding.EncodeToString(data)
+		}
+		outputList = append(outputList, output)
+	}
+	if *raw {
+		return nil, nil
+	}
+	return outputList, nil
+}
+
+// branches の出力
+type branchOutput struct {
+	Name      string `json:"name"`
+	Sha       string `json:"sha"`
+	Protected bool   `json:"protected"`
+}
+
+// gituse branches [flags]
+func runBranches(args []string) (any, error) {
+	fs := flag.NewFlagSet("branches", flag.ContinueOnError)
+	common := addCommonFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	conf, err := common.load()
+	if err != nil {
+		return nil, err
+	}
+	gitInfo, err := conf.gitInfo()
+	if err != nil {
+		return nil, err
+	}
+	branchList, err := gitInfo.ListBranches()
+	if err != nil {
+		return nil, err
+	}
+	outputList := []*branchOutput{}
+	for _, branch := range branchList {
+		outputList = append(outputList, &branchOutput{Name: branch.Name, Sha: branch.Commit.Sha, Protected: branch.Protected})
+	}
+	return outputList, nil
+}
+
+// repo create|update の出力
+type repoOutput struct {
+	Repository    string `json:"repository"`
+	Result        string `json:"result"`
+	Visibility    string `json:"visibility,omitempty"`
+	DefaultBranch string `json:"default_branch,omitempty"`
+	Url           string `json:"html_url,omitempty"`
+}
+
+// 指定されたフラグのみ変更するための、指定の有無を区別する文字列フラグ
+type optionalString struct {
+	value **string
+}
+
+func (opt *optionalString) String() string {
+	if opt.value == nil || *opt.value == nil {
+		return ""
+	}
+	return **opt.value
+}
+
+func (opt *optionalString) Set(value string) error {
+	*opt.value = &value
+	return nil
+}
+
+// 指定の有無を区別する真偽値フラグ
+type optionalBool struct {
+	value **bool
+}
+
+func (opt *optionalBool) String() string {
+	if opt.value == nil || *opt.value == nil {
+		return ""
+	}
+	return strconv.FormatBool(**opt.value)
+}
+
+func (opt *optionalBool) Set(value string) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*opt.value = &b
+	return nil
+}
+
+func (opt *optionalBool) IsBoolFlag() bool {
+	return true
+}
+
+// gituse repo create|update|delete [flags]
+func runRepo(args []string) (any, error) {
+	if len(args) == 0 || (args[0] != "create" && args[0] != "update" && args[0] != "delete") {
+		fmt.Fprintln(os.Stderr, "Usage: gituse repo create|update|delete [flags]")
+		return nil, errUsage
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("repo "+action, flag.ContinueOnError)
+	common := addCommonFlags(fs)
+	createOption := &service.CreateRepoOption{}
+	settings := &githubapi.UpdateRepoData{}
+	var template string
+	switch action {
+	case "create":
+		fs.BoolVar(&createOption.Organization, "org", false, "create the repository in the organization given by -owner")
+		fs.StringVar(&createOption.Visibility, "visibility", "private", "private, public or internal")
+		fs.StringVar(&createOption.Description, "description", "", "repository description")
+		fs.StringVar(&createOption.Homepage, "homepage", "", "repository homepage URL")
+		fs.BoolVar(&createOption.AutoInit, "auto-init", true, "create an initial commit with a README")
+		fs.StringVar(&createOption.DefaultBranch, "default-branch", "", "name of the default branch")
+		fs.StringVar(&createOption.GitignoreTemplate, "gitignore", "", "gitignore template name (e.g. Go)")
+		fs.StringVar(&createOption.LicenseTemplate, "license", "", "license template keyword (e.g. mit)")
+		fs.BoolVar(&createOption.IsTemplate, "is-template", false, "make the repository a template")
+		fs.StringVar(&template, "template", "", "create from the template repository <owner>/<repo>")
+		fs.BoolVar(&createOption.IncludeAllBranches, "include-all-branches", false, "include all branches of the template")
+	case "update":
+		fs.Var(&optionalString{&settings.Description}, "description", "repository description")
+		fs.Var(&optionalString{&settings.Homepage}, "homepage", "repository homepage URL")
+		fs.Var(&optionalString{&settings.Visibility}, "visibility", "private, public or internal")
+		fs.Var(&optionalString{&settings.Default_branch}, "default-branch", "name of the default branch")
+		fs.Var(&optionalBool{&settings.Has_issues}, "issues", "enable issues")
+		fs.Var(&optionalBool{&settings.Has_wiki}, "wiki", "enable the wiki")
+		fs.Var(&optionalBool{&settings.Has_projects}, "projects", "enable projects")
+		fs.Var(&optionalBool{&settings.Is_template}, "is-template", "make the repository a template")
+		fs.Var(&optionalBool{&settings.Delete_branch_on_merge}, "delete-branch-on-merge", "delete head branches after merge")
+		fs.Var(&optionalBool{&settings.Archived}, "archived", "archive the repository")
+	}
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return nil, err
+	}
+	if template != "" {
+		owner, repo, ok := strings.Cut(template, "/")
+		if !ok || owner == "" || repo == "" {
+			return nil, fmt.Errorf("invalid template %q. use <owner>/<repo>.", template)
+		}
+		createOption.TemplateOwner = owner
+		createOption.TemplateRepository = repo
+	}
+	conf, err := common.load()
+	if err != nil {
+		return nil, err
+	}
+	gitInfo, err := conf.gitInfo()
+	if err != nil {
+		return nil, err
+	}
+	var repoResp *githubapi.RepoResponse
+	switch action {
+	case "create":
+		repoResp, err = gitInfo.CreateRepo(createOption)
+	case "update":
+		repoResp, err = gitInfo.UpdateRepoSettings(settings)
+	case "delete":
+		err = gitInfo.DeletePrivateRepo()
+	default:
+		err = errors.New("unknown repo action " + action)
+	}
+	if err != nil {
+		return nil, err
+	}
+	output := &repoOutput{Repository: conf.Owner + "/" + conf.Repository, Result: action + "d"}
+	if repoResp != nil {
+		output.Repository = repoResp.Full_name
+		output.Visibility = repoResp.Visibility
+		output.DefaultBranch = repoResp.Default_branch
+		output.Url = repoResp.Html_url
+	}
+	return output, nil
+}
+
+// preflight の出力
+type preflightOutput struct {
+	Ok            bool                   `json:"ok"`
+	TokenType     string                 `json:"token_type"`
+	Scopes        []string               `json:"scopes,omitempty"`
+	DefaultBranch string                 `json:"default_branch,omitempty"`
+	Checks        []preflightCheckOutput `json:"checks"`
+}
+
+type preflightCheckOutput struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// gituse preflight [flags]
+func runPreflight(args []string) (any, error) {
+	fs := flag.NewFlagSet("preflight", flag.ContinueOnError)
+	common := addCommonFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	conf, err := common.load()
+	if err != nil {
+		return nil, err
+	}
+	gitInfo, err := conf.gitInfo()
+	if err != nil {
+		return nil, err
+	}
+	report, err := gitInfo.Preflight()
+	if err != nil {
+		return nil, err
+	}
+	output := &preflightOutput{
+		Ok:            report.Ok(),
+		TokenType:     report.TokenType,
+		Scopes:        report.Scopes,
+		DefaultBranch: report.DefaultBranch,
+		Checks:        []preflightCheckOutput{},
+	}
+	for _, check := range report.Checks {
+		output.Checks = append(output.Checks, preflightCheckOutput{Name: check.Name, Status: string(check.Status), Detail: check.Detail})
+	}
+	if !output.Ok {
+		writeJSON(os.Stdout, output)
+		return nil, errors.New("preflight check failed.")
+	}
+	return output, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gitobj "github.com/daze-doragon/go-gituse/pkg/gitobj"
+)
+
+// ローカルのbareリポジトリに接続するフラグを返す
+func localRepoFlags(t *testing.T) []string {
+	t.Helper()
+	isolateConfig(t)
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	if _, err := gitobj.InitBare(repoPath, "main"); err != nil {
+		t.Fatal(err)
+	}
+	return []string{"-provider", "local", "-repo", repoPath, "-branch", "main", "-author", "tester", "-email", "tester@example.com"}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommitCommands(t *testing.T) {
+	connection := localRepoFlags(t)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "public", "index.html"), "index\n")
+	writeFile(t, filepath.Join(dir, "public", "css", "style.css"), "body {}\n")
+	writeFile(t, filepath.Join(dir, "note.txt"), "note\n")
+
+	//commit-dirは-prefixの下に配置する
+	result, err := runCommitDir(append(connection, "-m", "deploy", "-prefix", "site", filepath.Join(dir, "public")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, ok := result.(*commitOutput)
+	if !ok || first.Message != "deploy" || len(first.Parents) != 0 {
+		t.Fatalf("unexpected output %+v", result)
+	}
+
+	//-dry-runは変更内容のみ返す
+	result, err = runCommit(append(connection, "-m", "add note", "-dry-run", "-delete", "site/index.html", "docs/note.txt="+filepath.Join(dir, "note.txt")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, ok := result.(*planOutput)
+	if !ok || plan.BaseCommitSha != first.Sha || len(plan.Entries) != 2 || plan.Entries[0].Action != "add" || plan.Entries[1].Action != "delete" {
+		t.Fatalf("unexpected plan %+v", result)
+	}
+
+	result, err = runCommit(append(connection, "-m", "add note", "-delete", "site/index.html", "docs/note.txt="+filepath.Join(dir, "note.txt")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := result.(*commitOutput)
+	if len(second.Parents) != 1 || second.Parents[0] != first.Sha {
+		t.Errorf("unexpected commit %+v", second)
+	}
+
+	//読み込みとブランチの一覧
+	result, err = runRead(append(connection, "docs/note.txt", "site/css/style.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := result.([]*fileOutput)
+	if len(files) != 2 || files[0].Content != "note\n" || files[0].Encoding != "utf-8" || files[1].Size != 8 {
+		t.Errorf("unexpected files %+v", files)
+	}
+	if _, err := runRead(append(connection, "site/index.html")); err == nil {
+		t.Error("deleted file should not be read.")
+	}
+	result, err = runBranches(connection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branches := result.([]*branchOutput); len(branches) != 1 || branches[0].Name != "main" || branches[0].Sha != second.Sha {
+		t.Errorf("unexpected branches %+v", branches)
+	}
+}
+
+func TestCommandArguments(t *testing.T) {
+	connection := localRepoFlags(t)
+
+	//フラグと引数の誤りは終了コード2にする
+	for name, run := range map[string]func() (any, error){
+		"commit-dir without message": func() (any, error) { return runCommitDir(append(connection, "dir")) },
+		"commit-dir without dir":     func() (any, error) { return runCommitDir(append(connection, "-m", "msg")) },
+		"commit without files":       func() (any, error) { return runCommit(append(connection, "-m", "msg")) },
+		"read without path":          func() (any, error) { return runRead(connection) },
+		"unknown flag":               func() (any, error) { return runBranches(append(connection, "-unknown")) },
+		"repo without action":        func() (any, error) { return runRepo(nil) },
+		"repo unknown action":        func() (any, error) { return runRepo([]string{"rename"}) },
+		"invalid bool":               func() (any, error) { return runRepo([]string{"update", "-wiki=maybe"}) },
+	} {
+		if _, err := run(); !errors.Is(err, errUsage) {
+			t.Errorf("%s: expected usage error, got %v", name, err)
+		}
+	}
+
+	//設定と引数の内容の誤り
+	for name, run := range map[string]func() (any, error){
+		"invalid file argument": func() (any, error) { return runCommit(append(connection, "-m", "msg", "no-separator")) },
+		"missing local file":    func() (any, error) { return runCommit(append(connection, "-m", "msg", "a.txt=/missing/file")) },
+		"missing author":        func() (any, error) { return runCommit([]string{"-provider", "local", "-repo", "/tmp/repo.git", "-m", "msg", "-delete", "a"}) },
+		"invalid template":      func() (any, error) { return runRepo(append([]string{"create", "-template", "no-slash"}, connection...)) },
+	} {
+		if _, err := run(); err == nil || errors.Is(err, errUsage) {
+			t.Errorf("%s: expected an error, got %v", name, err)
+		}
+	}
+}
+
+func TestOptionalFlags(t *testing.T) {
+	var description *string
+	var wiki *bool
+	descFlag := &optionalString{&description}
+	wikiFlag := &optionalBool{&wiki}
+	//指定されていない場合はnilのまま
+	if descFlag.String() != "" || wikiFlag.String() != "" || description != nil || wiki != nil {
+		t.Error("unset flags should be nil.")
+	}
+	descFlag.Set("")
+	wikiFlag.Set("false")
+	if description == nil || *description != "" || wiki == nil || *wiki || wikiFlag.String() != "false" {
+		t.Errorf("flags set to empty and false should be kept. %v %v", description, wiki)
+	}
+	if err := wikiFlag.Set("maybe"); err == nil {
+		t.Error("invalid bool should be rejected.")
+	}
+
+	var list stringList
+	list.Set("a")
+	list.Set("b")
+	if list.String() != "a,b" {
+		t.Errorf("unexpected list %v", list)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	giteaapi "github.com/daze-doragon/go-gituse/pkg/giteaapi"
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	gitlabapi "github.com/daze-doragon/go-gituse/pkg/gitlabapi"
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// 接続先とコミット作成者の設定。優先順位はフラグ > 環境変数 > 設定ファイル。
+type config struct {
+	Token      string `json:"token"`
+	TokenFile  string `json:"token_file"`
+	Owner      string `json:"owner"`
+	Repository string `json:"repository"`
+	Branch     string `json:"branch"`
+	Author     string `json:"author"`
+	Email      string `json:"email"`
+	BaseUrl    string `json:"base_url"`
+	Backend    string `json:"backend"`  //rest, graphql or push
+	Provider   string `json:"provider"` //github, gitlab, gitea or local
+
+	//GitHub Appとして認証する場合の設定
+	AppId             string `json:"app_id"`
+	AppInstallationId int64  `json:"app_installation_id"`
+	AppPrivateKeyFile string `json:"app_private_key_file"`
+
+	verbose bool
+}
+
+// 各サブコマンドで共通のフラグ
+type commonFlags struct {
+	configPath string
+	verbose    bool
+	flagConfig config
+}
+
+func addCommonFlags(fs *flag.FlagSet) *commonFlags {
+	common := &commonFlags{}
+	fs.BoolVar(&common.verbose, "verbose", false, "log each API request to stderr")
+	fs.StringVar(&common.configPath, "config", "", "config file path (default: $GITUSE_CONFIG or <user config dir>/gituse/config.json)")
+	fs.StringVar(&common.flagConfig.Token, "token", "", "fine-grained personal access token ($GITUSE_TOKEN, $GITHUB_TOKEN)")
+	fs.StringVar(&common.flagConfig.TokenFile, "token-file", "", "file to read the token from ($GITUSE_TOKEN_FILE)")
+	fs.StringVar(&common.flagConfig.AppId, "app-id", "", "GitHub App id to authenticate as ($GITUSE_APP_ID)")
+	fs.Int64Var(&common.flagConfig.AppInstallationId, "app-installation-id", 0, "GitHub App installation id ($GITUSE_APP_INSTALLATION_ID)")
+	fs.StringVar(&common.flagConfig.AppPrivateKeyFile, "app-private-key", "", "GitHub App private key PEM file ($GITUSE_APP_PRIVATE_KEY_FILE)")
+	fs.StringVar(&common.flagConfig.Owner, "owner", "", "repository owner ($GITUSE_OWNER)")
+	fs.StringVar(&common.flagConfig.Repository, "repo", "", "repository name ($GITUSE_REPOSITORY)")
+	fs.StringVar(&common.flagConfig.Branch, "branch", "", "branch name, default main ($GITUSE_BRANCH)")
+	fs.StringVar(&common.flagConfig.Author, "author", "", "commit author name ($GITUSE_AUTHOR)")
+	fs.StringVar(&common.flagConfig.Email, "email", "", "commit author email ($GITUSE_EMAIL)")
+	fs.StringVar(&common.flagConfig.BaseUrl, "base-url", "", "API URL, default https://api.github.com ($GITUSE_BASE_URL)")
+	fs.StringVar(&common.flagConfig.Backend, "backend", "", "commit backend, rest, graphql (verified commits for GitHub Apps) or push (one git push over HTTPS), default rest ($GITUSE_BACKEND)")
+	fs.StringVar(&common.flagConfig.Provider, "provider", "", "forge, github, gitlab (owner is the group path), gitea (also Forgejo, -base-url is required) or local (-repo is the path of a bare repository), default github ($GITUSE_PROVIDER)")
+	return common
+}
+
+// 設定ファイル、環境変数、フラグの順に読み込んで設定を決める
+func (common *commonFlags) load() (*config, error) {
+	conf := &config{}
+	configPath := common.configPath
+	explicit := configPath != ""
+	if configPath == "" {
+		configPath = os.Getenv("GITUSE_CONFIG")
+		explicit = configPath != ""
+	}
+	if configPath == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			configPath = filepath.Join(dir, "gituse", "config.json")
+		}
+	}
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err == nil {
+			if err := json.Unmarshal(data, conf); err != nil {
+				return nil, fmt.Errorf("invalid config file %s. %w", configPath, err)
+			}
+		} else if explicit || !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("cannot read config file %s. %w", configPath, err)
+		}
+	}
+
+	overwrite(&conf.Token, os.Getenv("GITHUB_TOKEN"))
+	overwrite(&conf.Token, os.Getenv("GITUSE_TOKEN"))
+	overwrite(&conf.TokenFile, os.Getenv("GITUSE_TOKEN_FILE"))
+	overwrite(&conf.AppId, os.Getenv("GITUSE_APP_ID"))
+	overwrite(&conf.AppPrivateKeyFile, os.Getenv("GITUSE_APP_PRIVATE_KEY_FILE"))
+	if value := os.Getenv("GITUSE_APP_INSTALLATION_ID"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GITUSE_APP_INSTALLATION_ID. %w", err)
+		}
+		conf.AppInstallationId = id
+	}
+	overwrite(&conf.Owner, os.Getenv("GITUSE_OWNER"))
+	overwrite(&conf.Repository, os.Getenv("GITUSE_REPOSITORY"))
+	overwrite(&conf.Branch, os.Getenv("GITUSE_BRANCH"))
+	overwrite(&conf.Author, os.Getenv("GITUSE_AUTHOR"))
+	overwrite(&conf.Email, os.Getenv("GITUSE_EMAIL"))
+	overwrite(&conf.BaseUrl, os.Getenv("GITUSE_BASE_URL"))
+	overwrite(&conf.Backend, os.Getenv("GITUSE_BACKEND"))
+	overwrite(&conf.Provider, os.Getenv("GITUSE_PROVIDER"))
+
+	overwrite(&conf.Token, common.flagConfig.Token)
+	overwrite(&conf.TokenFile, common.flagConfig.TokenFile)
+	overwrite(&conf.AppId, common.flagConfig.AppId)
+	overwrite(&conf.AppPrivateKeyFile, common.flagConfig.AppPrivateKeyFile)
+	if common.flagConfig.AppInstallationId != 0 {
+		conf.AppInstallationId = common.flagConfig.AppInstallationId
+	}
+	overwrite(&conf.Owner, common.flagConfig.Owner)
+	overwrite(&conf.Repository, common.flagConfig.Repository)
+	overwrite(&conf.Branch, common.flagConfig.Branch)
+	overwrite(&conf.Author, common.flagConfig.Author)
+	overwrite(&conf.Email, common.flagConfig.Email)
+	overwrite(&conf.BaseUrl, common.flagConfig.BaseUrl)
+	overwrite(&conf.Backend, common.flagConfig.Backend)
+	overwrite(&conf.Provider, common.flagConfig.Provider)
+
+	conf.verbose = common.verbose
+
+	if conf.Provider == "local" {
+		if conf.Repository == "" {
+			return nil, errors.New("repository is required.")
+		}
+	} else if conf.Owner == "" || conf.Repository == "" {
+		return nil, errors.New("owner and repository are required.")
+	}
+	switch service.CommitBackend(conf.Backend) {
+	case "", service.BackendRest, service.BackendGraphql, service.BackendPush:
+	default:
+		return nil, fmt.Errorf("invalid backend %s. use rest, graphql or push.", conf.Backend)
+	}
+	switch conf.Provider {
+	case "", "github", "gitlab", "gitea", "local":
+	default:
+		return nil, fmt.Errorf("invalid provider %s. use github, gitlab, gitea or local.", conf.Provider)
+	}
+	return conf, nil
+}
+
+func overwrite(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
+
+// 設定からGitInfoを作成する。認証はGitHub App、トークンファイル、トークンの順に優先する
+func (conf *config) gitInfo() (*service.GitInfo, error) {
+	switch conf.Provider {
+	case "gitlab":
+		return conf.gitlabInfo()
+	case "gitea":
+		return conf.giteaInfo()
+	case "local":
+		return service.GetGitInfoByLocalRepository(conf.Repository, conf.Branch, conf.Author, conf.Email)
+	}
+	client := &githubapi.GitClient{
+		Token:      conf.Token,
+		Owner:      conf.Owner,
+		Repository: conf.Repository,
+		Branch:     conf.Branch,
+		BaseUrl:    conf.BaseUrl,
+		MaxRetries: 3,
+	}
+	if conf.verbose {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+		client.Hooks = append(client.Hooks, &githubapi.SlogHook{Logger: logger})
+	}
+	if conf.AppId != "" {
+		if conf.AppInstallationId == 0 || conf.AppPrivateKeyFile == "" {
+			return nil, errors.New("app installation id and private key are required to authenticate as a GitHub App.")
+		}
+		privateKey, err := os.ReadFile(conf.AppPrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		appSource, err := githubapi.NewAppTokenSource(conf.AppId, conf.AppInstallationId, privateKey)
+		if err != nil {
+			return nil, err
+		}
+		appSource.BaseUrl = conf.BaseUrl
+		client.TokenSource = appSource
+	} else if conf.TokenFile != "" {
+		client.TokenSource = githubapi.FileTokenSource(conf.TokenFile)
+	}
+	gitInfo, err := service.GetGitInfoByClient(client, conf.Author, conf.Email)
+	if err != nil {
+		return nil, err
+	}
+	gitInfo.SetCommitBackend(service.CommitBackend(conf.Backend))
+	return gitInfo, nil
+}
+
+// 設定からGitLabのプロジェクトに接続するGitInfoを作成する。プロジェクトのパスはowner/repository
+func (conf *config) gitlabInfo() (*service.GitInfo, error) {
+	token, err := conf.staticToken()
+	if err != nil {
+		return nil, err
+	}
+	client := &gitlabapi.GitlabClient{
+		Token:   token,
+		Project: conf.Owner + "/" + conf.Repository,
+		Branch:  conf.Branch,
+		BaseUrl: conf.BaseUrl,
+	}
+	return service.GetGitInfoByProvider(service.NewGitlabProvider(client), conf.Author, conf.Email)
+}
+
+// 設定からGiteaまたはForgejoのリポジトリに接続するGitInfoを作成する
+func (conf *config) giteaInfo() (*service.GitInfo, error) {
+	token, err := conf.staticToken()
+	if err != nil {
+		return nil, err
+	}
+	if conf.BaseUrl == "" {
+		return nil, errors.New("base url is required for gitea. e.g. https://gitea.example.com/api/v1")
+	}
+	client := &giteaapi.GiteaClient{
+		Token:      token,
+		Owner:      conf.Owner,
+		Repository: conf.Repository,
+		Branch:     conf.Branch,
+		BaseUrl:    conf.BaseUrl,
+	}
+	return service.GetGitInfoByProvider(service.NewGiteaProvider(client), conf.Author, conf.Email)
+}
+
+// GitHub以外のforgeで使うトークンを返す。トークンファイルがある場合はその内容を使う
+func (conf *config) staticToken() (string, error) {
+	if conf.AppId != "" {
+		return "", fmt.Errorf("GitHub App authentication cannot be used with %s.", conf.Provider)
+	}
+	if conf.TokenFile == "" {
+		return conf.Token, nil
+	}
+	data, err := os.ReadFile(conf.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("cannot read token file %s. %w", conf.TokenFile, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// コミットを作成するコマンド用に作成者の設定を確認する
+func (conf *config) requireAuthor() error {
+	if conf.Author == "" || conf.Email == "" {
+		return errors.New("author and email are required to create a commit.")
+	}
+	return nil
+}
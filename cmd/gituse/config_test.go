@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 環境変数とユーザの設定ファイルの影響を受けないようにする
+func isolateConfig(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{
+		"GITHUB_TOKEN", "GITUSE_TOKEN", "GITUSE_TOKEN_FILE", "GITUSE_CONFIG",
+		"GITUSE_APP_ID", "GITUSE_APP_INSTALLATION_ID", "GITUSE_APP_PRIVATE_KEY_FILE",
+		"GITUSE_OWNER", "GITUSE_REPOSITORY", "GITUSE_BRANCH", "GITUSE_AUTHOR", "GITUSE_EMAIL",
+		"GITUSE_BASE_URL", "GITUSE_BACKEND", "GITUSE_PROVIDER",
+	} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+}
+
+// 共通フラグを解析して設定を読み込む
+func loadConfig(t *testing.T, args ...string) (*config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	common := addCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return common.load()
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigPriority(t *testing.T) {
+	isolateConfig(t)
+	path := writeConfigFile(t, `{"token": "file-token", "owner": "file-owner", "repository": "file-repo", "branch": "file-branch", "author": "file-author", "backend": "graphql", "app_installation_id": 1}`)
+
+	//設定ファイルのみ
+	conf, err := loadConfig(t, "-config", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Token != "file-token" || conf.Owner != "file-owner" || conf.Branch != "file-branch" || conf.Backend != "graphql" || conf.AppInstallationId != 1 {
+		t.Errorf("unexpected config %+v", conf)
+	}
+
+	//環境変数は設定ファイルより優先し、GITUSE_TOKENはGITHUB_TOKENより優先する
+	t.Setenv("GITHUB_TOKEN", "github-token")
+	t.Setenv("GITUSE_TOKEN", "env-token")
+	t.Setenv("GITUSE_OWNER", "env-owner")
+	t.Setenv("GITUSE_APP_INSTALLATION_ID", "2")
+	t.Setenv("GITUSE_CONFIG", path)
+	conf, err = loadConfig(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Token != "env-token" || conf.Owner != "env-owner" || conf.Repository != "file-repo" || conf.AppInstallationId != 2 {
+		t.Errorf("unexpected config %+v", conf)
+	}
+
+	//フラグは環境変数より優先する
+	conf, err = loadConfig(t, "-token", "flag-token", "-owner", "flag-owner", "-app-installation-id", "3", "-backend", "push", "-verbose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Token != "flag-token" || conf.Owner != "flag-owner" || conf.Author != "file-author" || conf.AppInstallationId != 3 || conf.Backend != "push" || !conf.verbose {
+		t.Errorf("unexpected config %+v", conf)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	isolateConfig(t)
+	for name, test := range map[string]struct {
+		env  map[string]string
+		args []string
+		want string
+	}{
+		"missing owner":            {args: []string{"-repo", "repo"}, want: "owner and repository are required"},
+		"invalid backend":          {args: []string{"-owner", "o", "-repo", "r", "-backend", "soap"}, want: "invalid backend"},
+		"invalid provider":         {args: []string{"-owner", "o", "-repo", "r", "-provider", "svn"}, want: "invalid provider"},
+		"invalid installation id":  {env: map[string]string{"GITUSE_APP_INSTALLATION_ID": "abc"}, args: []string{"-owner", "o", "-repo", "r"}, want: "invalid GITUSE_APP_INSTALLATION_ID"},
+		"missing explicit config":  {args: []string{"-config", filepath.Join(t.TempDir(), "missing.json")}, want: "cannot read config file"},
+		"invalid config":           {args: []string{"-config", writeConfigFile(t, "{")}, want: "invalid config file"},
+		"local without repository": {args: []string{"-provider", "local"}, want: "repository is required"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			if _, err := loadConfig(t, test.args...); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("expected %q, got %v", test.want, err)
+			}
+		})
+	}
+
+	//ローカルのリポジトリはownerがなくてもよい
+	if _, err := loadConfig(t, "-provider", "local", "-repo", "/tmp/repo.git"); err != nil {
+		t.Errorf("local provider should not require owner. %v", err)
+	}
+}
+
+func TestConfigGitInfo(t *testing.T) {
+	isolateConfig(t)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("file-token\n"), 0o600)
+
+	//GitHub以外ではトークンファイルの内容をそのまま使う
+	conf := &config{Provider: "gitlab", TokenFile: tokenFile, Token: "ignored"}
+	if token, err := conf.staticToken(); err != nil || token != "file-token" {
+		t.Errorf("unexpected token %q %v", token, err)
+	}
+	conf.AppId = "1"
+	if _, err := conf.staticToken(); err == nil {
+		t.Error("GitHub App should be rejected for gitlab.")
+	}
+
+	for name, conf := range map[string]*config{
+		"app without key":      {Owner: "o", Repository: "r", AppId: "1", AppInstallationId: 2},
+		"app with missing key": {Owner: "o", Repository: "r", AppId: "1", AppInstallationId: 2, AppPrivateKeyFile: filepath.Join(t.TempDir(), "missing.pem")},
+		"gitea without base":   {Provider: "gitea", Owner: "o", Repository: "r", Token: "t"},
+		"missing local":        {Provider: "local", Repository: filepath.Join(t.TempDir(), "missing.git")},
+		"gitlab with app":      {Provider: "gitlab", Owner: "o", Repository: "r", AppId: "1"},
+		"missing token file":   {Provider: "gitea", Owner: "o", Repository: "r", TokenFile: filepath.Join(t.TempDir(), "missing"), BaseUrl: "http://localhost"},
+	} {
+		if _, err := conf.gitInfo(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if err := (&config{Author: "a"}).requireAuthor(); err == nil {
+		t.Error("email should be required.")
+	}
+}
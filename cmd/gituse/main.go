@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const usage = `gituse - create commits on GitHub, GitLab, Gitea or a local bare repository without a working copy
+
+Usage:
+  gituse <command> [flags] [args]
+
+Commands:
+  commit-dir  commit files in a local directory
+  commit      commit individual files, stdin content and deletions
+  read        print files in the branch
+  branches    list branches
+  repo        create, update or delete the GitHub repository (repo create | update | delete)
+  preflight   check the GitHub token, repository, branch and write permission
+
+Connection flags (-provider, -base-url, -token, -token-file, -app-id,
+-app-installation-id, -app-private-key, -owner, -repo, -branch, -author,
+-email, -backend, -config, -verbose) are accepted by every command.
+Run "gituse <command> -h" for details.
+Results are written to stdout as JSON.
+`
+
+// フラグの解析エラー。終了コード2で終了する
+var errUsage = errors.New("usage error")
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var result any
+	var err error
+	args := os.Args[2:]
+	switch os.Args[1] {
+	case "commit-dir":
+		result, err = runCommitDir(args)
+	case "commit":
+		result, err = runCommit(args)
+	case "read":
+		result, err = runRead(args)
+	case "branches":
+		result, err = runBranches(args)
+	case "repo":
+		result, err = runRepo(args)
+	case "preflight":
+		result, err = runPreflight(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		writeJSON(os.Stderr, map[string]string{"error": err.Error()})
+		os.Exit(1)
+	}
+	if result != nil {
+		writeJSON(os.Stdout, result)
+	}
+}
+
+func writeJSON(f *os.File, v any) {
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// 複数回指定できる文字列フラグ
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// フラグを解析する。ヘルプ表示やエラーの場合はerrUsageを返す
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
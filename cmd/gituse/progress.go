@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// 進捗を1行で上書きしながら出力する。段階が変わったら改行する
+type progressPrinter struct {
+	out        io.Writer
+	phase      service.ProgressPhase
+	phaseStart time.Time
+}
+
+func newProgressPrinter(out io.Writer) *progressPrinter {
+	return &progressPrinter{out: out}
+}
+
+func (printer *progressPrinter) print(progress service.Progress) {
+	if progress.Phase != printer.phase {
+		if printer.phase != "" {
+			fmt.Fprintln(printer.out)
+		}
+		printer.phase = progress.Phase
+		printer.phaseStart = time.Now()
+	}
+	line := fmt.Sprintf("%-6s %d", progress.Phase, progress.Current)
+	if progress.Total > 0 {
+		line += fmt.Sprintf("/%d", progress.Total)
+	}
+	if progress.TotalBytes > 0 {
+		line += fmt.Sprintf(" %s/%s", formatBytes(progress.Bytes), formatBytes(progress.TotalBytes))
+		if progress.Bytes > 0 && progress.Bytes < progress.TotalBytes {
+			elapsed := time.Since(printer.phaseStart)
+			remaining := time.Duration(float64(elapsed) * float64(progress.TotalBytes-progress.Bytes) / float64(progress.Bytes))
+			line += fmt.Sprintf(" ETA %s", remaining.Round(time.Second))
+		}
+	} else if progress.Bytes > 0 {
+		line += " " + formatBytes(progress.Bytes)
+	}
+	if progress.Groups > 1 {
+		line += fmt.Sprintf(" (commit %d/%d)", progress.Group, progress.Groups)
+	}
+	if progress.Attempt > 1 {
+		line += fmt.Sprintf(" (retry %d)", progress.Attempt-1)
+	}
+	fmt.Fprintf(printer.out, "\r\033[K%s", line)
+}
+
+// 出力を終える
+func (printer *progressPrinter) finish() {
+	if printer.phase != "" {
+		fmt.Fprintln(printer.out)
+	}
+}
+
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
@@ -1,9 +0,0 @@
-package main
-
-// import(
-// service "github.com/daze-doragon/go-gituse/pkg/service"
-// )
-
-func main() {
-	// add code
-}
@@ -2,4 +2,4 @@ module github.com/daze-doragon/go-gituse
 
 go 1.23.1
 
-require github.com/joho/godotenv v1.5.1 // indirect
+require github.com/joho/godotenv v1.5.1
@@ -0,0 +1,332 @@
+package giteaapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GiteaおよびForgejoのAPIクライアント
+type GiteaClient struct {
+	Token      string
+	Owner      string
+	Repository string
+	Branch     string
+	BaseUrl    string //APIのURL。https://<host>/api/v1
+
+	Context    context.Context //リクエストに使うcontext。nilの場合はcontext.Background()
+	HttpClient *http.Client    //nilの場合はhttp.DefaultClient
+}
+
+// 一覧取得APIの1ページの件数
+const perPage = 100
+
+// GetRepository APIの結果を受け取る構造体
+type RepositoryResponse struct {
+	Id             int64  `json:"id"`
+	Name           string `json:"name"`
+	Full_name      string `json:"full_name"`
+	Default_branch string `json:"default_branch"`
+	Empty          bool   `json:"empty"`
+	Private        bool   `json:"private"`
+	Html_url       string `json:"html_url"`
+}
+
+// GetBranch APIの結果を受け取る構造体
+type BranchResponse struct {
+	Name   string `json:"name"`
+	Commit struct {
+		Id      string `json:"id"`
+		Message string `json:"message"`
+		Url     string `json:"url"`
+	} `json:"commit"`
+	Protected bool `json:"protected"`
+}
+
+// GetCommit APIの結果を受け取る構造体
+type CommitResponse struct {
+	Sha    string `json:"sha"`
+	Commit struct {
+		Message string `json:"message"`
+		Tree    struct {
+			Sha string `json:"sha"`
+		} `json:"tree"`
+	} `json:"commit"`
+	Parents []struct {
+		Sha string `json:"sha"`
+	} `json:"parents"`
+}
+
+// GetTree APIの結果を受け取る構造体
+type TreeResponse struct {
+	Sha         string       `json:"sha"`
+	Tree        []*TreeEntry `json:"tree"`
+	Truncated   bool         `json:"truncated"`
+	Page        int          `json:"page"`
+	Total_count int          `json:"total_count"`
+}
+
+// GetTree APIの結果の内、1要素を表現する構造体
+type TreeEntry struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	Size int    `json:"size"`
+	Sha  string `json:"sha"`
+}
+
+// GetBlob APIの結果を受け取る構造体
+type BlobResponse struct {
+	Sha      string `json:"sha"`
+	Size     int    `json:"size"`
+	Encoding string `json:"encoding"`
+	Content  string `json:"content"`
+}
+
+// コミットの作成者
+type Identity struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// ChangeFiles APIのfilesに指定する構造体
+type ChangeFileOperation struct {
+	Operation string `json:"operation"` //create, update, delete
+	Path      string `json:"path"`
+	Content   string `json:"content,omitempty"`   //base64でエンコードした内容
+	Sha       string `json:"sha,omitempty"`       //update、deleteの場合は変更前のblobのsha
+	From_path string `json:"from_path,omitempty"` //updateで移動する場合の移動元
+}
+
+// ChangeFiles APIのbodyに指定する構造体
+type ChangeFilesData struct {
+	Files     []*ChangeFileOperation `json:"files"`
+	Branch    string                 `json:"branch,omitempty"`
+	Message   string                 `json:"message,omitempty"`
+	Author    *Identity              `json:"author,omitempty"`
+	Committer *Identity              `json:"committer,omitempty"`
+}
+
+// ChangeFiles APIの結果の内、作成したコミット
+type FileCommitResponse struct {
+	Sha      string `json:"sha"`
+	Url      string `json:"url"`
+	Html_url string `json:"html_url"`
+	Message  string `json:"message"`
+	Author   struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		Date  string `json:"date"`
+	} `json:"author"`
+	Committer struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		Date  string `json:"date"`
+	} `json:"committer"`
+	Parents []struct {
+		Sha string `json:"sha"`
+		Url string `json:"url"`
+	} `json:"parents"`
+	Tree struct {
+		Sha string `json:"sha"`
+		Url string `json:"url"`
+	} `json:"tree"`
+}
+
+// ChangeFiles APIの結果を受け取る構造体
+type FilesResponse struct {
+	Commit FileCommitResponse `json:"commit"`
+}
+
+// APIがエラーを返した場合のエラー。メッセージはレスポンスボディそのまま。
+type ApiError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ApiError) Error() string {
+	return e.Body
+}
+
+func newApiError(statusCode int, respData []byte) *ApiError {
+	return &ApiError{
+		StatusCode: statusCode,
+		Body:       string(respData),
+	}
+}
+
+// リポジトリのAPIのURLを返す
+func (git *GiteaClient) repoUrl() string {
+	return fmt.Sprintf("%s/repos/%s/%s", strings.TrimSuffix(git.BaseUrl, "/"), url.PathEscape(git.Owner), url.PathEscape(git.Repository))
+}
+
+// リポジトリの情報を取得する。存在しない場合はStatusCodeが404のApiErrorを返す。
+func (git *GiteaClient) GetRepository() (*RepositoryResponse, error) {
+	repoResp := &RepositoryResponse{}
+	if err := git.getJSON(git.repoUrl(), repoResp); err != nil {
+		return nil, err
+	}
+	return repoResp, nil
+}
+
+// ブランチの情報を取得する。存在しない場合はStatusCodeが404のApiErrorを返す。
+func (git *GiteaClient) GetBranch(branch string) (*BranchResponse, error) {
+	branchResp := &BranchResponse{}
+	if err := git.getJSON(git.repoUrl()+"/branches/"+url.PathEscape(branch), branchResp); err != nil {
+		return nil, err
+	}
+	return branchResp, nil
+}
+
+// ブランチの一覧を取得する。
+func (git *GiteaClient) ListBranches() ([]*BranchResponse, error) {
+	var branchList []*BranchResponse
+	for page := 1; ; page++ {
+		endPoint := fmt.Sprintf("%s/branches?page=%d&limit=%d", git.repoUrl(), page, perPage)
+		resp, respData, err := git.send("GET", endPoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, newApiError(resp.StatusCode, respData)
+		}
+		var pageList []*BranchResponse
+		if err := json.Unmarshal(respData, &pageList); err != nil {
+			return nil, err
+		}
+		branchList = append(branchList, pageList...)
+		//limitはサーバーの設定で小さくされるため、X-Total-Countで判定する
+		total, err := strconv.Atoi(resp.Header.Get("X-Total-Count"))
+		if err != nil {
+			total = len(branchList)
+		}
+		if len(pageList) == 0 || len(branchList) >= total {
+			return branchList, nil
+		}
+	}
+}
+
+// コミットを取得する。
+func (git *GiteaClient) GetCommit(sha string) (*CommitResponse, error) {
+	commitResp := &CommitResponse{}
+	if err := git.getJSON(git.repoUrl()+"/git/commits/"+url.PathEscape(sha), commitResp); err != nil {
+		return nil, err
+	}
+	return commitResp, nil
+}
+
+// treeを取得する。recursiveの場合は配下のすべての要素を返す。ページに分かれている場合はすべて取得する。
+func (git *GiteaClient) GetTree(sha string, recursive bool) (*TreeResponse, error) {
+	treeResp := &TreeResponse{Sha: sha}
+	for page := 1; ; page++ {
+		query := url.Values{}
+		query.Set("page", strconv.Itoa(page))
+		query.Set("per_page", strconv.Itoa(perPage))
+		if recursive {
+			query.Set("recursive", "true")
+		}
+		pageResp := &TreeResponse{}
+		if err := git.getJSON(git.repoUrl()+"/git/trees/"+url.PathEscape(sha)+"?"+query.Encode(), pageResp); err != nil {
+			return nil, err
+		}
+		treeResp.Sha = pageResp.Sha
+		treeResp.Total_count = pageResp.Total_count
+		treeResp.Tree = append(treeResp.Tree, pageResp.Tree...)
+		//truncatedは最後のページでもtrueになるため件数で判定する
+		if len(pageResp.Tree) == 0 || len(treeResp.Tree) >= pageResp.Total_count {
+			return treeResp, nil
+		}
+	}
+}
+
+// blobを取得する。
+func (git *GiteaClient) GetBlob(sha string) (*BlobResponse, error) {
+	blobResp := &BlobResponse{}
+	if err := git.getJSON(git.repoUrl()+"/git/blobs/"+url.PathEscape(sha), blobResp); err != nil {
+		return nil, err
+	}
+	return blobResp, nil
+}
+
+// 複数ファイルの変更から1コミットを作成し、ブランチを更新する。
+func (git *GiteaClient) ChangeFiles(data *ChangeFilesData) (*FilesResponse, error) {
+	if data.Branch == "" {
+		data.Branch = git.Branch
+	}
+	bodyData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	resp, respData, err := git.send("POST", git.repoUrl()+"/contents", bodyData)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, newApiError(resp.StatusCode, respData)
+	}
+	filesResp := &FilesResponse{}
+	if err := json.Unmarshal(respData, filesResp); err != nil {
+		return nil, err
+	}
+	return filesResp, nil
+}
+
+// GETして200の場合にresultに読み込む
+func (git *GiteaClient) getJSON(endPoint string, result any) error {
+	resp, respData, err := git.send("GET", endPoint, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newApiError(resp.StatusCode, respData)
+	}
+	return json.Unmarshal(respData, result)
+}
+
+// リクエストを送信し、レスポンスボディを読み込んで返す
+func (git *GiteaClient) send(method string, endPoint string, body []byte) (*http.Response, []byte, error) {
+	if git.Token == "" {
+		return nil, nil, errors.New("token is empty.")
+	}
+	if git.BaseUrl == "" {
+		return nil, nil, errors.New("base url is empty.")
+	}
+	ctx := git.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	httpClient := git.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endPoint, bodyReader)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", "token "+git.Token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, respData, nil
+}
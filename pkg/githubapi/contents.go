@@ -0,0 +1,106 @@
+package githubapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Contents APIのauthor、committerに指定する構造体
+type CommitAuthor struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Date  string `json:"date,omitempty"`
+}
+
+// PutContent APIのbodyに指定する構造体。Contentはbase64
+// 既存のファイルを更新する場合はShaに現在のblobのshaを指定する。
+type PutContentData struct {
+	Message   string        `json:"message"`
+	Content   string        `json:"content"`
+	Sha       string        `json:"sha,omitempty"`
+	Branch    string        `json:"branch,omitempty"`
+	Author    *CommitAuthor `json:"author,omitempty"`
+	Committer *CommitAuthor `json:"committer,omitempty"`
+}
+
+// DeleteContent APIのbodyに指定する構造体。Shaに削除するファイルの現在のblobのshaを指定する。
+type DeleteContentData struct {
+	Message   string        `json:"message"`
+	Sha       string        `json:"sha"`
+	Branch    string        `json:"branch,omitempty"`
+	Author    *CommitAuthor `json:"author,omitempty"`
+	Committer *CommitAuthor `json:"committer,omitempty"`
+}
+
+// PutContent、DeleteContent APIの結果を受け取る構造体。削除の場合はContentがnilになる。
+type ContentResponse struct {
+	Content *struct {
+		Name     string `json:"name"`
+		Path     string `json:"path"`
+		Sha      string `json:"sha"`
+		Size     int    `json:"size"`
+		Url      string `json:"url"`
+		Html_url string `json:"html_url"`
+	} `json:"content"`
+	Commit CreateCommitResponse `json:"commit"`
+}
+
+// Contents APIのURLを返す。パスは要素ごとにエスケープする
+func (git *GitClient) contentsEndPoint(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("%s/repos/%s/%s/contents/%s", git.baseUrl(), git.Owner, git.Repository, strings.Join(segments, "/"))
+}
+
+// Contents APIで1ファイルを作成・更新するコミットを作成し、ブランチを更新する。
+// data.Branchが空の場合はGitClient.Branchを使う。shaが現在のファイルと一致しない場合はStatusCodeが409のApiErrorを返す。
+func (git *GitClient) PutContent(path string, data *PutContentData) (*ContentResponse, error) {
+	if data.Branch == "" {
+		data.Branch = git.Branch
+	}
+	return git.sendContent("PUT", path, data)
+}
+
+// Contents APIで1ファイルを削除するコミットを作成し、ブランチを更新する。
+// data.Branchが空の場合はGitClient.Branchを使う。shaが現在のファイルと一致しない場合はStatusCodeが409のApiErrorを返す。
+func (git *GitClient) DeleteContent(path string, data *DeleteContentData) (*ContentResponse, error) {
+	if data.Branch == "" {
+		data.Branch = git.Branch
+	}
+	return git.sendContent("DELETE", path, data)
+}
+
+func (git *GitClient) sendContent(method string, path string, data any) (*ContentResponse, error) {
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
+	bodyData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := git.requestSend(method, git.contentsEndPoint(path), bodyData, headerMap)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, newApiError(resp.StatusCode, respData)
+	}
+	contentResponse := &ContentResponse{}
+	err = json.Unmarshal(respData, contentResponse)
+	if err != nil {
+		return nil, err
+	}
+	return contentResponse, nil
+}
@@ -1,22 +1,36 @@
 package githubapi
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type GitClient struct {
-	Token      string
-	Owner      string
-	Repository string
-	Branch     string
+	Token       string
+	TokenSource TokenSource //指定した場合はTokenより優先する
+	Owner       string
+	Repository  string
+	Branch      string
+	BaseUrl     string //APIのURL。空の場合はhttps://api.github.com。GitHub Enterprise Serverの場合はhttps://<host>/api/v3
+	GraphqlUrl  string //GraphQL APIのURL。空の場合はBaseUrlから決める
+	GitUrl      string //git smart HTTPのリポジトリのURL。空の場合はBaseUrlから決める
+
+	Context    context.Context //リクエストに使うcontext。nilの場合はcontext.Background()
+	HttpClient *http.Client    //nilの場合はhttp.DefaultClient
+	Hooks      []Hook          //リクエストの開始と終了時に呼ばれる
+	MaxRetries int             //429とsecondary rate limitの場合の再試行回数。GETとHEADは通信エラー、502、503、504でも再試行する。0の場合は再試行しない
+	RetryWait  time.Duration   //最初の再試行までの待ち時間。以降は2倍ずつ増やす。0の場合は1秒。Retry-Afterヘッダがある場合はそちらを優先する
 }
 
+// デフォルトのAPIのURL
+const DefaultBaseUrl = "https://api.github.com"
+
 // GetRef APIの結果を受け取る構造体
 type RefResponse struct {
 	Ref     string `json:"ref"`
@@ -90,6 +104,7 @@ type TreeData struct {
 }
 
 // CreateTree APIのbodyに指定するデータの内、Tree要素を表現する構造体
+// Shaが空の場合はnullとして送信され、そのパスはtreeから削除される。
 type TreeDataElement struct {
 	Path string `json:"path"`
 	Mode string `json:"mode"`
@@ -97,6 +112,53 @@ type TreeDataElement struct {
 	Sha  string `json:"sha"`
 }
 
+// Shaが空の要素をsha:nullとして出力する
+func (ele *TreeDataElement) MarshalJSON() ([]byte, error) {
+	var sha *string
+	if ele.Sha != "" {
+		sha = &ele.Sha
+	}
+	return json.Marshal(struct {
+		Path string  `json:"path"`
+		Mode string  `json:"mode"`
+		Type string  `json:"type"`
+		Sha  *string `json:"sha"`
+	}{
+		Path: ele.Path,
+		Mode: ele.Mode,
+		Type: ele.Type,
+		Sha:  sha,
+	})
+}
+
+// GetTree APIの結果を受け取る構造体
+type GetTreeResponse struct {
+	Sha       string              `json:"sha"`
+	Url       string              `json:"url"`
+	Tree      []*TreeEntryElement `json:"tree"`
+	Truncated bool                `json:"truncated"`
+}
+
+// GetTree APIの結果の内、Tree要素を表現する構造体
+type TreeEntryElement struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	Sha  string `json:"sha"`
+	Size int    `json:"size"`
+	Url  string `json:"url"`
+}
+
+// GetBlob APIの結果を受け取る構造体
+type BlobResponse struct {
+	Sha      string `json:"sha"`
+	Node_id  string `json:"node_id"`
+	Url      string `json:"url"`
+	Size     int    `json:"size"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
 // CreaateCommit APIの結果を受け取る構造体
 type CreateCommitResponse struct {
 	Sha      string `json:"sha"`
@@ -160,6 +222,55 @@ type UpdateRefResponse struct {
 	} `json:"object"`
 }
 
+// GetRepo APIの結果を受け取る構造体
+type RepoResponse struct {
+	Id             int64  `json:"id"`
+	Node_id        string `json:"node_id"`
+	Name           string `json:"name"`
+	Full_name      string `json:"full_name"`
+	Private        bool   `json:"private"`
+	Visibility     string `json:"visibility"`
+	Html_url       string `json:"html_url"`
+	Default_branch string `json:"default_branch"`
+	Archived       bool   `json:"archived"`
+	Disabled       bool   `json:"disabled"`
+	Size           int    `json:"size"`
+	Permissions    *struct {
+		Admin    bool `json:"admin"`
+		Maintain bool `json:"maintain"`
+		Push     bool `json:"push"`
+		Triage   bool `json:"triage"`
+		Pull     bool `json:"pull"`
+	} `json:"permissions"`
+}
+
+// ListBranches APIの結果の内、ブランチ1件を表現する構造体
+type BranchResponse struct {
+	Name   string `json:"name"`
+	Commit struct {
+		Sha string `json:"sha"`
+		Url string `json:"url"`
+	} `json:"commit"`
+	Protected bool `json:"protected"`
+}
+
+// APIがエラーを返した場合のエラー。メッセージはレスポンスボディそのまま。
+type ApiError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ApiError) Error() string {
+	return e.Body
+}
+
+func newApiError(statusCode int, respData []byte) *ApiError {
+	return &ApiError{
+		StatusCode: statusCode,
+		Body:       string(respData),
+	}
+}
+
 // github apiコール用のクライアントを取得する
 func GetGitClient(token *string, owner string, repoName string, branch *string) (*GitClient, error) {
 	if token == nil {
@@ -180,35 +291,60 @@ func GetGitClient(token *string, owner string, repoName string, branch *string)
 	return client, nil
 }
 
+// APIのURLを返す
+func (git *GitClient) baseUrl() string {
+	if git.BaseUrl == "" {
+		return DefaultBaseUrl
+	}
+	return strings.TrimSuffix(git.BaseUrl, "/")
+}
+
+// git smart HTTPでpushするリポジトリのURLを返す。GitHub Enterprise Serverの場合は/api/v3を除いたホストを使う
+func (git *GitClient) RemoteUrl() string {
+	if git.GitUrl != "" {
+		return git.GitUrl
+	}
+	baseUrl := git.baseUrl()
+	host := strings.TrimSuffix(baseUrl, "/api/v3")
+	if baseUrl == DefaultBaseUrl {
+		host = "https://github.com"
+	}
+	return host + "/" + git.Owner + "/" + git.Repository + ".git"
+}
+
+// ブランチの最新コミットのshaを返す。空のリポジトリの場合は空文字を返す。
 func (git *GitClient) GetLatestCommitSha() (string, error) {
 	ref, err := git.GetLatestRef()
 	if err != nil {
-		log.Printf("error occured when getting latest ref." + err.Error())
+		return "", fmt.Errorf("error occured when getting latest ref. %w", err)
 	}
 	return ref.Object.Sha, nil
 }
 
+// ブランチのrefを取得する。空のリポジトリの場合は空のRefResponseを返す。
+// ブランチが存在しない場合はStatusCodeが404のApiErrorを返す。
 func (git *GitClient) GetLatestRef() (*RefResponse, error) {
-	endPoint := fmt.Sprintf("https://api.github.com/repos/%s/%s/git/refs/heads/%s", git.Owner, git.Repository, git.Branch)
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = "Bearer " + git.Token
-	resp, err := requestSend("GET", endPoint, nil, headerMap)
+	//refs/heads/{branch}は前方一致で配列を返すことがあるため、完全一致のref/heads/{branch}を使う
+	endPoint := fmt.Sprintf("%s/repos/%s/%s/git/ref/heads/%s", git.baseUrl(), git.Owner, git.Repository, git.Branch)
+	headerMap, err := git.makeHeader()
 	if err != nil {
 		return nil, err
 	}
+	resp, err := git.requestSend("GET", endPoint, nil, headerMap)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 	respData, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode == http.StatusConflict {
+		//空のリポジトリの場合は409(Git Repository is empty.)が返る
+		return &RefResponse{}, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		emptyFlg, err := git.IsEmptyRepository()
-		if err != nil {
-			return nil, fmt.Errorf("error occured when check empty repository. %w", err)
-		}
-		if emptyFlg {
-			return &RefResponse{}, nil
-		}
-		return nil, errors.New(string(respData))
+		return nil, newApiError(resp.StatusCode, respData)
 	}
 	ref := &RefResponse{} //use RefResponse struct for return.
 	err = json.Unmarshal(respData, ref)
@@ -218,65 +354,76 @@ func (git *GitClient) GetLatestRef() (*RefResponse, error) {
 	return ref, nil
 }
 
+// リポジトリが存在し、アクセスできるかを返す。
+// アクセス権のないプライベートリポジトリも存在しない場合と同じくfalseになる。
 func (git *GitClient) IsExistRepo() (bool, error) {
 	resp, err := git.GetRepo()
 	if err != nil {
 		return false, err
 	}
-	if resp.StatusCode == http.StatusNotFound {
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
 		return true, nil
-	} else {
+	case http.StatusNotFound:
 		return false, nil
 	}
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	return false, newApiError(resp.StatusCode, respData)
 }
 
 func (git *GitClient) GetRepo() (*http.Response, error) {
-	endPoint := fmt.Sprintf("https://api.github.com/repos/%s/%s", git.Owner, git.Repository)
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = "Bearer " + git.Token
-	return requestSend("GET", endPoint, nil, headerMap)
+	endPoint := fmt.Sprintf("%s/repos/%s/%s", git.baseUrl(), git.Owner, git.Repository)
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
+	return git.requestSend("GET", endPoint, nil, headerMap)
 }
 
-func (git *GitClient) CreatePrivateRepo() error {
-	endPoint := "https://api.github.com/user/repos"
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = "Bearer " + git.Token
-	b := struct {
-		Name      string `json:"name"`
-		Private   bool   `json:"private"`
-		Auto_init bool   `json:"auto_init"`
-	}{
-		Name:      git.Repository,
-		Private:   true,
-		Auto_init: true,
-	}
-	bodyData, err := json.Marshal(b)
+// リポジトリの情報を取得する。トークンのスコープ等を確認できるようレスポンスヘッダもあわせて返す。
+func (git *GitClient) GetRepoInfo() (*RepoResponse, http.Header, error) {
+	resp, err := git.GetRepo()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	resp, err := requestSend("POST", endPoint, bytes.NewReader(bodyData), headerMap)
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	if resp.StatusCode == http.StatusCreated {
-		return nil
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.Header, newApiError(resp.StatusCode, respData)
 	}
-	respData, err := io.ReadAll(resp.Body)
-	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusUnprocessableEntity {
-		return errors.New("You may already have repository trying to create." + string(respData))
-	} else if resp.StatusCode == http.StatusUnauthorized {
-		return errors.New("You have to check your authorization info like token, token scope, repository name, owner name." + string(respData))
-	} else {
-		return errors.New(string(respData))
+	repoResponse := &RepoResponse{}
+	err = json.Unmarshal(respData, repoResponse)
+	if err != nil {
+		return nil, nil, err
 	}
+	return repoResponse, resp.Header, nil
+}
+
+// 認証ユーザのプライベートリポジトリをREADME付きで作成する。
+func (git *GitClient) CreatePrivateRepo() error {
+	repoData := &CreateRepoData{
+		Name:      git.Repository,
+		Private:   true,
+		Auto_init: true,
+	}
+	_, err := git.CreateRepo("", repoData)
+	return err
 }
 
 func (git *GitClient) DeletePrivateRepo() error {
-	endPoint := fmt.Sprintf("https://api.github.com/repos/%s/%s", git.Owner, git.Repository)
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = "Bearer " + git.Token
-	resp, err := requestSend("DELETE", endPoint, nil, headerMap)
+	endPoint := fmt.Sprintf("%s/repos/%s/%s", git.baseUrl(), git.Owner, git.Repository)
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return err
+	}
+	resp, err := git.requestSend("DELETE", endPoint, nil, headerMap)
 	if err != nil {
 		return err
 	}
@@ -288,19 +435,21 @@ func (git *GitClient) DeletePrivateRepo() error {
 	if resp.StatusCode == http.StatusNotFound {
 		return errors.New("Cannot delete: the repository does not exist." + string(respData))
 	} else {
-		return errors.New(string(respData))
+		return newApiError(resp.StatusCode, respData)
 	}
 }
 
 func (git *GitClient) CreateBlob(blob *BlobData) (*CreateBlobResponse, error) {
-	endPoint := fmt.Sprintf("https://api.github.com/repos/%s/%s/git/blobs", git.Owner, git.Repository)
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = "Bearer " + git.Token
+	endPoint := fmt.Sprintf("%s/repos/%s/%s/git/blobs", git.baseUrl(), git.Owner, git.Repository)
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
 	bodyData, err := json.Marshal(blob)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := requestSend("POST", endPoint, bytes.NewReader(bodyData), headerMap)
+	resp, err := git.requestSend("POST", endPoint, bodyData, headerMap)
 	if err != nil {
 		return nil, err
 	}
@@ -309,6 +458,9 @@ func (git *GitClient) CreateBlob(blob *BlobData) (*CreateBlobResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, newApiError(resp.StatusCode, respData)
+	}
 	blobResponse := &CreateBlobResponse{}
 	err = json.Unmarshal(respData, blobResponse)
 	if err != nil {
@@ -318,14 +470,16 @@ func (git *GitClient) CreateBlob(blob *BlobData) (*CreateBlobResponse, error) {
 }
 
 func (git *GitClient) CreateTree(tree *TreeData) (*CreateTreeResponse, error) {
-	endPoint := fmt.Sprintf("https://api.github.com/repos/%s/%s/git/trees", git.Owner, git.Repository)
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = "Bearer " + git.Token
+	endPoint := fmt.Sprintf("%s/repos/%s/%s/git/trees", git.baseUrl(), git.Owner, git.Repository)
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
 	bodyData, err := json.Marshal(tree)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := requestSend("POST", endPoint, bytes.NewReader(bodyData), headerMap)
+	resp, err := git.requestSend("POST", endPoint, bodyData, headerMap)
 	if err != nil {
 		return nil, err
 	}
@@ -335,7 +489,7 @@ func (git *GitClient) CreateTree(tree *TreeData) (*CreateTreeResponse, error) {
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusCreated {
-		return nil, errors.New(string(respData))
+		return nil, newApiError(resp.StatusCode, respData)
 	}
 	treeResponse := &CreateTreeResponse{}
 	err = json.Unmarshal(respData, treeResponse)
@@ -346,14 +500,16 @@ func (git *GitClient) CreateTree(tree *TreeData) (*CreateTreeResponse, error) {
 }
 
 func (git *GitClient) CreateCommit(commit *CommitData) (*CreateCommitResponse, error) {
-	endPoint := fmt.Sprintf("https://api.github.com/repos/%s/%s/git/commits", git.Owner, git.Repository)
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = "Bearer " + git.Token
+	endPoint := fmt.Sprintf("%s/repos/%s/%s/git/commits", git.baseUrl(), git.Owner, git.Repository)
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
 	bodyData, err := json.Marshal(commit)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := requestSend("POST", endPoint, bytes.NewReader(bodyData), headerMap)
+	resp, err := git.requestSend("POST", endPoint, bodyData, headerMap)
 	if err != nil {
 		return nil, err
 	}
@@ -363,7 +519,7 @@ func (git *GitClient) CreateCommit(commit *CommitData) (*CreateCommitResponse, e
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 201 {
-		return nil, errors.New(string(respData))
+		return nil, newApiError(resp.StatusCode, respData)
 	}
 	commitResponse := &CreateCommitResponse{}
 	err = json.Unmarshal(respData, commitResponse)
@@ -374,14 +530,16 @@ func (git *GitClient) CreateCommit(commit *CommitData) (*CreateCommitResponse, e
 }
 
 func (git *GitClient) CreateRef(refData *CreateRefData) (*UpdateRefResponse, error) {
-	endPoint := fmt.Sprintf("https://api.github.com/repos/%s/%s/git/refs", git.Owner, git.Repository)
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = "Bearer " + git.Token
+	endPoint := fmt.Sprintf("%s/repos/%s/%s/git/refs", git.baseUrl(), git.Owner, git.Repository)
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
 	bodyData, err := json.Marshal(refData)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := requestSend("POST", endPoint, bytes.NewReader(bodyData), headerMap)
+	resp, err := git.requestSend("POST", endPoint, bodyData, headerMap)
 	if err != nil {
 		return nil, err
 	}
@@ -391,7 +549,7 @@ func (git *GitClient) CreateRef(refData *CreateRefData) (*UpdateRefResponse, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusCreated {
-		return nil, errors.New(string(respData))
+		return nil, newApiError(resp.StatusCode, respData)
 	}
 	createRefResponse := &UpdateRefResponse{}
 	err = json.Unmarshal(respData, createRefResponse)
@@ -402,14 +560,16 @@ func (git *GitClient) CreateRef(refData *CreateRefData) (*UpdateRefResponse, err
 }
 
 func (git *GitClient) UpdateRef(refData *UpdRefData) (*UpdateRefResponse, error) {
-	endPoint := fmt.Sprintf("https://api.github.com/repos/%s/%s/git/refs/heads/%s", git.Owner, git.Repository, git.Branch)
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = "Bearer " + git.Token
+	endPoint := fmt.Sprintf("%s/repos/%s/%s/git/refs/heads/%s", git.baseUrl(), git.Owner, git.Repository, git.Branch)
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
 	bodyData, err := json.Marshal(refData)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := requestSend("PATCH", endPoint, bytes.NewReader(bodyData), headerMap)
+	resp, err := git.requestSend("PATCH", endPoint, bodyData, headerMap)
 	if err != nil {
 		return nil, err
 	}
@@ -419,7 +579,7 @@ func (git *GitClient) UpdateRef(refData *UpdRefData) (*UpdateRefResponse, error)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return nil, errors.New(string(respData))
+		return nil, newApiError(resp.StatusCode, respData)
 	}
 	updRefResponse := &UpdateRefResponse{}
 	err = json.Unmarshal(respData, updRefResponse)
@@ -430,10 +590,12 @@ func (git *GitClient) UpdateRef(refData *UpdRefData) (*UpdateRefResponse, error)
 }
 
 func (git *GitClient) GetCommit(commitId string) (*CommitResponse, error) {
-	endPoint := fmt.Sprintf("https://api.github.com/repos/%s/%s/git/commits/%s", git.Owner, git.Repository, commitId)
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = "Bearer " + git.Token
-	resp, err := requestSend("GET", endPoint, nil, headerMap)
+	endPoint := fmt.Sprintf("%s/repos/%s/%s/git/commits/%s", git.baseUrl(), git.Owner, git.Repository, commitId)
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := git.requestSend("GET", endPoint, nil, headerMap)
 	if err != nil {
 		return nil, err
 	}
@@ -450,12 +612,105 @@ func (git *GitClient) GetCommit(commitId string) (*CommitResponse, error) {
 	return cmtResponse, nil
 }
 
-// リポジトリが空の状態かを確認する(未テスト 使えるかわからない)
+// treeを取得する。recursiveがtrueの場合はサブディレクトリ配下の要素も全て取得する。
+func (git *GitClient) GetTree(treeSha string, recursive bool) (*GetTreeResponse, error) {
+	endPoint := fmt.Sprintf("%s/repos/%s/%s/git/trees/%s", git.baseUrl(), git.Owner, git.Repository, treeSha)
+	if recursive {
+		endPoint += "?recursive=1"
+	}
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := git.requestSend("GET", endPoint, nil, headerMap)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newApiError(resp.StatusCode, respData)
+	}
+	treeResponse := &GetTreeResponse{}
+	err = json.Unmarshal(respData, treeResponse)
+	if err != nil {
+		return nil, err
+	}
+	return treeResponse, nil
+}
+
+// blobを取得する。contentはbase64エンコードされた状態で返却される。
+func (git *GitClient) GetBlob(blobSha string) (*BlobResponse, error) {
+	endPoint := fmt.Sprintf("%s/repos/%s/%s/git/blobs/%s", git.baseUrl(), git.Owner, git.Repository, blobSha)
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := git.requestSend("GET", endPoint, nil, headerMap)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newApiError(resp.StatusCode, respData)
+	}
+	blobResponse := &BlobResponse{}
+	err = json.Unmarshal(respData, blobResponse)
+	if err != nil {
+		return nil, err
+	}
+	return blobResponse, nil
+}
+
+// リポジトリのブランチを全て取得する
+func (git *GitClient) ListBranches() ([]*BranchResponse, error) {
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
+	var branchList []*BranchResponse
+	for page := 1; ; page++ {
+		endPoint := fmt.Sprintf("%s/repos/%s/%s/branches?per_page=100&page=%d", git.baseUrl(), git.Owner, git.Repository, page)
+		resp, err := git.requestSend("GET", endPoint, nil, headerMap)
+		if err != nil {
+			return nil, err
+		}
+		respData, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, newApiError(resp.StatusCode, respData)
+		}
+		var pageList []*BranchResponse
+		err = json.Unmarshal(respData, &pageList)
+		if err != nil {
+			return nil, err
+		}
+		branchList = append(branchList, pageList...)
+		if len(pageList) < 100 {
+			break
+		}
+	}
+	return branchList, nil
+}
+
+// リポジトリが空の状態かを確認する。ブランチやリポジトリが存在しない場合はStatusCodeが404のApiErrorを返す。
 func (git *GitClient) IsEmptyRepository() (bool, error) {
-	endPoint := fmt.Sprintf("https://api.github.com/repos/%s/%s/git/ref/heads/%s", git.Owner, git.Repository, git.Branch)
-	headerMap := make(map[string]string)
-	headerMap["Authorization"] = "Bearer " + git.Token
-	resp, err := requestSend("GET", endPoint, nil, headerMap)
+	endPoint := fmt.Sprintf("%s/repos/%s/%s/git/ref/heads/%s", git.baseUrl(), git.Owner, git.Repository, git.Branch)
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return false, err
+	}
+	resp, err := git.requestSend("GET", endPoint, nil, headerMap)
 	if err != nil {
 		return false, err
 	}
@@ -469,23 +724,18 @@ func (git *GitClient) IsEmptyRepository() (bool, error) {
 	} else if resp.StatusCode == http.StatusOK {
 		return false, nil
 	} else {
-		return false, errors.New(string(respData))
+		return false, newApiError(resp.StatusCode, respData)
 	}
 }
 
 // httpリクエスト送信
-func requestSend(method string, endPoint string, body io.Reader, headerMap map[string]string) (*http.Response, error) {
-	req, err := http.NewRequest(method, endPoint, body) //reqeuest
-	if err != nil {
-		return nil, err
-	}
-	for key, value := range headerMap {
-		req.Header.Set(key, value) //header
-	}
-	client := &http.Client{}
-	resp, err := client.Do(req) //send http
-	if err != nil {
-		return nil, err
-	}
-	return resp, nil
+func (git *GitClient) requestSend(method string, endPoint string, body []byte, headerMap map[string]string) (*http.Response, error) {
+	r := &requester{
+		ctx:        git.Context,
+		httpClient: git.HttpClient,
+		hooks:      git.Hooks,
+		maxRetries: git.MaxRetries,
+		retryWait:  git.RetryWait,
+	}
+	return r.send(method, endPoint, body, headerMap)
 }
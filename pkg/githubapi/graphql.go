@@ -0,0 +1,191 @@
+package githubapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GraphQL APIがerrorsを返した場合のエラー1件
+type GraphqlError struct {
+	Type    string   `json:"type"`
+	Message string   `json:"message"`
+	Path    []string `json:"path"`
+}
+
+// GraphQL APIがerrorsを返した場合のエラー。HTTPのステータスコードは200になる。
+type GraphqlErrors []*GraphqlError
+
+func (errs GraphqlErrors) Error() string {
+	var messages []string
+	for _, e := range errs {
+		messages = append(messages, e.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// 指定したtypeのエラーを含むかを返す
+func (errs GraphqlErrors) HasType(errType string) bool {
+	for _, e := range errs {
+		if e.Type == errType {
+			return true
+		}
+	}
+	return false
+}
+
+// createCommitOnBranch mutationのinput
+type CreateCommitOnBranchInput struct {
+	Branch struct {
+		RepositoryNameWithOwner string `json:"repositoryNameWithOwner"`
+		BranchName              string `json:"branchName"`
+	} `json:"branch"`
+	Message struct {
+		Headline string `json:"headline"`
+		Body     string `json:"body,omitempty"`
+	} `json:"message"`
+	ExpectedHeadOid string `json:"expectedHeadOid"`
+	FileChanges     struct {
+		Additions []*FileAddition `json:"additions,omitempty"`
+		Deletions []*FileDeletion `json:"deletions,omitempty"`
+	} `json:"fileChanges"`
+}
+
+// createCommitOnBranchで追加・更新するファイル。Contentsはbase64
+type FileAddition struct {
+	Path     string `json:"path"`
+	Contents string `json:"contents"`
+}
+
+// createCommitOnBranchで削除するファイル
+type FileDeletion struct {
+	Path string `json:"path"`
+}
+
+const createCommitOnBranchQuery = `mutation($input: CreateCommitOnBranchInput!) {
+  createCommitOnBranch(input: $input) {
+    commit {
+      oid
+      url
+      message
+      tree { oid }
+      author { name email date }
+      committer { name email date }
+      parents(first: 100) { nodes { oid url } }
+    }
+  }
+}`
+
+// GraphQL APIのURLを返す。GitHub Enterprise Serverの場合は/api/v3を/api/graphqlに置き換える
+func (git *GitClient) graphqlUrl() string {
+	if git.GraphqlUrl != "" {
+		return git.GraphqlUrl
+	}
+	baseUrl := git.baseUrl()
+	if strings.HasSuffix(baseUrl, "/api/v3") {
+		return strings.TrimSuffix(baseUrl, "/api/v3") + "/api/graphql"
+	}
+	return baseUrl + "/graphql"
+}
+
+// GraphQL APIを呼び出し、dataをresultに読み込む。errorsを返した場合はGraphqlErrorsを返す。
+func (git *GitClient) Graphql(query string, variables map[string]any, result any) error {
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return err
+	}
+	bodyData, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	resp, err := git.requestSend("POST", git.graphqlUrl(), bodyData, headerMap)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newApiError(resp.StatusCode, respData)
+	}
+	var graphqlResp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors GraphqlErrors   `json:"errors"`
+	}
+	if err := json.Unmarshal(respData, &graphqlResp); err != nil {
+		return err
+	}
+	if len(graphqlResp.Errors) > 0 {
+		return graphqlResp.Errors
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(graphqlResp.Data, result)
+}
+
+// createCommitOnBranch mutationでコミットを作成し、ブランチを更新する。
+// 結果はREST APIと同じCreateCommitResponseに変換して返す。
+func (git *GitClient) CreateCommitOnBranch(input *CreateCommitOnBranchInput) (*CreateCommitResponse, error) {
+	var data struct {
+		CreateCommitOnBranch struct {
+			Commit *struct {
+				Oid     string `json:"oid"`
+				Url     string `json:"url"`
+				Message string `json:"message"`
+				Tree    struct {
+					Oid string `json:"oid"`
+				} `json:"tree"`
+				Author    graphqlGitActor `json:"author"`
+				Committer graphqlGitActor `json:"committer"`
+				Parents   struct {
+					Nodes []struct {
+						Oid string `json:"oid"`
+						Url string `json:"url"`
+					} `json:"nodes"`
+				} `json:"parents"`
+			} `json:"commit"`
+		} `json:"createCommitOnBranch"`
+	}
+	if err := git.Graphql(createCommitOnBranchQuery, map[string]any{"input": input}, &data); err != nil {
+		return nil, err
+	}
+	commit := data.CreateCommitOnBranch.Commit
+	if commit == nil {
+		return nil, errors.New("createCommitOnBranch returned no commit.")
+	}
+	resp := &CreateCommitResponse{
+		Sha:      commit.Oid,
+		Url:      fmt.Sprintf("%s/repos/%s/%s/git/commits/%s", git.baseUrl(), git.Owner, git.Repository, commit.Oid),
+		Html_url: commit.Url,
+		Message:  commit.Message,
+	}
+	resp.Tree.Sha = commit.Tree.Oid
+	resp.Tree.Url = fmt.Sprintf("%s/repos/%s/%s/git/trees/%s", git.baseUrl(), git.Owner, git.Repository, commit.Tree.Oid)
+	resp.Author.Name, resp.Author.Email, resp.Author.Date = commit.Author.Name, commit.Author.Email, commit.Author.Date
+	resp.Commiter.Name, resp.Commiter.Email, resp.Commiter.Date = commit.Committer.Name, commit.Committer.Email, commit.Committer.Date
+	for _, parent := range commit.Parents.Nodes {
+		resp.Parents = append(resp.Parents, struct {
+			Sha      string `json:"sha"`
+			Url      string `json:"url"`
+			Html_url string `json:"html_url"`
+		}{
+			Sha:      parent.Oid,
+			Url:      fmt.Sprintf("%s/repos/%s/%s/git/commits/%s", git.baseUrl(), git.Owner, git.Repository, parent.Oid),
+			Html_url: parent.Url,
+		})
+	}
+	return resp, nil
+}
+
+// GraphQLのGitActor
+type graphqlGitActor struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Date  string `json:"date"`
+}
@@ -0,0 +1,161 @@
+package githubapi
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// APIリクエストの開始と終了を通知するインターフェース。GitClient.Hooksに指定する。
+// RequestStartが返したcontextは次のHookのRequestStartと送信するhttp.Request、同じリクエストのRequestEndに渡される。
+type Hook interface {
+	RequestStart(ctx context.Context, info *RequestInfo) context.Context
+	RequestEnd(ctx context.Context, info *RequestInfo, result *RequestResult)
+}
+
+// リクエストの内容
+type RequestInfo struct {
+	Method       string
+	Endpoint     string
+	RequestBytes int
+}
+
+// リクエストの結果。再試行した場合は最後のレスポンスの値になる。
+type RequestResult struct {
+	StatusCode    int //通信エラーの場合は0
+	Duration      time.Duration
+	ResponseBytes int
+	Retries       int
+	Err           error //通信エラー。APIのエラーレスポンスは含まない
+}
+
+// リクエストが失敗したか(通信エラー、またはステータスコードが400以上)を返す
+func (result *RequestResult) Failed() bool {
+	return result.Err != nil || result.StatusCode >= 400
+}
+
+// log/slogでリクエストの結果を出力するHook
+type SlogHook struct {
+	Logger *slog.Logger //nilの場合はslog.Default()
+	Level  slog.Level   //成功したリクエストのログレベル。失敗したリクエストはWarnで出力する
+}
+
+func (hook *SlogHook) RequestStart(ctx context.Context, info *RequestInfo) context.Context {
+	return ctx
+}
+
+func (hook *SlogHook) RequestEnd(ctx context.Context, info *RequestInfo, result *RequestResult) {
+	logger := hook.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level := hook.Level
+	if result.Failed() && level < slog.LevelWarn {
+		level = slog.LevelWarn
+	}
+	attrs := []slog.Attr{
+		slog.String("method", info.Method),
+		slog.String("endpoint", info.Endpoint),
+		slog.Int("status", result.StatusCode),
+		slog.Duration("duration", result.Duration),
+		slog.Int("request_bytes", info.RequestBytes),
+		slog.Int("response_bytes", result.ResponseBytes),
+		slog.Int("retries", result.Retries),
+	}
+	if result.Err != nil {
+		attrs = append(attrs, slog.String("error", result.Err.Error()))
+	}
+	logger.LogAttrs(ctx, level, "github api request", attrs...)
+}
+
+// リクエスト数や転送量を集計するHook
+type StatsHook struct {
+	mu    sync.Mutex
+	stats RequestStats
+}
+
+// StatsHookの集計結果
+type RequestStats struct {
+	Requests      int
+	Failures      int
+	Retries       int
+	RequestBytes  int
+	ResponseBytes int
+	Duration      time.Duration
+	ByMethod      map[string]int
+}
+
+func (hook *StatsHook) RequestStart(ctx context.Context, info *RequestInfo) context.Context {
+	return ctx
+}
+
+func (hook *StatsHook) RequestEnd(ctx context.Context, info *RequestInfo, result *RequestResult) {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	hook.stats.Requests++
+	if result.Failed() {
+		hook.stats.Failures++
+	}
+	hook.stats.Retries += result.Retries
+	hook.stats.RequestBytes += info.RequestBytes
+	hook.stats.ResponseBytes += result.ResponseBytes
+	hook.stats.Duration += result.Duration
+	if hook.stats.ByMethod == nil {
+		hook.stats.ByMethod = make(map[string]int)
+	}
+	hook.stats.ByMethod[info.Method]++
+}
+
+// 現在までの集計結果を返す
+func (hook *StatsHook) Stats() RequestStats {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	stats := hook.stats
+	stats.ByMethod = make(map[string]int)
+	for method, count := range hook.stats.ByMethod {
+		stats.ByMethod[method] = count
+	}
+	return stats
+}
+
+// TracingHookが使うトレーサー。OpenTelemetryのtrace.Tracerを薄くラップして使うことを想定している。
+type Tracer interface {
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// Tracerが作成するスパン
+type Span interface {
+	SetAttribute(key string, value any)
+	RecordError(err error)
+	End()
+}
+
+// リクエストごとにスパンを作成するHook
+type TracingHook struct {
+	Tracer Tracer
+}
+
+type spanKey struct{}
+
+func (hook *TracingHook) RequestStart(ctx context.Context, info *RequestInfo) context.Context {
+	ctx, span := hook.Tracer.Start(ctx, "GitHub API "+info.Method)
+	span.SetAttribute("http.request.method", info.Method)
+	span.SetAttribute("url.full", info.Endpoint)
+	span.SetAttribute("http.request.body.size", info.RequestBytes)
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func (hook *TracingHook) RequestEnd(ctx context.Context, info *RequestInfo, result *RequestResult) {
+	span, ok := ctx.Value(spanKey{}).(Span)
+	if !ok {
+		return
+	}
+	span.SetAttribute("http.response.status_code", result.StatusCode)
+	span.SetAttribute("http.response.body.size", result.ResponseBytes)
+	span.SetAttribute("http.request.resend_count", result.Retries)
+	if result.Err != nil {
+		span.RecordError(result.Err)
+	}
+	span.End()
+}
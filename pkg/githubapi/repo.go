@@ -0,0 +1,135 @@
+package githubapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// CreateRepo APIのbodyに指定する構造体
+type CreateRepoData struct {
+	Name               string `json:"name"`
+	Description        string `json:"description,omitempty"`
+	Homepage           string `json:"homepage,omitempty"`
+	Private            bool   `json:"private"`
+	Visibility         string `json:"visibility,omitempty"` //public, private, internal(organizationのみ)
+	Auto_init          bool   `json:"auto_init"`
+	Gitignore_template string `json:"gitignore_template,omitempty"`
+	License_template   string `json:"license_template,omitempty"`
+	Has_issues         *bool  `json:"has_issues,omitempty"`
+	Has_projects       *bool  `json:"has_projects,omitempty"`
+	Has_wiki           *bool  `json:"has_wiki,omitempty"`
+	Is_template        bool   `json:"is_template,omitempty"`
+}
+
+// テンプレートからリポジトリを作成するAPIのbodyに指定する構造体
+type CreateRepoFromTemplateData struct {
+	Owner                string `json:"owner,omitempty"`
+	Name                 string `json:"name"`
+	Description          string `json:"description,omitempty"`
+	Include_all_branches bool   `json:"include_all_branches"`
+	Private              bool   `json:"private"`
+}
+
+// UpdateRepo APIのbodyに指定する構造体。nilの項目は変更しない。
+type UpdateRepoData struct {
+	Name                   *string `json:"name,omitempty"`
+	Description            *string `json:"description,omitempty"`
+	Homepage               *string `json:"homepage,omitempty"`
+	Private                *bool   `json:"private,omitempty"`
+	Visibility             *string `json:"visibility,omitempty"`
+	Default_branch         *string `json:"default_branch,omitempty"`
+	Has_issues             *bool   `json:"has_issues,omitempty"`
+	Has_projects           *bool   `json:"has_projects,omitempty"`
+	Has_wiki               *bool   `json:"has_wiki,omitempty"`
+	Is_template            *bool   `json:"is_template,omitempty"`
+	Allow_squash_merge     *bool   `json:"allow_squash_merge,omitempty"`
+	Allow_merge_commit     *bool   `json:"allow_merge_commit,omitempty"`
+	Allow_rebase_merge     *bool   `json:"allow_rebase_merge,omitempty"`
+	Delete_branch_on_merge *bool   `json:"delete_branch_on_merge,omitempty"`
+	Archived               *bool   `json:"archived,omitempty"`
+}
+
+// リポジトリを作成する。orgを指定した場合はorganizationのリポジトリ、空の場合は認証ユーザのリポジトリを作成する。
+func (git *GitClient) CreateRepo(org string, repoData *CreateRepoData) (*RepoResponse, error) {
+	endPoint := git.baseUrl() + "/user/repos"
+	if org != "" {
+		endPoint = fmt.Sprintf("%s/orgs/%s/repos", git.baseUrl(), org)
+	}
+	return git.postRepo(endPoint, repoData)
+}
+
+// テンプレートリポジトリから新しいリポジトリを作成する。
+func (git *GitClient) CreateRepoFromTemplate(templateOwner string, templateRepo string, repoData *CreateRepoFromTemplateData) (*RepoResponse, error) {
+	endPoint := fmt.Sprintf("%s/repos/%s/%s/generate", git.baseUrl(), templateOwner, templateRepo)
+	return git.postRepo(endPoint, repoData)
+}
+
+func (git *GitClient) postRepo(endPoint string, repoData any) (*RepoResponse, error) {
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
+	bodyData, err := json.Marshal(repoData)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := git.requestSend("POST", endPoint, bodyData, headerMap)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		return nil, fmt.Errorf("You may already have repository trying to create. %w", newApiError(resp.StatusCode, respData))
+	} else if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("You have to check your authorization info like token, token scope, repository name, owner name. %w", newApiError(resp.StatusCode, respData))
+	} else if resp.StatusCode != http.StatusCreated {
+		return nil, newApiError(resp.StatusCode, respData)
+	}
+	repoResponse := &RepoResponse{}
+	err = json.Unmarshal(respData, repoResponse)
+	if err != nil {
+		return nil, err
+	}
+	return repoResponse, nil
+}
+
+// リポジトリの設定を変更する。
+func (git *GitClient) UpdateRepo(repoData *UpdateRepoData) (*RepoResponse, error) {
+	if repoData == nil {
+		return nil, errors.New("repoData is nil.")
+	}
+	endPoint := fmt.Sprintf("%s/repos/%s/%s", git.baseUrl(), git.Owner, git.Repository)
+	headerMap, err := git.makeHeader()
+	if err != nil {
+		return nil, err
+	}
+	bodyData, err := json.Marshal(repoData)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := git.requestSend("PATCH", endPoint, bodyData, headerMap)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newApiError(resp.StatusCode, respData)
+	}
+	repoResponse := &RepoResponse{}
+	err = json.Unmarshal(respData, repoResponse)
+	if err != nil {
+		return nil, err
+	}
+	return repoResponse, nil
+}
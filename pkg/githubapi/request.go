@@ -0,0 +1,160 @@
+package githubapi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// リクエストの送信設定
+type requester struct {
+	ctx        context.Context
+	httpClient *http.Client
+	hooks      []Hook
+	maxRetries int
+	retryWait  time.Duration
+}
+
+// リクエストを送信する。レスポンスボディは読み込み済みで、呼び出し側で再度読み込める。
+// 一時的なエラーの場合はmaxRetriesまで再試行し、Hookには再試行を含めて1回のリクエストとして通知する。
+// 通信エラーと502、503、504はサーバーで処理された可能性があるため、GETとHEADのみ再試行する。
+func (r *requester) send(method string, endPoint string, body []byte, headerMap map[string]string) (*http.Response, error) {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	httpClient := r.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	info := &RequestInfo{
+		Method:       method,
+		Endpoint:     endPoint,
+		RequestBytes: len(body),
+	}
+	//Hookが返したcontextを次のHookとリクエストに引き継ぐ
+	hookCtxList := make([]context.Context, len(r.hooks))
+	for i, hook := range r.hooks {
+		if hookCtx := hook.RequestStart(ctx, info); hookCtx != nil {
+			ctx = hookCtx
+		}
+		hookCtxList[i] = ctx
+	}
+
+	start := time.Now()
+	result := &RequestResult{}
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		resp, err = r.sendOnce(ctx, httpClient, method, endPoint, body, headerMap)
+		wait, retryable := r.shouldRetry(ctx, method, attempt, resp, err)
+		if !retryable || attempt >= r.maxRetries {
+			break
+		}
+		result.Retries++
+		if err = sleepContext(ctx, wait); err != nil {
+			resp = nil
+			break
+		}
+	}
+	if resp != nil {
+		result.StatusCode = resp.StatusCode
+		result.ResponseBytes = int(resp.ContentLength)
+	}
+	result.Duration = time.Since(start)
+	result.Err = err
+	for i, hook := range r.hooks {
+		hook.RequestEnd(hookCtxList[i], info, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// 1回分のリクエストを送信し、レスポンスボディを読み込む
+func (r *requester) sendOnce(ctx context.Context, httpClient *http.Client, method string, endPoint string, body []byte, headerMap map[string]string) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endPoint, bodyReader) //reqeuest
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headerMap {
+		req.Header.Set(key, value) //header
+	}
+	resp, err := httpClient.Do(req) //send http
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respData))
+	resp.ContentLength = int64(len(respData))
+	return resp, nil
+}
+
+// 再試行するかと、再試行までの待ち時間を返す。
+// 429とsecondary rate limitはリクエストが処理されていないため、メソッドによらず再試行する。
+func (r *requester) shouldRetry(ctx context.Context, method string, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	idempotent := method == http.MethodGet || method == http.MethodHead
+	if err != nil {
+		if ctx.Err() != nil || !idempotent {
+			return 0, false
+		}
+		return r.backoff(attempt), true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		if !idempotent {
+			return 0, false
+		}
+	case http.StatusTooManyRequests:
+	case http.StatusForbidden:
+		//secondary rate limitの場合のみ再試行する
+		if resp.Header.Get("Retry-After") == "" && !isSecondaryRateLimit(resp) {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	return r.backoff(attempt), true
+}
+
+func (r *requester) backoff(attempt int) time.Duration {
+	wait := r.retryWait
+	if wait == 0 {
+		wait = time.Second
+	}
+	return wait << attempt
+}
+
+// 指定時間待つ。contextがキャンセルされた場合はそのエラーを返す
+func sleepContext(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func isSecondaryRateLimit(resp *http.Response) bool {
+	data, err := io.ReadAll(resp.Body)
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return err == nil && strings.Contains(strings.ToLower(string(data)), "secondary rate limit")
+}
@@ -0,0 +1,214 @@
+package githubapi
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIの認証に使うトークンを取得するためのインターフェース。GitClient.TokenSourceに指定する。
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// APIの認証に使うトークンを返す。TokenSourceが指定されている場合はTokenより優先する。
+func (git *GitClient) GetToken() (string, error) {
+	if git.TokenSource == nil {
+		return git.Token, nil
+	}
+	token, err := git.TokenSource.Token()
+	if err != nil {
+		return "", fmt.Errorf("error occured when get token. %w", err)
+	}
+	return token, nil
+}
+
+// 認証ヘッダを作成する。
+func (git *GitClient) makeHeader() (map[string]string, error) {
+	token, err := git.GetToken()
+	if err != nil {
+		return nil, err
+	}
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = "Bearer " + token
+	return headerMap, nil
+}
+
+// 固定のトークンを返すTokenSource
+type StaticTokenSource string
+
+func (token StaticTokenSource) Token() (string, error) {
+	return string(token), nil
+}
+
+// 環境変数からトークンを読み込むTokenSource。呼び出しのたびに読み込む。
+type EnvTokenSource string
+
+func (name EnvTokenSource) Token() (string, error) {
+	token := os.Getenv(string(name))
+	if token == "" {
+		return "", fmt.Errorf("environment variable %s is empty.", string(name))
+	}
+	return token, nil
+}
+
+// ファイルからトークンを読み込むTokenSource。トークンの更新に追従するため呼び出しのたびに読み込む。
+type FileTokenSource string
+
+func (path FileTokenSource) Token() (string, error) {
+	data, err := os.ReadFile(string(path))
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty.", string(path))
+	}
+	return token, nil
+}
+
+// GitHub Appのinstallation access tokenを取得するTokenSource。
+// 秘密鍵で署名したJWTでトークンを発行し、有効期限が近づいたら再発行する。
+type AppTokenSource struct {
+	AppId          string
+	InstallationId int64
+	PrivateKey     *rsa.PrivateKey
+	RefreshBefore  time.Duration //有効期限のどれだけ前に再発行するか。0の場合は5分
+	BaseUrl        string        //APIのURL。空の場合はhttps://api.github.com
+	HttpClient     *http.Client  //nilの場合はhttp.DefaultClient
+
+	mu          sync.Mutex
+	token       string
+	expiresAt   time.Time
+	permissions map[string]string
+}
+
+// installation access token APIの結果を受け取る構造体
+type InstallationTokenResponse struct {
+	Token       string            `json:"token"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+	Permissions map[string]string `json:"permissions"`
+}
+
+// PEM形式の秘密鍵を指定してAppTokenSourceを作成する。
+func NewAppTokenSource(appId string, installationId int64, privateKeyPEM []byte) (*AppTokenSource, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.New("invalid private key. PEM data not found.")
+	}
+	var privateKey *rsa.PrivateKey
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		privateKey = key
+	} else {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key. %w", err)
+		}
+		key, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("invalid private key. RSA key is required.")
+		}
+		privateKey = key
+	}
+	source := &AppTokenSource{
+		AppId:          appId,
+		InstallationId: installationId,
+		PrivateKey:     privateKey,
+	}
+	return source, nil
+}
+
+func (source *AppTokenSource) Token() (string, error) {
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	refreshBefore := source.RefreshBefore
+	if refreshBefore == 0 {
+		refreshBefore = 5 * time.Minute
+	}
+	if source.token != "" && time.Now().Add(refreshBefore).Before(source.expiresAt) {
+		return source.token, nil
+	}
+	tokenResp, err := source.createInstallationToken()
+	if err != nil {
+		return "", err
+	}
+	source.token = tokenResp.Token
+	source.expiresAt = tokenResp.ExpiresAt
+	source.permissions = tokenResp.Permissions
+	return source.token, nil
+}
+
+// 最後に発行したトークンに付与された権限(例: "contents": "write")を返す。未発行の場合はnil。
+func (source *AppTokenSource) Permissions() map[string]string {
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	return source.permissions
+}
+
+// App認証用のJWTを作成する。
+func (source *AppTokenSource) MakeJWT() (string, error) {
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-60 * time.Second).Unix(), //時刻のずれを考慮して過去にする
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": source.AppId,
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hashed := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, source.PrivateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// installation access tokenを発行する
+func (source *AppTokenSource) createInstallationToken() (*InstallationTokenResponse, error) {
+	jwt, err := source.MakeJWT()
+	if err != nil {
+		return nil, fmt.Errorf("error occured when make jwt. %w", err)
+	}
+	baseUrl := DefaultBaseUrl
+	if source.BaseUrl != "" {
+		baseUrl = strings.TrimSuffix(source.BaseUrl, "/")
+	}
+	endPoint := fmt.Sprintf("%s/app/installations/%d/access_tokens", baseUrl, source.InstallationId)
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = "Bearer " + jwt
+	headerMap["Accept"] = "application/vnd.github+json"
+	resp, err := (&requester{httpClient: source.HttpClient}).send("POST", endPoint, nil, headerMap)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, newApiError(resp.StatusCode, respData)
+	}
+	tokenResp := &InstallationTokenResponse{}
+	err = json.Unmarshal(respData, tokenResp)
+	if err != nil {
+		return nil, err
+	}
+	return tokenResp, nil
+}
@@ -0,0 +1,297 @@
+package gitlabapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type GitlabClient struct {
+	Token   string
+	Project string //プロジェクトのID、または"group/name"形式のパス
+	Branch  string
+	BaseUrl string //APIのURL。空の場合はhttps://gitlab.com/api/v4。セルフホストの場合はhttps://<host>/api/v4
+
+	Context    context.Context //リクエストに使うcontext。nilの場合はcontext.Background()
+	HttpClient *http.Client    //nilの場合はhttp.DefaultClient
+}
+
+// デフォルトのAPIのURL
+const DefaultBaseUrl = "https://gitlab.com/api/v4"
+
+// 一覧取得APIの1ページの件数
+const perPage = 100
+
+// GetProject APIの結果を受け取る構造体
+type ProjectResponse struct {
+	Id                  int64  `json:"id"`
+	Name                string `json:"name"`
+	Path_with_namespace string `json:"path_with_namespace"`
+	Default_branch      string `json:"default_branch"`
+	Empty_repo          bool   `json:"empty_repo"`
+	Web_url             string `json:"web_url"`
+}
+
+// GetBranch APIの結果を受け取る構造体
+type BranchResponse struct {
+	Name      string         `json:"name"`
+	Commit    CommitResponse `json:"commit"`
+	Protected bool           `json:"protected"`
+	Default   bool           `json:"default"`
+}
+
+// コミットの情報を受け取る構造体
+type CommitResponse struct {
+	Id              string   `json:"id"`
+	Short_id        string   `json:"short_id"`
+	Title           string   `json:"title"`
+	Message         string   `json:"message"`
+	Author_name     string   `json:"author_name"`
+	Author_email    string   `json:"author_email"`
+	Authored_date   string   `json:"authored_date"`
+	Committer_name  string   `json:"committer_name"`
+	Committer_email string   `json:"committer_email"`
+	Committed_date  string   `json:"committed_date"`
+	Parent_ids      []string `json:"parent_ids"`
+	Web_url         string   `json:"web_url"`
+}
+
+// ListTree APIの結果の内、1要素を表現する構造体
+type TreeEntry struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"` //blob, tree, commit(サブモジュール)
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+}
+
+// GetBlob APIの結果を受け取る構造体
+type BlobResponse struct {
+	Sha      string `json:"sha"`
+	Size     int    `json:"size"`
+	Encoding string `json:"encoding"`
+	Content  string `json:"content"`
+}
+
+// CreateCommit APIのactionsに指定する構造体
+type CommitAction struct {
+	Action           string `json:"action"` //create, update, delete, move, chmod
+	File_path        string `json:"file_path"`
+	Previous_path    string `json:"previous_path,omitempty"`
+	Content          string `json:"content,omitempty"`
+	Encoding         string `json:"encoding,omitempty"` //text, base64
+	Last_commit_id   string `json:"last_commit_id,omitempty"`
+	Execute_filemode *bool  `json:"execute_filemode,omitempty"`
+}
+
+// CreateCommit APIのbodyに指定する構造体
+type CommitData struct {
+	Branch         string          `json:"branch"`
+	Commit_message string          `json:"commit_message"`
+	Start_branch   string          `json:"start_branch,omitempty"`
+	Start_sha      string          `json:"start_sha,omitempty"`
+	Actions        []*CommitAction `json:"actions"`
+	Author_email   string          `json:"author_email,omitempty"`
+	Author_name    string          `json:"author_name,omitempty"`
+	Force          bool            `json:"force,omitempty"`
+}
+
+// APIがエラーを返した場合のエラー。メッセージはレスポンスボディそのまま。
+type ApiError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ApiError) Error() string {
+	return e.Body
+}
+
+func newApiError(statusCode int, respData []byte) *ApiError {
+	return &ApiError{
+		StatusCode: statusCode,
+		Body:       string(respData),
+	}
+}
+
+// APIのURLを返す
+func (git *GitlabClient) baseUrl() string {
+	if git.BaseUrl == "" {
+		return DefaultBaseUrl
+	}
+	return strings.TrimSuffix(git.BaseUrl, "/")
+}
+
+// プロジェクトのAPIのURLを返す。パス形式のプロジェクトはエンコードする
+func (git *GitlabClient) projectUrl() string {
+	return fmt.Sprintf("%s/projects/%s", git.baseUrl(), url.PathEscape(git.Project))
+}
+
+// プロジェクトの情報を取得する。存在しない場合はStatusCodeが404のApiErrorを返す。
+func (git *GitlabClient) GetProject() (*ProjectResponse, error) {
+	projectResp := &ProjectResponse{}
+	if err := git.getJSON(git.projectUrl(), projectResp); err != nil {
+		return nil, err
+	}
+	return projectResp, nil
+}
+
+// ブランチの情報を取得する。存在しない場合はStatusCodeが404のApiErrorを返す。
+func (git *GitlabClient) GetBranch(branch string) (*BranchResponse, error) {
+	endPoint := fmt.Sprintf("%s/repository/branches/%s", git.projectUrl(), url.PathEscape(branch))
+	branchResp := &BranchResponse{}
+	if err := git.getJSON(endPoint, branchResp); err != nil {
+		return nil, err
+	}
+	return branchResp, nil
+}
+
+// ブランチの一覧を取得する。
+func (git *GitlabClient) ListBranches() ([]*BranchResponse, error) {
+	var branchList []*BranchResponse
+	err := git.getPages(git.projectUrl()+"/repository/branches", url.Values{}, func(data []byte) error {
+		var page []*BranchResponse
+		if err := json.Unmarshal(data, &page); err != nil {
+			return err
+		}
+		branchList = append(branchList, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return branchList, nil
+}
+
+// refのtreeの要素を取得する。recursiveの場合は配下のすべての要素を返す。
+func (git *GitlabClient) ListTree(ref string, path string, recursive bool) ([]*TreeEntry, error) {
+	query := url.Values{}
+	query.Set("ref", ref)
+	if path != "" {
+		query.Set("path", path)
+	}
+	if recursive {
+		query.Set("recursive", "true")
+	}
+	var entryList []*TreeEntry
+	err := git.getPages(git.projectUrl()+"/repository/tree", query, func(data []byte) error {
+		var page []*TreeEntry
+		if err := json.Unmarshal(data, &page); err != nil {
+			return err
+		}
+		entryList = append(entryList, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entryList, nil
+}
+
+// blobを取得する。
+func (git *GitlabClient) GetBlob(sha string) (*BlobResponse, error) {
+	blobResp := &BlobResponse{}
+	if err := git.getJSON(git.projectUrl()+"/repository/blobs/"+url.PathEscape(sha), blobResp); err != nil {
+		return nil, err
+	}
+	return blobResp, nil
+}
+
+// actionsで指定した変更のコミットを作成し、ブランチを更新する。
+func (git *GitlabClient) CreateCommit(commit *CommitData) (*CommitResponse, error) {
+	if commit.Branch == "" {
+		commit.Branch = git.Branch
+	}
+	bodyData, err := json.Marshal(commit)
+	if err != nil {
+		return nil, err
+	}
+	resp, respData, err := git.send("POST", git.projectUrl()+"/repository/commits", bodyData)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, newApiError(resp.StatusCode, respData)
+	}
+	commitResp := &CommitResponse{}
+	if err := json.Unmarshal(respData, commitResp); err != nil {
+		return nil, err
+	}
+	return commitResp, nil
+}
+
+// GETして200の場合にresultに読み込む
+func (git *GitlabClient) getJSON(endPoint string, result any) error {
+	resp, respData, err := git.send("GET", endPoint, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newApiError(resp.StatusCode, respData)
+	}
+	return json.Unmarshal(respData, result)
+}
+
+// 一覧取得APIをX-Next-Pageがなくなるまで呼び出す
+func (git *GitlabClient) getPages(endPoint string, query url.Values, fn func(data []byte) error) error {
+	query.Set("per_page", strconv.Itoa(perPage))
+	page := "1"
+	for page != "" {
+		query.Set("page", page)
+		resp, respData, err := git.send("GET", endPoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return newApiError(resp.StatusCode, respData)
+		}
+		if err := fn(respData); err != nil {
+			return err
+		}
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return nil
+}
+
+// リクエストを送信し、レスポンスボディを読み込んで返す
+func (git *GitlabClient) send(method string, endPoint string, body []byte) (*http.Response, []byte, error) {
+	if git.Token == "" {
+		return nil, nil, errors.New("token is empty.")
+	}
+	ctx := git.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	httpClient := git.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endPoint, bodyReader)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", git.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, respData, nil
+}
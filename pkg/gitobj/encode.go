@@ -0,0 +1,177 @@
+package gitobj
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// treeの1要素。ModeはGitHubのAPIと同じ6桁の形式(treeは040000)
+type TreeEntry struct {
+	Mode string
+	Name string
+	Sha  string
+}
+
+// モードからオブジェクトの種類を返す
+func (entry *TreeEntry) Type() string {
+	switch entry.Mode {
+	case "040000":
+		return TypeTree
+	case "160000":
+		return TypeCommit
+	default:
+		return TypeBlob
+	}
+}
+
+// gitの順序(treeは名前の末尾に/を付けて比較する)で並べたtreeの内容を返す
+func EncodeTree(entries []*TreeEntry) ([]byte, error) {
+	sorted := make([]*TreeEntry, len(entries))
+	copy(sorted, entries)
+	sortKey := func(entry *TreeEntry) string {
+		if entry.Mode == "040000" {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sortKey(sorted[i]) < sortKey(sorted[j]) })
+	var buf bytes.Buffer
+	for i, entry := range sorted {
+		if entry.Name == "" || strings.ContainsAny(entry.Name, "/\x00") || entry.Name == "." || entry.Name == ".." {
+			return nil, fmt.Errorf("invalid tree entry name %q.", entry.Name)
+		}
+		if i > 0 && sorted[i-1].Name == entry.Name {
+			return nil, fmt.Errorf("duplicate tree entry %q.", entry.Name)
+		}
+		raw, err := hex.DecodeString(entry.Sha)
+		if err != nil || len(raw) != 20 {
+			return nil, fmt.Errorf("invalid sha %q for %s.", entry.Sha, entry.Name)
+		}
+		buf.WriteString(strings.TrimPrefix(entry.Mode, "0"))
+		buf.WriteByte(' ')
+		buf.WriteString(entry.Name)
+		buf.WriteByte(0)
+		buf.Write(raw)
+	}
+	return buf.Bytes(), nil
+}
+
+// treeの内容を読み込む
+func DecodeTree(data []byte) ([]*TreeEntry, error) {
+	var entries []*TreeEntry
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if space < 0 || nul < space || len(data) < nul+21 {
+			return nil, errors.New("invalid tree object.")
+		}
+		mode := string(data[:space])
+		if len(mode) < 6 {
+			mode = strings.Repeat("0", 6-len(mode)) + mode
+		}
+		entries = append(entries, &TreeEntry{
+			Mode: mode,
+			Name: string(data[space+1 : nul]),
+			Sha:  hex.EncodeToString(data[nul+1 : nul+21]),
+		})
+		data = data[nul+21:]
+	}
+	return entries, nil
+}
+
+// コミットの作成者、コミッター
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// "Name <email> <unix time> <+hhmm>"の形式で返す
+func (sig *Signature) String() string {
+	return fmt.Sprintf("%s <%s> %d %s", sig.Name, sig.Email, sig.When.Unix(), sig.When.Format("-0700"))
+}
+
+// "Name <email> <unix time> <+hhmm>"を読み込む
+func ParseSignature(text string) (*Signature, error) {
+	open := strings.Index(text, "<")
+	end := strings.LastIndex(text, ">")
+	if open < 0 || end < open {
+		return nil, fmt.Errorf("invalid signature %q.", text)
+	}
+	sig := &Signature{Name: strings.TrimSpace(text[:open]), Email: text[open+1 : end]}
+	fields := strings.Fields(text[end+1:])
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("invalid signature %q.", text)
+	}
+	unix, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature %q. %w", text, err)
+	}
+	zone, err := time.Parse("-0700", fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature %q. %w", text, err)
+	}
+	sig.When = time.Unix(unix, 0).In(zone.Location())
+	return sig, nil
+}
+
+// commitの内容
+type Commit struct {
+	Tree      string
+	Parents   []string
+	Author    Signature
+	Committer Signature
+	Message   string
+}
+
+// commitの内容を返す
+func EncodeCommit(commit *Commit) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("tree " + commit.Tree + "\n")
+	for _, parent := range commit.Parents {
+		buf.WriteString("parent " + parent + "\n")
+	}
+	buf.WriteString("author " + commit.Author.String() + "\n")
+	buf.WriteString("committer " + commit.Committer.String() + "\n")
+	buf.WriteString("\n")
+	buf.WriteString(commit.Message)
+	return buf.Bytes()
+}
+
+// commitの内容を読み込む。tree、parent、author、committer以外のヘッダーは無視する
+func DecodeCommit(data []byte) (*Commit, error) {
+	header, message, found := strings.Cut(string(data), "\n\n")
+	if !found {
+		header, message = strings.TrimSuffix(string(data), "\n"), ""
+	}
+	commit := &Commit{Message: message}
+	for _, line := range strings.Split(header, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			commit.Tree = value
+		case "parent":
+			commit.Parents = append(commit.Parents, value)
+		case "author", "committer":
+			sig, err := ParseSignature(value)
+			if err != nil {
+				return nil, err
+			}
+			if key == "author" {
+				commit.Author = *sig
+			} else {
+				commit.Committer = *sig
+			}
+		}
+	}
+	if !validSha(commit.Tree) {
+		return nil, errors.New("invalid commit object. tree is missing.")
+	}
+	return commit, nil
+}
@@ -0,0 +1,212 @@
+package gitobj
+
+import (
+	"bufio"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// オブジェクトの種類
+const (
+	TypeBlob   = "blob"
+	TypeTree   = "tree"
+	TypeCommit = "commit"
+	TypeTag    = "tag"
+)
+
+// オブジェクトのshaを計算する
+func HashObject(objType string, data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", objType, len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (repo *Repository) loosePath(sha string) string {
+	return filepath.Join(repo.Path, "objects", sha[:2], sha[2:])
+}
+
+func validSha(sha string) bool {
+	if len(sha) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(sha)
+	return err == nil
+}
+
+// オブジェクトをloose objectとして書き込み、shaを返す。既に存在する場合は書き込まない
+func (repo *Repository) WriteObject(objType string, data []byte) (string, error) {
+	sha := HashObject(objType, data)
+	if repo.HasObject(sha) {
+		return sha, nil
+	}
+	dir := filepath.Join(repo.Path, "objects", sha[:2])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	//書き込み途中のファイルが見えないよう一時ファイルに書いてからrenameする
+	tmp, err := os.CreateTemp(dir, "tmp_obj_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	zw := zlib.NewWriter(tmp)
+	fmt.Fprintf(zw, "%s %d\x00", objType, len(data))
+	if _, err := zw.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), repo.loosePath(sha)); err != nil {
+		return "", err
+	}
+	return sha, nil
+}
+
+// オブジェクトが存在するかを返す
+func (repo *Repository) HasObject(sha string) bool {
+	if !validSha(sha) {
+		return false
+	}
+	if _, err := os.Stat(repo.loosePath(sha)); err == nil {
+		return true
+	}
+	_, _, err := repo.findPacked(sha)
+	return err == nil
+}
+
+// オブジェクトの種類と内容を読み込む。存在しない場合はErrNotFoundを返す
+func (repo *Repository) ReadObject(sha string) (string, []byte, error) {
+	if !validSha(sha) {
+		return "", nil, fmt.Errorf("invalid sha %q. %w", sha, ErrNotFound)
+	}
+	file, err := os.Open(repo.loosePath(sha))
+	if errors.Is(err, os.ErrNotExist) {
+		pack, offset, err := repo.findPacked(sha)
+		if err != nil {
+			return "", nil, err
+		}
+		return pack.readObject(offset)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+	zr, err := zlib.NewReader(file)
+	if err != nil {
+		return "", nil, fmt.Errorf("error occured when read object %s. %w", sha, err)
+	}
+	defer zr.Close()
+	br := bufio.NewReader(zr)
+	objType, size, err := readLooseHeader(br)
+	if err != nil {
+		return "", nil, fmt.Errorf("error occured when read object %s. %w", sha, err)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return "", nil, fmt.Errorf("error occured when read object %s. %w", sha, err)
+	}
+	return objType, data, nil
+}
+
+// オブジェクトの種類とサイズを返す。loose objectの場合はヘッダーだけを読み込む
+func (repo *Repository) ObjectInfo(sha string) (string, int, error) {
+	if !validSha(sha) {
+		return "", 0, fmt.Errorf("invalid sha %q. %w", sha, ErrNotFound)
+	}
+	file, err := os.Open(repo.loosePath(sha))
+	if errors.Is(err, os.ErrNotExist) {
+		pack, offset, err := repo.findPacked(sha)
+		if err != nil {
+			return "", 0, err
+		}
+		return pack.objectInfo(offset)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	zr, err := zlib.NewReader(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer zr.Close()
+	return readLooseHeader(bufio.NewReader(zr))
+}
+
+// "<type> <size>\0"を読み込む
+func readLooseHeader(br *bufio.Reader) (string, int, error) {
+	objType, err := br.ReadString(' ')
+	if err != nil {
+		return "", 0, err
+	}
+	sizeText, err := br.ReadString(0)
+	if err != nil {
+		return "", 0, err
+	}
+	size, err := strconv.Atoi(sizeText[:len(sizeText)-1])
+	if err != nil {
+		return "", 0, err
+	}
+	return objType[:len(objType)-1], size, nil
+}
+
+// 指定の種類のオブジェクトを読み込む
+func (repo *Repository) readTyped(sha string, want string) ([]byte, error) {
+	objType, data, err := repo.ReadObject(sha)
+	if err != nil {
+		return nil, err
+	}
+	if objType != want {
+		return nil, fmt.Errorf("%s is a %s, not a %s.", sha, objType, want)
+	}
+	return data, nil
+}
+
+// treeを読み込む
+func (repo *Repository) ReadTree(sha string) ([]*TreeEntry, error) {
+	data, err := repo.readTyped(sha, TypeTree)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeTree(data)
+}
+
+// commitを読み込む
+func (repo *Repository) ReadCommit(sha string) (*Commit, error) {
+	data, err := repo.readTyped(sha, TypeCommit)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeCommit(data)
+}
+
+// treeを書き込む
+func (repo *Repository) WriteTree(entries []*TreeEntry) (string, error) {
+	data, err := EncodeTree(entries)
+	if err != nil {
+		return "", err
+	}
+	return repo.WriteObject(TypeTree, data)
+}
+
+// commitを書き込む
+func (repo *Repository) WriteCommit(commit *Commit) (string, error) {
+	return repo.WriteObject(TypeCommit, EncodeCommit(commit))
+}
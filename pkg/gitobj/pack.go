@@ -0,0 +1,347 @@
+package gitobj
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// packファイルとそのindex(version 2)
+type packFile struct {
+	repo    *Repository
+	path    string
+	fanout  [256]uint32
+	shas    []byte //20バイトごとのsha
+	offsets []uint64
+}
+
+// packファイル内のオブジェクトの種類
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+var packTypeNames = map[int]string{packCommit: TypeCommit, packTree: TypeTree, packBlob: TypeBlob, packTag: TypeTag}
+
+// objects/packのindexを読み込む。reloadの場合はディレクトリが更新されていれば読み直す
+func (repo *Repository) loadPacks(reload bool) ([]*packFile, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	packDir := filepath.Join(repo.Path, "objects", "pack")
+	var modTime time.Time
+	if info, err := os.Stat(packDir); err == nil {
+		modTime = info.ModTime()
+	}
+	if repo.packs != nil && (!reload || modTime.Equal(repo.packModTime)) {
+		return repo.packs, nil
+	}
+	repo.packModTime = modTime
+	idxList, err := filepath.Glob(filepath.Join(packDir, "pack-*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	packs := []*packFile{}
+	for _, idxPath := range idxList {
+		pack, err := openPackIndex(repo, idxPath)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, pack)
+	}
+	repo.packs = packs
+	return packs, nil
+}
+
+// packファイルからオブジェクトを探す
+func (repo *Repository) findPacked(sha string) (*packFile, uint64, error) {
+	raw, err := hex.DecodeString(sha)
+	if err != nil {
+		return nil, 0, ErrNotFound
+	}
+	for _, reload := range []bool{false, true} {
+		packs, err := repo.loadPacks(reload)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, pack := range packs {
+			if offset, ok := pack.find(raw); ok {
+				return pack, offset, nil
+			}
+		}
+	}
+	return nil, 0, fmt.Errorf("%s: %w", sha, ErrNotFound)
+}
+
+func openPackIndex(repo *Repository, idxPath string) (*packFile, error) {
+	data, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte("\xfftOc")) || binary.BigEndian.Uint32(data[4:8]) != 2 {
+		return nil, fmt.Errorf("%s: unsupported pack index.", idxPath)
+	}
+	pack := &packFile{repo: repo, path: strings.TrimSuffix(idxPath, ".idx") + ".pack"}
+	for i := range pack.fanout {
+		pack.fanout[i] = binary.BigEndian.Uint32(data[8+i*4:])
+	}
+	count := int(pack.fanout[255])
+	shaStart := 8 + 256*4
+	offsetStart := shaStart + count*20 + count*4
+	largeStart := offsetStart + count*4
+	if len(data) < largeStart {
+		return nil, fmt.Errorf("%s: broken pack index.", idxPath)
+	}
+	pack.shas = data[shaStart : shaStart+count*20]
+	pack.offsets = make([]uint64, count)
+	for i := range pack.offsets {
+		offset := binary.BigEndian.Uint32(data[offsetStart+i*4:])
+		if offset&0x80000000 == 0 {
+			pack.offsets[i] = uint64(offset)
+			continue
+		}
+		//2GBを超える位置は8バイトの表を参照する
+		pos := largeStart + int(offset&0x7fffffff)*8
+		if len(data) < pos+8 {
+			return nil, fmt.Errorf("%s: broken pack index.", idxPath)
+		}
+		pack.offsets[i] = binary.BigEndian.Uint64(data[pos:])
+	}
+	return pack, nil
+}
+
+func (pack *packFile) find(raw []byte) (uint64, bool) {
+	start := 0
+	if raw[0] > 0 {
+		start = int(pack.fanout[raw[0]-1])
+	}
+	end := int(pack.fanout[raw[0]])
+	i := start + sort.Search(end-start, func(i int) bool {
+		return bytes.Compare(pack.shas[(start+i)*20:(start+i+1)*20], raw) >= 0
+	})
+	if i < end && bytes.Equal(pack.shas[i*20:(i+1)*20], raw) {
+		return pack.offsets[i], true
+	}
+	return 0, false
+}
+
+// offsetの位置のオブジェクトのヘッダー
+type packEntry struct {
+	typ        int
+	size       int
+	dataOffset int64  //圧縮されたデータの開始位置
+	baseOffset int64  //OFS_DELTAの元オブジェクトの位置
+	baseSha    string //REF_DELTAの元オブジェクト
+}
+
+func (pack *packFile) readEntry(file *os.File, offset uint64) (*packEntry, error) {
+	br := bufio.NewReader(io.NewSectionReader(file, int64(offset), 1<<62))
+	read := int64(0)
+	next := func() (byte, error) {
+		read++
+		return br.ReadByte()
+	}
+	c, err := next()
+	if err != nil {
+		return nil, err
+	}
+	entry := &packEntry{typ: int(c>>4) & 7, size: int(c & 0x0f)}
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = next(); err != nil {
+			return nil, err
+		}
+		entry.size |= int(c&0x7f) << shift
+	}
+	switch entry.typ {
+	case packOfsDelta:
+		if c, err = next(); err != nil {
+			return nil, err
+		}
+		distance := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = next(); err != nil {
+				return nil, err
+			}
+			distance = ((distance + 1) << 7) | int64(c&0x7f)
+		}
+		entry.baseOffset = int64(offset) - distance
+	case packRefDelta:
+		raw := make([]byte, 20)
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return nil, err
+		}
+		read += 20
+		entry.baseSha = hex.EncodeToString(raw)
+	}
+	entry.dataOffset = int64(offset) + read
+	return entry, nil
+}
+
+// zlibで圧縮されたデータをsizeバイト読み込む
+func (pack *packFile) inflate(file *os.File, entry *packEntry) ([]byte, error) {
+	zr, err := zlib.NewReader(bufio.NewReader(io.NewSectionReader(file, entry.dataOffset, 1<<62)))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	data := make([]byte, entry.size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (pack *packFile) readObject(offset uint64) (string, []byte, error) {
+	file, err := os.Open(pack.path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+	return pack.readAt(file, offset, 0)
+}
+
+// offsetの位置のオブジェクトを読み込み、deltaの場合は元のオブジェクトに適用する
+func (pack *packFile) readAt(file *os.File, offset uint64, depth int) (string, []byte, error) {
+	if depth > 1000 {
+		return "", nil, errors.New("delta chain is too deep.")
+	}
+	entry, err := pack.readEntry(file, offset)
+	if err != nil {
+		return "", nil, fmt.Errorf("error occured when read %s. %w", pack.path, err)
+	}
+	data, err := pack.inflate(file, entry)
+	if err != nil {
+		return "", nil, fmt.Errorf("error occured when read %s. %w", pack.path, err)
+	}
+	var baseType string
+	var base []byte
+	switch entry.typ {
+	case packOfsDelta:
+		baseType, base, err = pack.readAt(file, uint64(entry.baseOffset), depth+1)
+	case packRefDelta:
+		baseType, base, err = pack.repo.ReadObject(entry.baseSha)
+	default:
+		objType, ok := packTypeNames[entry.typ]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown object type %d in %s.", entry.typ, pack.path)
+		}
+		return objType, data, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	result, err := applyDelta(base, data)
+	if err != nil {
+		return "", nil, fmt.Errorf("error occured when apply delta in %s. %w", pack.path, err)
+	}
+	return baseType, result, nil
+}
+
+// オブジェクトの種類とサイズを返す
+func (pack *packFile) objectInfo(offset uint64) (string, int, error) {
+	file, err := os.Open(pack.path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	entry, err := pack.readEntry(file, offset)
+	if err != nil {
+		return "", 0, err
+	}
+	if objType, ok := packTypeNames[entry.typ]; ok {
+		return objType, entry.size, nil
+	}
+	//deltaは全体の種類を得るために元を辿る必要があるため、内容ごと読み込む
+	objType, data, err := pack.readAt(file, offset, 0)
+	if err != nil {
+		return "", 0, err
+	}
+	return objType, len(data), nil
+}
+
+// deltaを適用する
+func applyDelta(base []byte, delta []byte) ([]byte, error) {
+	readSize := func() (int, error) {
+		size, shift := 0, 0
+		for {
+			if len(delta) == 0 {
+				return 0, errors.New("truncated delta.")
+			}
+			c := delta[0]
+			delta = delta[1:]
+			size |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return size, nil
+			}
+		}
+	}
+	baseSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, errors.New("delta base size mismatch.")
+	}
+	resultSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, 0, resultSize)
+	for len(delta) > 0 {
+		cmd := delta[0]
+		delta = delta[1:]
+		switch {
+		case cmd&0x80 != 0:
+			//元のオブジェクトからコピーする
+			var offset, size int
+			for i := 0; i < 7; i++ {
+				if cmd&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errors.New("truncated delta.")
+				}
+				if i < 4 {
+					offset |= int(delta[0]) << (8 * i)
+				} else {
+					size |= int(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, errors.New("delta copy out of range.")
+			}
+			result = append(result, base[offset:offset+size]...)
+		case cmd != 0:
+			//deltaに含まれるデータを追加する
+			if int(cmd) > len(delta) {
+				return nil, errors.New("truncated delta.")
+			}
+			result = append(result, delta[:cmd]...)
+			delta = delta[cmd:]
+		default:
+			return nil, errors.New("invalid delta command.")
+		}
+	}
+	if len(result) != resultSize {
+		return nil, errors.New("delta result size mismatch.")
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package gitobj
+
+import (
+	"bufio"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// packファイルに書き込むオブジェクト
+type PackObject struct {
+	Type string //TypeBlob、TypeTree、TypeCommit、TypeTag
+	Data []byte
+}
+
+var packTypeCodes = map[string]int{TypeCommit: packCommit, TypeTree: packTree, TypeBlob: packBlob, TypeTag: packTag}
+
+// objectsをpackファイル(version 2)の形式でwに書き込む。deltaは使わない
+func WritePack(w io.Writer, objects []*PackObject) error {
+	hash := sha1.New()
+	bw := bufio.NewWriter(io.MultiWriter(w, hash))
+	header := make([]byte, 12)
+	copy(header, "PACK")
+	binary.BigEndian.PutUint32(header[4:], 2)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(objects)))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	zw := zlib.NewWriter(bw)
+	for _, object := range objects {
+		code, ok := packTypeCodes[object.Type]
+		if !ok {
+			return fmt.Errorf("unknown object type %s.", object.Type)
+		}
+		//種類とサイズ。サイズは下位4ビットから7ビットずつ続ける
+		size := len(object.Data)
+		c := byte(code<<4) | byte(size&0x0f)
+		size >>= 4
+		for size > 0 {
+			if err := bw.WriteByte(c | 0x80); err != nil {
+				return err
+			}
+			c = byte(size & 0x7f)
+			size >>= 7
+		}
+		if err := bw.WriteByte(c); err != nil {
+			return err
+		}
+		zw.Reset(bw)
+		if _, err := zw.Write(object.Data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	//末尾はそれまでの内容のSHA-1
+	_, err := w.Write(hash.Sum(nil))
+	return err
+}
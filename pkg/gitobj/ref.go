@@ -0,0 +1,191 @@
+package gitobj
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// refの更新時に、refが想定と異なる値に更新されていたことを表すエラー
+var ErrRefMoved = errors.New("ref was updated by another process.")
+
+// refを他のプロセスが更新中であることを表すエラー
+var ErrRefLocked = errors.New("ref is locked by another process.")
+
+func validRefName(name string) bool {
+	if !strings.HasPrefix(name, "refs/") || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".lock") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return !strings.ContainsAny(name, " ~^:?*[\\\x00") && !strings.Contains(name, "..") && !strings.Contains(name, "@{")
+}
+
+// refが指すshaを返す。シンボリックrefは辿る。存在しない場合は空を返す
+func (repo *Repository) ReadRef(name string) (string, error) {
+	for depth := 0; depth < 10; depth++ {
+		if name != "HEAD" && !validRefName(name) {
+			return "", fmt.Errorf("invalid ref name %q.", name)
+		}
+		data, err := os.ReadFile(filepath.Join(repo.Path, filepath.FromSlash(name)))
+		if errors.Is(err, os.ErrNotExist) {
+			packed, err := repo.packedRefs()
+			if err != nil {
+				return "", err
+			}
+			return packed[name], nil
+		}
+		if err != nil {
+			return "", err
+		}
+		value := strings.TrimSpace(string(data))
+		target, symbolic := strings.CutPrefix(value, "ref: ")
+		if !symbolic {
+			if !validSha(value) {
+				return "", fmt.Errorf("ref %s is broken.", name)
+			}
+			return value, nil
+		}
+		name = target
+	}
+	return "", errors.New("too many levels of symbolic refs.")
+}
+
+// HEADが指すブランチ名を返す
+func (repo *Repository) HeadBranch() (string, error) {
+	data, err := os.ReadFile(filepath.Join(repo.Path, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	target, symbolic := strings.CutPrefix(strings.TrimSpace(string(data)), "ref: refs/heads/")
+	if !symbolic {
+		return "", errors.New("HEAD is detached.")
+	}
+	return target, nil
+}
+
+// prefixで始まるrefの一覧を名前順で返す
+func (repo *Repository) ListRefs(prefix string) ([]string, map[string]string, error) {
+	refs, err := repo.packedRefs()
+	if err != nil {
+		return nil, nil, err
+	}
+	root := filepath.Join(repo.Path, "refs")
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return err
+		}
+		rel, err := filepath.Rel(repo.Path, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if value := strings.TrimSpace(string(data)); validSha(value) {
+			refs[name] = value
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+	var names []string
+	for name := range refs {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		} else {
+			delete(refs, name)
+		}
+	}
+	sort.Strings(names)
+	return names, refs, nil
+}
+
+// packed-refsの内容を返す
+func (repo *Repository) packedRefs() (map[string]string, error) {
+	refs := make(map[string]string)
+	file, err := os.Open(filepath.Join(repo.Path, "packed-refs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		//#はヘッダー、^はannotated tagの参照先
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+		sha, name, found := strings.Cut(line, " ")
+		if found && validSha(sha) {
+			refs[name] = sha
+		}
+	}
+	return refs, scanner.Err()
+}
+
+// refをnewShaに更新する。<ref>.lockでロックし、現在の値がoldShaと異なる場合はErrRefMovedを返す。
+// oldShaが空の場合はrefが存在しないことを前提にする。
+func (repo *Repository) UpdateRef(name string, newSha string, oldSha string) error {
+	if !validRefName(name) {
+		return fmt.Errorf("invalid ref name %q.", name)
+	}
+	if !validSha(newSha) {
+		return fmt.Errorf("invalid sha %q.", newSha)
+	}
+	refPath := filepath.Join(repo.Path, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(refPath), 0755); err != nil {
+		return err
+	}
+	lockPath := refPath + ".lock"
+	lock, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s. %w", lockPath, ErrRefLocked)
+	}
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			lock.Close()
+			os.Remove(lockPath)
+		}
+	}()
+
+	//ロックを取得してから現在の値を確認する
+	current, err := repo.ReadRef(name)
+	if err != nil {
+		return err
+	}
+	if current != oldSha {
+		return fmt.Errorf("%s is at %q, expected %q. %w", name, current, oldSha, ErrRefMoved)
+	}
+	if _, err := lock.WriteString(newSha + "\n"); err != nil {
+		return err
+	}
+	if err := lock.Sync(); err != nil {
+		return err
+	}
+	if err := lock.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(lockPath, refPath); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
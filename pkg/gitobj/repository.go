@@ -0,0 +1,62 @@
+package gitobj
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ローカルのbareリポジトリ。gitコマンドを使わずにオブジェクトとrefを直接読み書きする。
+// オブジェクトはSHA-1で、書き込みはloose objectとして行う。読み込みはpackファイルにも対応する。
+type Repository struct {
+	Path string //bareリポジトリのディレクトリ(HEAD、objects、refsを含む)
+
+	mu          sync.Mutex
+	packs       []*packFile //nilの場合は未読み込み
+	packModTime time.Time   //packsを読み込んだ時点のobjects/packの更新日時
+}
+
+// オブジェクトが存在しないことを表すエラー
+var ErrNotFound = errors.New("object not found.")
+
+// bareリポジトリを開く
+func Open(path string) (*Repository, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(absPath, name)); err != nil {
+			return nil, fmt.Errorf("%s is not a bare git repository. %w", path, err)
+		}
+	}
+	return &Repository{Path: absPath}, nil
+}
+
+// 空のbareリポジトリを作成する。HEADはdefaultBranchを指す。既にリポジトリがある場合はそれを開く
+func InitBare(path string, defaultBranch string) (*Repository, error) {
+	if defaultBranch == "" {
+		defaultBranch = "main"
+	}
+	if _, err := os.Stat(filepath.Join(path, "HEAD")); err == nil {
+		return Open(path)
+	}
+	for _, dir := range []string{"objects/info", "objects/pack", "refs/heads", "refs/tags"} {
+		if err := os.MkdirAll(filepath.Join(path, dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+	files := map[string]string{
+		"HEAD":   "ref: refs/heads/" + defaultBranch + "\n",
+		"config": "[core]\n\trepositoryformatversion = 0\n\tfilemode = true\n\tbare = true\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(path, name), []byte(content), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return Open(path)
+}
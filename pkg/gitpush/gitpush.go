@@ -0,0 +1,297 @@
+package gitpush
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	gitobj "github.com/daze-doragon/go-gituse/pkg/gitobj"
+)
+
+// git smart HTTPのreceive-packでpushするクライアント。
+// 認証はBasic認証で、ユーザー名が空の場合はGitHubのトークンと同じx-access-tokenを使う。
+type Remote struct {
+	Url         string      //リポジトリのURL。https://github.com/<owner>/<repository>.git
+	Username    string      //空の場合はx-access-token
+	Token       string      //Basic認証のパスワード
+	TokenSource TokenSource //指定した場合はTokenより優先する
+
+	Context    context.Context //リクエストに使うcontext。nilの場合はcontext.Background()
+	HttpClient *http.Client    //nilの場合はhttp.DefaultClient
+	Agent      string          //agent capabilityに送る名前。空の場合はgo-gituse
+}
+
+// 認証に使うトークンを返す
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// 存在しないrefの値
+const ZeroSha = "0000000000000000000000000000000000000000"
+
+// pushで更新するref。Oldが空の場合はrefを作成する
+type RefUpdate struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// receive-packが返したrefごとの結果
+type RefStatus struct {
+	Name   string
+	Ok     bool
+	Reason string //ngの場合の理由
+}
+
+// サーバーがrefの更新を拒否したことを表すエラー
+type RejectedError struct {
+	Statuses []*RefStatus
+}
+
+func (e *RejectedError) Error() string {
+	var messages []string
+	for _, status := range e.Statuses {
+		if !status.Ok {
+			messages = append(messages, status.Name+" "+status.Reason)
+		}
+	}
+	return "push was rejected. " + strings.Join(messages, ", ")
+}
+
+// サーバーがHTTPのエラーを返した場合のエラー。メッセージはレスポンスボディそのまま。
+type HttpError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HttpError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Body)
+}
+
+// receive-packのref一覧と対応している機能
+type Advertisement struct {
+	Refs         map[string]string
+	Capabilities map[string]string //値のない機能は空文字
+}
+
+func (remote *Remote) context() context.Context {
+	if remote.Context == nil {
+		return context.Background()
+	}
+	return remote.Context
+}
+
+func (remote *Remote) httpClient() *http.Client {
+	if remote.HttpClient == nil {
+		return http.DefaultClient
+	}
+	return remote.HttpClient
+}
+
+func (remote *Remote) newRequest(method string, endPoint string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(remote.context(), method, strings.TrimSuffix(remote.Url, "/")+endPoint, body)
+	if err != nil {
+		return nil, err
+	}
+	token := remote.Token
+	if remote.TokenSource != nil {
+		if token, err = remote.TokenSource.Token(); err != nil {
+			return nil, fmt.Errorf("error occured when get token. %w", err)
+		}
+	}
+	if token != "" {
+		username := remote.Username
+		if username == "" {
+			username = "x-access-token"
+		}
+		req.SetBasicAuth(username, token)
+	}
+	agent := remote.agent()
+	req.Header.Set("User-Agent", "git/2.0 ("+agent+")")
+	return req, nil
+}
+
+func (remote *Remote) agent() string {
+	if remote.Agent == "" {
+		return "go-gituse"
+	}
+	return remote.Agent
+}
+
+// receive-packのref一覧を取得する。空のリポジトリの場合はRefsが空になる
+func (remote *Remote) ListRefs() (*Advertisement, error) {
+	req, err := remote.newRequest("GET", "/info/refs?service=git-receive-pack", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := remote.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &HttpError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if resp.Header.Get("Content-Type") != "application/x-git-receive-pack-advertisement" {
+		return nil, errors.New("server does not support the smart HTTP protocol.")
+	}
+	reader := newPktReader(resp.Body)
+	//最初は"# service=git-receive-pack"とflush
+	line, err := reader.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(string(line), "\n") != "# service=git-receive-pack" {
+		return nil, fmt.Errorf("unexpected advertisement %q.", line)
+	}
+	if line, err = reader.readLine(); err != nil {
+		return nil, err
+	}
+	if line != nil {
+		return nil, errors.New("flush is expected after the service line.")
+	}
+	adv := &Advertisement{Refs: make(map[string]string), Capabilities: make(map[string]string)}
+	for first := true; ; first = false {
+		line, err := reader.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == nil {
+			return adv, nil
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if first {
+			//最初のrefの後ろにNULで区切って機能の一覧が付く
+			var capabilities string
+			text, capabilities, _ = strings.Cut(text, "\x00")
+			for _, capability := range strings.Fields(capabilities) {
+				key, value, _ := strings.Cut(capability, "=")
+				adv.Capabilities[key] = value
+			}
+		}
+		sha, name, found := strings.Cut(text, " ")
+		if !found || len(sha) != 40 {
+			return nil, fmt.Errorf("unexpected ref line %q.", text)
+		}
+		//空のリポジトリは機能の一覧だけを送るためにcapabilities^{}を使う
+		if name == "capabilities^{}" {
+			continue
+		}
+		adv.Refs[name] = sha
+	}
+}
+
+// packを送ってrefを更新する。advはListRefsの結果で、サーバーが対応している機能だけを使う。
+// packは全コマンド分のオブジェクトを含める。拒否されたrefがある場合はRejectedErrorを返す
+func (remote *Remote) Push(adv *Advertisement, updates []*RefUpdate, objects []*gitobj.PackObject) ([]*RefStatus, error) {
+	if len(updates) == 0 {
+		return nil, errors.New("no refs to update.")
+	}
+	if _, ok := adv.Capabilities["report-status"]; !ok {
+		return nil, errors.New("server does not support report-status.")
+	}
+	capabilities := []string{"report-status"}
+	_, sideBand := adv.Capabilities["side-band-64k"]
+	if sideBand {
+		capabilities = append(capabilities, "side-band-64k")
+	}
+	if _, ok := adv.Capabilities["agent"]; ok {
+		capabilities = append(capabilities, "agent="+remote.agent())
+	}
+
+	//packは大きくなるため、作りながら送る
+	bodyReader, bodyWriter := io.Pipe()
+	go func() {
+		bw := bufio.NewWriter(bodyWriter)
+		err := func() error {
+			for i, update := range updates {
+				old := update.Old
+				if old == "" {
+					old = ZeroSha
+				}
+				line := old + " " + update.New + " " + update.Name
+				if i == 0 {
+					line += "\x00" + strings.Join(capabilities, " ")
+				}
+				if err := writePktLine(bw, []byte(line+"\n")); err != nil {
+					return err
+				}
+			}
+			if err := writeFlush(bw); err != nil {
+				return err
+			}
+			if err := gitobj.WritePack(bw, objects); err != nil {
+				return err
+			}
+			return bw.Flush()
+		}()
+		bodyWriter.CloseWithError(err)
+	}()
+	req, err := remote.newRequest("POST", "/git-receive-pack", bodyReader)
+	if err != nil {
+		bodyReader.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-git-receive-pack-request")
+	req.Header.Set("Accept", "application/x-git-receive-pack-result")
+	resp, err := remote.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &HttpError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var result io.Reader = resp.Body
+	if sideBand {
+		result = &sideBandReader{pkt: newPktReader(resp.Body)}
+	}
+	statuses, err := readReportStatus(newPktReader(result))
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range statuses {
+		if !status.Ok {
+			return statuses, &RejectedError{Statuses: statuses}
+		}
+	}
+	return statuses, nil
+}
+
+// report-statusの結果を読み込む
+func readReportStatus(reader *pktReader) ([]*RefStatus, error) {
+	line, err := reader.readLine()
+	if err != nil {
+		return nil, fmt.Errorf("error occured when read the push result. %w", err)
+	}
+	unpack := strings.TrimSuffix(string(line), "\n")
+	if unpack != "unpack ok" {
+		return nil, fmt.Errorf("server failed to unpack. %s", strings.TrimPrefix(unpack, "unpack "))
+	}
+	var statuses []*RefStatus
+	for {
+		line, err := reader.readLine()
+		if err != nil {
+			return nil, fmt.Errorf("error occured when read the push result. %w", err)
+		}
+		if line == nil {
+			return statuses, nil
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if name, ok := strings.CutPrefix(text, "ok "); ok {
+			statuses = append(statuses, &RefStatus{Name: name, Ok: true})
+		} else if rest, ok := strings.CutPrefix(text, "ng "); ok {
+			name, reason, _ := strings.Cut(rest, " ")
+			statuses = append(statuses, &RefStatus{Name: name, Reason: reason})
+		} else {
+			return nil, fmt.Errorf("unexpected push result %q.", text)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package gitpush
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// pkt-lineの最大長(長さの4バイトを含む)
+const maxPktLen = 65520
+
+// pkt-lineを読み込む
+type pktReader struct {
+	r *bufio.Reader
+}
+
+func newPktReader(r io.Reader) *pktReader {
+	return &pktReader{r: bufio.NewReader(r)}
+}
+
+// 1行読み込む。flush(0000)の場合はnilを返す
+func (reader *pktReader) readLine() ([]byte, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(reader.r, head); err != nil {
+		return nil, err
+	}
+	length, err := strconv.ParseUint(string(head), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkt-line length %q.", head)
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	if length < 4 || length > maxPktLen {
+		return nil, fmt.Errorf("invalid pkt-line length %d.", length)
+	}
+	data := make([]byte, length-4)
+	if _, err := io.ReadFull(reader.r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func writePktLine(w io.Writer, data []byte) error {
+	if len(data)+4 > maxPktLen {
+		return errors.New("pkt-line is too long.")
+	}
+	if _, err := fmt.Fprintf(w, "%04x", len(data)+4); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func writeFlush(w io.Writer) error {
+	_, err := io.WriteString(w, "0000")
+	return err
+}
+
+// side-band-64kの応答から、1番のデータだけを読み込む。2番の進捗は捨て、3番はエラーにする
+type sideBandReader struct {
+	pkt *pktReader
+	buf []byte
+	eof bool
+}
+
+func (reader *sideBandReader) Read(p []byte) (int, error) {
+	for len(reader.buf) == 0 {
+		if reader.eof {
+			return 0, io.EOF
+		}
+		line, err := reader.pkt.readLine()
+		if err != nil {
+			return 0, err
+		}
+		if line == nil {
+			reader.eof = true
+			continue
+		}
+		if len(line) == 0 {
+			continue
+		}
+		switch line[0] {
+		case 1:
+			reader.buf = line[1:]
+		case 2:
+		case 3:
+			return 0, fmt.Errorf("remote error. %s", line[1:])
+		default:
+			return 0, fmt.Errorf("unknown side-band %d.", line[0])
+		}
+	}
+	n := copy(p, reader.buf)
+	reader.buf = reader.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// コミット元になるtreeをパス単位で参照するためのオブジェクト。取得したtreeはshaごとにキャッシュする。
+type baseTree struct {
+	git     Provider
+	rootSha string //空の場合は空のリポジトリとして扱う
+	trees   map[string][]*githubapi.TreeEntryElement
+}
+
+func newBaseTree(git Provider, rootSha string) *baseTree {
+	return &baseTree{
+		git:     git,
+		rootSha: rootSha,
+		trees:   make(map[string][]*githubapi.TreeEntryElement),
+	}
+}
+
+// 指定したshaのtree直下の要素を取得する
+func (base *baseTree) entries(treeSha string) ([]*githubapi.TreeEntryElement, error) {
+	if list, ok := base.trees[treeSha]; ok {
+		return list, nil
+	}
+	treeResp, err := base.git.GetTree(treeSha, false)
+	if err != nil {
+		return nil, fmt.Errorf("error occured when get tree %s. %w", treeSha, err)
+	}
+	base.trees[treeSha] = treeResp.Tree
+	return treeResp.Tree, nil
+}
+
+// リポジトリ内のパスに対応するtree要素を返す。存在しない場合はnilを返す。
+func (base *baseTree) lookup(repoPath string) (*githubapi.TreeEntryElement, error) {
+	repoPath = strings.Trim(repoPath, "/")
+	if base.rootSha == "" || repoPath == "" {
+		return nil, nil
+	}
+	treeSha := base.rootSha
+	segments := strings.Split(repoPath, "/")
+	for i, segment := range segments {
+		list, err := base.entries(treeSha)
+		if err != nil {
+			return nil, err
+		}
+		var found *githubapi.TreeEntryElement
+		for _, entry := range list {
+			if entry.Path == segment {
+				found = entry
+				break
+			}
+		}
+		if found == nil {
+			return nil, nil
+		}
+		if i == len(segments)-1 {
+			return found, nil
+		}
+		if found.Type != "tree" {
+			return nil, nil
+		}
+		treeSha = found.Sha
+	}
+	return nil, nil
+}
+
+// blobの内容を取得する
+func (base *baseTree) readBlob(blobSha string) ([]byte, error) {
+	blobResp, err := base.git.GetBlob(blobSha)
+	if err != nil {
+		return nil, fmt.Errorf("error occured when get blob %s. %w", blobSha, err)
+	}
+	if blobResp.Encoding != "base64" {
+		return []byte(blobResp.Content), nil
+	}
+	//GitHubはbase64を改行付きで返すので除去してからデコードする
+	return base64.StdEncoding.DecodeString(strings.ReplaceAll(blobResp.Content, "\n", ""))
+}
+
+// 指定したshaのtree配下の要素を再帰的に取得する。パスはtreeからの相対パス。
+func (base *baseTree) listRecursive(treeSha string) ([]*githubapi.TreeEntryElement, error) {
+	treeResp, err := base.git.GetTree(treeSha, true)
+	if err != nil {
+		return nil, fmt.Errorf("error occured when get tree %s. %w", treeSha, err)
+	}
+	if treeResp.Truncated {
+		return nil, fmt.Errorf("tree %s is too large to list recursively.", treeSha)
+	}
+	return treeResp.Tree, nil
+}
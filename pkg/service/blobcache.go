@@ -0,0 +1,222 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BlobCacheの件数の上限を指定しない場合の既定値
+const DefaultBlobCacheEntries = 100000
+
+// 更新直後のファイルは同じ更新時刻のまま再度書き換えられる可能性があるため、この時間が経過するまでキャッシュしない
+const blobCacheRacyWindow = 2 * time.Second
+
+// ローカルファイルのblobのshaを、パス・サイズ・更新時刻をキーに保存するキャッシュ。GitInfo.SetBlobCacheで指定する。
+// サイズと更新時刻が前回と同じファイルは読み込まずにキャッシュのshaを使い、変更がなければアップロードもしない。
+// 内容はSaveを呼んだ時点でファイルに書き込む。
+type BlobCache struct {
+	mu         sync.Mutex
+	path       string
+	maxEntries int
+	entries    map[string]*blobCacheEntry
+	dirty      bool
+}
+
+// キャッシュの1件。キーはローカルファイルの絶対パス
+type blobCacheEntry struct {
+	Sha     string `json:"sha"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` //UnixNano
+	Used    int64  `json:"used"`  //最後に使用した時刻(UnixNano)。件数の上限を超えた場合に古いものから削除する
+
+	Eol      string `json:"eol,omitempty"`       //shaを計算したときの改行の変換方法
+	BlobSize int64  `json:"blob_size,omitempty"` //改行を変換した場合のblobのサイズ
+}
+
+// キャッシュファイルの形式
+type blobCacheFile struct {
+	Version int                        `json:"version"`
+	Entries map[string]*blobCacheEntry `json:"entries"`
+}
+
+const blobCacheVersion = 1
+
+// キャッシュファイルを開く。存在しない場合や形式が異なる場合は空のキャッシュになる。
+// maxEntriesが0以下の場合はDefaultBlobCacheEntriesを上限にする。
+func OpenBlobCache(path string, maxEntries int) (*BlobCache, error) {
+	if maxEntries <= 0 {
+		maxEntries = DefaultBlobCacheEntries
+	}
+	cache := &BlobCache{path: path, maxEntries: maxEntries, entries: make(map[string]*blobCacheEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file := &blobCacheFile{}
+	if err := json.Unmarshal(data, file); err != nil || file.Version != blobCacheVersion {
+		//壊れたキャッシュは捨てて作り直す
+		cache.dirty = true
+		return cache, nil
+	}
+	for key, entry := range file.Entries {
+		if entry != nil && entry.Sha != "" {
+			cache.entries[key] = entry
+		}
+	}
+	return cache, nil
+}
+
+// キャッシュの内容をファイルに書き込む。件数が上限を超えている場合は使われていない順に削除する。
+func (cache *BlobCache) Save() error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.evict()
+	if !cache.dirty {
+		return nil
+	}
+	data, err := json.Marshal(&blobCacheFile{Version: blobCacheVersion, Entries: cache.entries})
+	if err != nil {
+		return err
+	}
+	//書き込み途中で終了してもキャッシュが壊れないように、一時ファイルに書いてから置き換える
+	tmp, err := os.CreateTemp(filepath.Dir(cache.path), filepath.Base(cache.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), cache.path); err != nil {
+		return err
+	}
+	cache.dirty = false
+	return nil
+}
+
+// 指定したローカルパスのキャッシュを削除する。ディレクトリを指定した場合は配下のファイルも削除する。
+func (cache *BlobCache) Invalidate(localPath string) {
+	key, err := filepath.Abs(localPath)
+	if err != nil {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	prefix := key + string(filepath.Separator)
+	for path := range cache.entries {
+		if path == key || strings.HasPrefix(path, prefix) {
+			delete(cache.entries, path)
+			cache.dirty = true
+		}
+	}
+}
+
+// キャッシュをすべて削除する。
+func (cache *BlobCache) Clear() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if len(cache.entries) > 0 {
+		cache.entries = make(map[string]*blobCacheEntry)
+		cache.dirty = true
+	}
+}
+
+// キャッシュの件数を返す。
+func (cache *BlobCache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return len(cache.entries)
+}
+
+// ローカルファイルのshaのキャッシュを設定する。nilの場合は毎回ファイルを読み込んでshaを計算する。
+func (gitInfo *GitInfo) SetBlobCache(cache *BlobCache) {
+	gitInfo.blobCache = cache
+}
+
+// サイズと更新時刻、改行の変換方法が一致するキャッシュのshaとblobのサイズを返す。一致しない場合は古いキャッシュを削除する。
+func (cache *BlobCache) lookup(localPath string, info os.FileInfo, eol eolConversion) (string, int, bool) {
+	if cache == nil {
+		return "", 0, false
+	}
+	key, err := filepath.Abs(localPath)
+	if err != nil {
+		return "", 0, false
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	entry, ok := cache.entries[key]
+	if !ok {
+		return "", 0, false
+	}
+	if entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() || entry.Eol != string(eol) {
+		delete(cache.entries, key)
+		cache.dirty = true
+		return "", 0, false
+	}
+	entry.Used = time.Now().UnixNano()
+	cache.dirty = true
+	if eol != eolNone {
+		return entry.Sha, int(entry.BlobSize), true
+	}
+	return entry.Sha, int(entry.Size), true
+}
+
+// 読み込む前に取得したinfoをキーにshaを保存する。blobSizeは改行を変換した後のサイズ
+func (cache *BlobCache) store(localPath string, info os.FileInfo, eol eolConversion, sha string, blobSize int) {
+	if cache == nil {
+		return
+	}
+	now := time.Now()
+	if now.Sub(info.ModTime()) < blobCacheRacyWindow {
+		return
+	}
+	key, err := filepath.Abs(localPath)
+	if err != nil {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries[key] = &blobCacheEntry{
+		Sha:     sha,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Used:    now.UnixNano(),
+	}
+	if eol != eolNone {
+		cache.entries[key].Eol = string(eol)
+		cache.entries[key].BlobSize = int64(blobSize)
+	}
+	cache.dirty = true
+}
+
+// 件数が上限を超えている場合に使われていない順に削除する
+func (cache *BlobCache) evict() {
+	over := len(cache.entries) - cache.maxEntries
+	if over <= 0 {
+		return
+	}
+	keys := make([]string, 0, len(cache.entries))
+	for key := range cache.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return cache.entries[keys[i]].Used < cache.entries[keys[j]].Used
+	})
+	for _, key := range keys[:over] {
+		delete(cache.entries, key)
+	}
+	cache.dirty = true
+}
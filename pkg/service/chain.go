@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// CreateCommitChainで作成する1コミット分のメッセージと変更内容
+type CommitGroup struct {
+	Message  string
+	Elements []*CommitElement
+}
+
+// CommitGroupの順にコミットを積み重ね、最後に1度だけブランチのrefを更新する。
+// 途中で失敗した場合はブランチは更新されない。戻り値はgroupListと同じ順のコミット。
+// ブランチの更新後にジャーナルの破棄に失敗した場合は、作成したコミットをエラーと一緒に返す。
+// ActionProvider(GitLab、Gitea)ではコミットごとにブランチが更新されるため不可分ではなく、途中で失敗した場合は作成済みのコミットをエラーと一緒に返す。
+func (gitInfo *GitInfo) CreateCommitChain(groupList []*CommitGroup) ([]*githubapi.CreateCommitResponse, error) {
+	if len(groupList) == 0 {
+		return nil, errors.New("groupList is empty.")
+	}
+	var err error
+	if provider, ok := gitInfo.provider.(ActionProvider); ok {
+		for attempt := 0; attempt < maxCommitAttempts; attempt++ {
+			var respList []*githubapi.CreateCommitResponse
+			respList, err = gitInfo.createCommitChainByActions(provider, groupList, gitInfo.newProgressReporter(len(groupList), attempt+1))
+			if err == nil {
+				return respList, nil
+			}
+			//既にコミットを作成している場合はやり直さない
+			if !errors.Is(err, ErrBranchMoved) || len(respList) > 0 {
+				return respList, err
+			}
+		}
+		return nil, err
+	}
+	uploaded := make(map[string]bool) //作り直しの際に同じblobを再度アップロードしない
+	if !gitInfo.stagesObjects() {
+		uploaded = gitInfo.journal.uploadedBlobs(gitInfo.provider)
+	}
+	for attempt := 0; attempt < maxCommitAttempts; attempt++ {
+		var respList []*githubapi.CreateCommitResponse
+		progress := gitInfo.newProgressReporter(len(groupList), attempt+1)
+		respList, err = gitInfo.createCommitChain(groupList, uploaded, progress)
+		if err == nil {
+			return respList, nil
+		}
+		if !errors.Is(err, ErrBranchMoved) {
+			return respList, err
+		}
+	}
+	return nil, err
+}
+
+func (gitInfo *GitInfo) createCommitChain(groupList []*CommitGroup, uploaded map[string]bool, progress *progressReporter) ([]*githubapi.CreateCommitResponse, error) {
+	//refを取得して最新commitを確認
+	head, err := gitInfo.getBranchHead()
+	if err != nil {
+		return nil, err
+	}
+	isEmptyRepo := (head.commitSha == "")
+
+	//GitHubで1コミットの場合、GraphQLで表現できる場合はcreateCommitOnBranchで、1ファイルだけの変更はContents APIで作成する
+	var firstChangeList []*fileChange
+	if len(groupList) == 1 && !isEmptyRepo && gitInfo.client != nil && gitInfo.backend != BackendPush {
+		firstChangeList, err = prepareChanges(newBaseTree(gitInfo.provider, head.treeSha), groupList[0].Elements, gitInfo.blobCache, gitInfo.normalizeEol, progress)
+		if err != nil {
+			return nil, err
+		}
+		var createCommitResp *githubapi.CreateCommitResponse
+		if gitInfo.backend == BackendGraphql && canCommitByGraphql(firstChangeList) {
+			createCommitResp, err = gitInfo.commitByGraphql(groupList[0].Message, head.commitSha, firstChangeList, progress)
+		} else if change := singleContentChange(firstChangeList); change != nil {
+			createCommitResp, err = gitInfo.commitByContents(groupList[0].Message, change, progress)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if createCommitResp != nil {
+			return []*githubapi.CreateCommitResponse{createCommitResp}, nil
+		}
+	}
+
+	if err := gitInfo.journal.recordStart(gitInfo.provider, head.commitSha, len(groupList)); err != nil {
+		return nil, err
+	}
+
+	//前のコミットのtreeを元に次のtreeとcommitを作る。refはまだ更新しない
+	var respList []*githubapi.CreateCommitResponse
+	parentSha := head.commitSha
+	//2つ目以降のコミットは作成したtreeを元にするため、push前のオブジェクトも読み込めるProviderを使う
+	reader := gitInfo.treeReader()
+	base := newBaseTree(reader, head.treeSha)
+	for i, group := range groupList {
+		if progress != nil {
+			progress.group = i + 1
+		}
+		changeList := firstChangeList
+		if i > 0 || changeList == nil {
+			changeList, err = prepareChanges(base, group.Elements, gitInfo.blobCache, gitInfo.normalizeEol, progress)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := gitInfo.journal.recordPlan(i+1, group.Message, base.rootSha, changeList, uploaded); err != nil {
+			return nil, err
+		}
+		treeSha, err := gitInfo.writeTree(base, changeList, uploaded, progress)
+		if err != nil {
+			return nil, err
+		}
+		if err := gitInfo.journal.recordTree(i+1, treeSha); err != nil {
+			return nil, err
+		}
+		progress.step(PhaseCommit, false)
+		createCommitResp, err := gitInfo.writeCommit(group.Message, treeSha, parentSha)
+		if err != nil {
+			return nil, err
+		}
+		if err := gitInfo.journal.recordCommit(i+1, createCommitResp); err != nil {
+			return nil, err
+		}
+		progress.step(PhaseCommit, true)
+		respList = append(respList, createCommitResp)
+		parentSha = createCommitResp.Sha
+		base = newBaseTree(reader, treeSha)
+	}
+
+	//refの更新
+	progress.step(PhaseRef, false)
+	if err := gitInfo.updateBranchRef(parentSha, head.commitSha); err != nil {
+		return nil, err
+	}
+	progress.step(PhaseRef, true)
+	if err := gitInfo.journal.recordDone(); err != nil {
+		//ブランチは更新済みのため作成したコミットも返す
+		return respList, fmt.Errorf("error occured when reset journal. %w", err)
+	}
+	return respList, nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// Contents APIで作成できる1ファイルだけの変更かを返す。変更のないパスは無視する。
+// Contents APIはファイルのモードを指定できないため、通常のファイルの追加・更新・削除に限る。
+func singleContentChange(changeList []*fileChange) *fileChange {
+	var single *fileChange
+	for _, change := range changeList {
+		if change.action == ActionUnchanged {
+			continue
+		}
+		if single != nil {
+			return nil
+		}
+		single = change
+	}
+	if single == nil {
+		return nil
+	}
+	switch single.action {
+	case ActionDelete:
+		if single.baseEntry.Type != "blob" {
+			return nil
+		}
+	case ActionAdd, ActionModify:
+		if single.mode != "100644" || single.objType != "blob" || single.load == nil {
+			return nil
+		}
+		if single.baseEntry != nil && single.baseEntry.Mode != "100644" {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return single
+}
+
+// Contents APIで1ファイルの変更のコミットを作成し、ブランチを更新する。
+// 変更前のblobのshaを前提条件として送り、他のコミットでファイルが変更されていた場合はErrBranchMovedを返す。
+// git data APIと同じく、committerにもauthorを指定する。指定しない場合はトークンのユーザーになる
+func (gitInfo *GitInfo) commitByContents(commitMsg string, change *fileChange, progress *progressReporter) (*githubapi.CreateCommitResponse, error) {
+	git := gitInfo.client
+	author := &githubapi.CommitAuthor{
+		Name:  gitInfo.author_name,
+		Email: gitInfo.author_email,
+		Date:  commitDate(),
+	}
+	var baseSha string
+	if change.baseEntry != nil {
+		baseSha = change.baseEntry.Sha
+	}
+
+	progress.step(PhaseCommit, false)
+	var contentResp *githubapi.ContentResponse
+	var err error
+	if change.action == ActionDelete {
+		contentResp, err = git.DeleteContent(change.path, &githubapi.DeleteContentData{
+			Message:   commitMsg,
+			Sha:       baseSha,
+			Author:    author,
+			Committer: author,
+		})
+	} else {
+		var data []byte
+		data, err = change.load()
+		if err != nil {
+			return nil, fmt.Errorf("error occured when read %s. %w", change.path, err)
+		}
+		contentResp, err = git.PutContent(change.path, &githubapi.PutContentData{
+			Message:   commitMsg,
+			Content:   base64.StdEncoding.EncodeToString(data),
+			Sha:       baseSha,
+			Author:    author,
+			Committer: author,
+		})
+	}
+	if err != nil {
+		var apiErr *githubapi.ApiError
+		if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusConflict || (apiErr.StatusCode == http.StatusUnprocessableEntity && strings.Contains(apiErr.Body, "sha"))) {
+			return nil, fmt.Errorf("error occured when update contents. %w %s", ErrBranchMoved, err)
+		}
+		return nil, fmt.Errorf("error occured when update contents. %w", err)
+	}
+	progress.step(PhaseCommit, true)
+	//Contents APIはブランチの更新まで行う
+	progress.step(PhaseRef, false)
+	progress.step(PhaseRef, true)
+	return &contentResp.Commit, nil
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// コミット時の改行の変換方法
+type eolConversion string
+
+const (
+	eolNone eolConversion = ""     //変換しない
+	eolText eolConversion = "text" //CRLFをLFに変換する
+	eolAuto eolConversion = "auto" //バイナリでない場合にCRLFをLFに変換する
+)
+
+// 属性ファイルの名前
+const gitattributesName = ".gitattributes"
+
+// .gitattributesの1行。attrsの値は設定が"true"、解除が"false"、未指定に戻す場合は空、それ以外は値
+type attributeRule struct {
+	pattern *regexp.Regexp
+	base    bool //trueの場合はファイル名、falseの場合は.gitattributesのディレクトリからの相対パスと比較する
+	attrs   map[string]string
+}
+
+// コミット先の.gitattributesから改行の変換方法を決める。
+// コミットに含まれる.gitattributesはその内容を、それ以外はbaseの内容を使う
+type gitattributes struct {
+	base     *baseTree
+	elements map[string]*CommitElement //コミットに含まれる.gitattributes
+	mirrors  []*CommitElement
+	files    map[string][]*attributeRule //ディレクトリごとの読み込み済みの規則
+}
+
+// baseとelementListから属性を読み込むgitattributesを作成する
+func newGitattributes(base *baseTree, elementList []*CommitElement) *gitattributes {
+	attributes := &gitattributes{
+		base:     base,
+		elements: make(map[string]*CommitElement),
+		files:    make(map[string][]*attributeRule),
+	}
+	for _, element := range elementList {
+		switch {
+		case element.mirrorKeep != nil:
+			attributes.mirrors = append(attributes.mirrors, element)
+		case element.submodule == nil && element.sourcePath == "" && path.Base(element.pathInRepo) == gitattributesName:
+			attributes.elements[strings.Trim(element.pathInRepo, "/")] = element
+		}
+	}
+	return attributes
+}
+
+// repoPathのファイルの改行の変換方法を返す。nilの場合は変換しない
+func (attributes *gitattributes) conversion(repoPath string) (eolConversion, error) {
+	if attributes == nil {
+		return eolNone, nil
+	}
+	repoPath = strings.Trim(repoPath, "/")
+	values := make(map[string]string)
+	//ルートから順に読み込み、深いディレクトリの規則と後ろの行を優先する
+	dirs := []string{""}
+	for i, c := range repoPath {
+		if c == '/' {
+			dirs = append(dirs, repoPath[:i])
+		}
+	}
+	for _, dir := range dirs {
+		rules, err := attributes.rules(dir)
+		if err != nil {
+			return eolNone, err
+		}
+		relPath := repoPath
+		if dir != "" {
+			relPath = repoPath[len(dir)+1:]
+		}
+		for _, rule := range rules {
+			target := relPath
+			if rule.base {
+				target = path.Base(relPath)
+			}
+			if !rule.pattern.MatchString(target) {
+				continue
+			}
+			for name, value := range rule.attrs {
+				if value == "" {
+					delete(values, name)
+				} else {
+					values[name] = value
+				}
+			}
+		}
+	}
+	switch text := values["text"]; {
+	case text == "false":
+		return eolNone, nil
+	case text == "true":
+		return eolText, nil
+	case text == "auto":
+		return eolAuto, nil
+	}
+	//eolの指定はtextを設定したものとして扱う
+	if eol := values["eol"]; eol == "lf" || eol == "crlf" {
+		return eolText, nil
+	}
+	//指定がない場合は内容から判定する
+	return eolAuto, nil
+}
+
+// dirの.gitattributesの規則を返す
+func (attributes *gitattributes) rules(dir string) ([]*attributeRule, error) {
+	if rules, ok := attributes.files[dir]; ok {
+		return rules, nil
+	}
+	filePath := gitattributesName
+	if dir != "" {
+		filePath = dir + "/" + gitattributesName
+	}
+	data, err := attributes.read(filePath)
+	if err != nil {
+		return nil, err
+	}
+	rules := parseGitattributes(data)
+	attributes.files[dir] = rules
+	return rules, nil
+}
+
+// コミット後の.gitattributesの内容を返す。存在しない場合はnilを返す
+func (attributes *gitattributes) read(filePath string) ([]byte, error) {
+	if element, ok := attributes.elements[filePath]; ok {
+		switch {
+		case element.deleted:
+			return nil, nil
+		case element.transform != nil:
+			data, _, err := transformContent(attributes.base, element)
+			return data, err
+		case element.blobSha != "":
+			return attributes.base.readBlob(element.blobSha)
+		default:
+			return readElementContent(element)
+		}
+	}
+	for _, element := range attributes.mirrors {
+		prefix := strings.Trim(element.pathInRepo, "/")
+		if (prefix == "" || strings.HasPrefix(filePath, prefix+"/")) && !element.mirrorKeep[filePath] {
+			//ミラーで削除される
+			return nil, nil
+		}
+	}
+	entry, err := attributes.base.lookup(filePath)
+	if err != nil || entry == nil || entry.Type != "blob" {
+		return nil, err
+	}
+	return attributes.base.readBlob(entry.Sha)
+}
+
+// .gitattributesを解析する。マクロの定義、否定、ディレクトリのパターンは無視する
+func parseGitattributes(data []byte) []*attributeRule {
+	var rules []*attributeRule
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") || strings.HasPrefix(fields[0], "!") || strings.HasSuffix(fields[0], "/") {
+			continue
+		}
+		pattern := fields[0]
+		rule := &attributeRule{attrs: make(map[string]string)}
+		if !strings.Contains(pattern, "/") {
+			rule.base = true
+		}
+		rule.pattern = globRegexp(strings.TrimPrefix(pattern, "/"))
+		for _, attr := range fields[1:] {
+			switch {
+			case attr == "binary":
+				rule.attrs["text"] = "false"
+			case strings.HasPrefix(attr, "-"):
+				rule.attrs[attr[1:]] = "false"
+			case strings.HasPrefix(attr, "!"):
+				rule.attrs[attr[1:]] = ""
+			default:
+				name, value, ok := strings.Cut(attr, "=")
+				if !ok {
+					value = "true"
+				}
+				rule.attrs[name] = value
+			}
+		}
+		//古いcrlf属性はtextと同じ意味
+		if crlf, ok := rule.attrs["crlf"]; ok {
+			if crlf != "false" && crlf != "" {
+				crlf = "true"
+			}
+			rule.attrs["text"] = crlf
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// gitのワイルドカード(*、?、[...]、**)を正規表現に変換する
+func globRegexp(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case pattern[i:] == "**":
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return regexp.MustCompile(`^` + regexp.QuoteMeta(pattern) + `$`)
+	}
+	return re
+}
+
+// 変換方法に従ってCRLFをLFに変換する
+func normalizeEol(data []byte, conversion eolConversion) []byte {
+	if conversion == eolNone || !bytes.Contains(data, []byte("\r\n")) {
+		return data
+	}
+	if conversion == eolAuto && isBinaryData(data) {
+		return data
+	}
+	return bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+}
+
+// gitと同じ基準でバイナリかを判定する。NULまたはLFの続かないCRを含む場合、制御文字が多い場合はバイナリとみなす
+func isBinaryData(data []byte) bool {
+	printable, nonPrintable := 0, 0
+	for i, c := range data {
+		switch {
+		case c == 0:
+			return true
+		case c == '\r':
+			if i+1 >= len(data) || data[i+1] != '\n' {
+				return true
+			}
+		case c == '\n':
+		case c == 127:
+			nonPrintable++
+		case c < 32:
+			switch c {
+			case '\b', '\t', '\033', '\014':
+				printable++
+			case '\032':
+				//末尾のEOF文字は無視する
+				if i < len(data)-1 {
+					nonPrintable++
+				}
+			default:
+				nonPrintable++
+			}
+		default:
+			printable++
+		}
+	}
+	return printable>>7 < nonPrintable
+}
+
+// ローカルファイルとMakeCommitElementByFileDataのデータの改行をコミット時に変換するかを設定する。
+// trueの場合は.gitattributesのtext、eol、binaryに従い、指定のないファイルはバイナリでなければCRLFをLFに変換する。
+func (gitInfo *GitInfo) SetLineEndingNormalization(enabled bool) {
+	gitInfo.normalizeEol = enabled
+}
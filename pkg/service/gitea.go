@@ -0,0 +1,180 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	giteaapi "github.com/daze-doragon/go-gituse/pkg/giteaapi"
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// GiteaおよびForgejoのProvider。コミットはChangeFiles APIで作成する。
+// 更新・削除するファイルには変更前のblobのshaを前提条件として送り、他のコミットでファイルが変更されていた場合はErrBranchMovedを返す。
+// ChangeFiles APIはファイルのモードを指定できないため、実行権限の変更と実行可能なファイルの追加はErrNotSupportedを返す。
+type giteaProvider struct {
+	git *giteaapi.GiteaClient
+}
+
+// GiteaまたはForgejoのクライアントからProviderを作成する
+func NewGiteaProvider(client *giteaapi.GiteaClient) ActionProvider {
+	if client.Branch == "" {
+		client.Branch = "main"
+	}
+	return &giteaProvider{git: client}
+}
+
+func (provider *giteaProvider) RepositoryInfo() (string, string, string) {
+	return provider.git.Owner, provider.git.Repository, provider.git.Branch
+}
+
+func (provider *giteaProvider) BranchHead() (string, string, error) {
+	branchResp, err := provider.git.GetBranch(provider.git.Branch)
+	var apiErr *giteaapi.ApiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		//空のリポジトリにはブランチがない
+		repoResp, repoErr := provider.git.GetRepository()
+		if repoErr != nil {
+			return "", "", fmt.Errorf("error occured when get the repository. %w", repoErr)
+		}
+		if repoResp.Empty {
+			return "", "", nil
+		}
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error occured when get the branch. %w", err)
+	}
+	commitResp, err := provider.git.GetCommit(branchResp.Commit.Id)
+	if err != nil {
+		return "", "", fmt.Errorf("error occured when get the latest commit. %w", err)
+	}
+	return commitResp.Sha, commitResp.Commit.Tree.Sha, nil
+}
+
+func (provider *giteaProvider) GetTree(sha string, recursive bool) (*githubapi.GetTreeResponse, error) {
+	giteaTree, err := provider.git.GetTree(sha, recursive)
+	if err != nil {
+		return nil, err
+	}
+	treeResp := &githubapi.GetTreeResponse{Sha: giteaTree.Sha}
+	for _, entry := range giteaTree.Tree {
+		treeResp.Tree = append(treeResp.Tree, &githubapi.TreeEntryElement{
+			Path: entry.Path,
+			Mode: entry.Mode,
+			Type: entry.Type,
+			Sha:  entry.Sha,
+			Size: entry.Size,
+		})
+	}
+	return treeResp, nil
+}
+
+func (provider *giteaProvider) GetBlob(sha string) (*githubapi.BlobResponse, error) {
+	blobResp, err := provider.git.GetBlob(sha)
+	if err != nil {
+		return nil, err
+	}
+	return &githubapi.BlobResponse{
+		Sha:      blobResp.Sha,
+		Size:     blobResp.Size,
+		Content:  blobResp.Content,
+		Encoding: blobResp.Encoding,
+	}, nil
+}
+
+func (provider *giteaProvider) ListBranches() ([]*githubapi.BranchResponse, error) {
+	giteaList, err := provider.git.ListBranches()
+	if err != nil {
+		return nil, err
+	}
+	var branchList []*githubapi.BranchResponse
+	for _, giteaBranch := range giteaList {
+		branch := &githubapi.BranchResponse{Name: giteaBranch.Name, Protected: giteaBranch.Protected}
+		branch.Commit.Sha = giteaBranch.Commit.Id
+		branch.Commit.Url = giteaBranch.Commit.Url
+		branchList = append(branchList, branch)
+	}
+	return branchList, nil
+}
+
+func (provider *giteaProvider) IsExistRepo() (bool, error) {
+	_, err := provider.git.GetRepository()
+	var apiErr *giteaapi.ApiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (provider *giteaProvider) CommitActions(commit *ActionCommit) (*githubapi.CreateCommitResponse, error) {
+	author := &giteaapi.Identity{Name: commit.AuthorName, Email: commit.AuthorEmail}
+	filesData := &giteaapi.ChangeFilesData{
+		Message:   commit.Message,
+		Author:    author,
+		Committer: author,
+	}
+	for _, action := range commit.Actions {
+		operation := &giteaapi.ChangeFileOperation{Path: action.Path, Sha: action.PreviousSha}
+		switch action.Action {
+		case FileCreate:
+			if action.Executable {
+				return nil, fmt.Errorf("%s: executable files cannot be created by gitea. %w", action.Path, ErrNotSupported)
+			}
+			operation.Operation = "create"
+		case FileUpdate, FileMove:
+			//更新・移動では元のファイルの実行権限が引き継がれる
+			if action.Executable != action.PreviousExecutable {
+				return nil, fmt.Errorf("%s: file mode cannot be changed by gitea. %w", action.Path, ErrNotSupported)
+			}
+			operation.Operation = "update"
+			operation.From_path = action.PreviousPath
+		case FileDelete:
+			operation.Operation = "delete"
+		default:
+			return nil, fmt.Errorf("%s: %s cannot be committed by gitea. %w", action.Path, action.Action, ErrNotSupported)
+		}
+		content := action.Content
+		if action.Action == FileMove && content == nil {
+			//移動でも内容の指定が必要
+			blobResp, err := provider.git.GetBlob(action.PreviousSha)
+			if err != nil {
+				return nil, fmt.Errorf("error occured when get blob %s. %w", action.PreviousSha, err)
+			}
+			operation.Content = strings.ReplaceAll(blobResp.Content, "\n", "")
+		} else if action.Action != FileDelete {
+			operation.Content = base64.StdEncoding.EncodeToString(content)
+		}
+		filesData.Files = append(filesData.Files, operation)
+	}
+	filesResp, err := provider.git.ChangeFiles(filesData)
+	if err != nil {
+		var apiErr *giteaapi.ApiError
+		if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusConflict || (apiErr.StatusCode == http.StatusUnprocessableEntity && (strings.Contains(apiErr.Body, "sha") || strings.Contains(apiErr.Body, "already exists")))) {
+			return nil, fmt.Errorf("error occured when change files. %w %s", ErrBranchMoved, err)
+		}
+		return nil, fmt.Errorf("error occured when change files. %w", err)
+	}
+	commitResp := filesResp.Commit
+	resp := &githubapi.CreateCommitResponse{
+		Sha:      commitResp.Sha,
+		Url:      commitResp.Url,
+		Html_url: commitResp.Html_url,
+		Message:  commitResp.Message,
+	}
+	resp.Tree.Sha, resp.Tree.Url = commitResp.Tree.Sha, commitResp.Tree.Url
+	resp.Author.Name, resp.Author.Email, resp.Author.Date = commitResp.Author.Name, commitResp.Author.Email, commitResp.Author.Date
+	resp.Commiter.Name, resp.Commiter.Email, resp.Commiter.Date = commitResp.Committer.Name, commitResp.Committer.Email, commitResp.Committer.Date
+	for _, parent := range commitResp.Parents {
+		resp.Parents = append(resp.Parents, struct {
+			Sha      string `json:"sha"`
+			Url      string `json:"url"`
+			Html_url string `json:"html_url"`
+		}{Sha: parent.Sha, Url: parent.Url})
+	}
+	return resp, nil
+}
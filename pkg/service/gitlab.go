@@ -0,0 +1,225 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	gitlabapi "github.com/daze-doragon/go-gituse/pkg/gitlabapi"
+)
+
+// GitLabのProvider。GitLabのAPIはコミットのtreeのshaを返さないため、treeはコミットのshaで参照し、
+// 最初に参照した時点でコミット配下のtreeを再帰的に取得してshaごとに保持する。
+// コミットはcommits APIのactionsで作成するため、CreateCommitChainはコミットごとにブランチを更新する。
+// 変更の元にしたコミットをstart_shaとして送り、ブランチが他のコミットで更新されていた場合はErrBranchMovedを返す。
+type gitlabProvider struct {
+	git   *gitlabapi.GitlabClient
+	trees map[string][]*githubapi.TreeEntryElement //treeまたはコミットのsha -> 直下の要素
+}
+
+// GitLabのクライアントからProviderを作成する
+func NewGitlabProvider(client *gitlabapi.GitlabClient) ActionProvider {
+	if client.Branch == "" {
+		client.Branch = "main"
+	}
+	return &gitlabProvider{git: client, trees: make(map[string][]*githubapi.TreeEntryElement)}
+}
+
+func (provider *gitlabProvider) RepositoryInfo() (string, string, string) {
+	project := provider.git.Project
+	owner, repository := "", project
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		owner, repository = project[:i], project[i+1:]
+	}
+	return owner, repository, provider.git.Branch
+}
+
+func (provider *gitlabProvider) BranchHead() (string, string, error) {
+	branchResp, err := provider.git.GetBranch(provider.git.Branch)
+	var apiErr *gitlabapi.ApiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		//空のプロジェクトにはブランチがない
+		projectResp, projectErr := provider.git.GetProject()
+		if projectErr != nil {
+			return "", "", fmt.Errorf("error occured when get the project. %w", projectErr)
+		}
+		if projectResp.Empty_repo {
+			return "", "", nil
+		}
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error occured when get the branch. %w", err)
+	}
+	return branchResp.Commit.Id, branchResp.Commit.Id, nil
+}
+
+func (provider *gitlabProvider) GetTree(sha string, recursive bool) (*githubapi.GetTreeResponse, error) {
+	if _, ok := provider.trees[sha]; !ok {
+		if err := provider.loadCommitTree(sha); err != nil {
+			return nil, err
+		}
+	}
+	treeResp := &githubapi.GetTreeResponse{Sha: sha}
+	var walk func(treeSha string, prefix string)
+	walk = func(treeSha string, prefix string) {
+		for _, entry := range provider.trees[treeSha] {
+			element := *entry
+			element.Path = prefix + entry.Path
+			treeResp.Tree = append(treeResp.Tree, &element)
+			if recursive && entry.Type == "tree" {
+				walk(entry.Sha, element.Path+"/")
+			}
+		}
+	}
+	walk(sha, "")
+	return treeResp, nil
+}
+
+// コミット配下のtreeを再帰的に取得し、treeのshaごとに直下の要素を保持する
+func (provider *gitlabProvider) loadCommitTree(commitSha string) error {
+	entryList, err := provider.git.ListTree(commitSha, "", true)
+	if err != nil {
+		return fmt.Errorf("error occured when list tree %s. %w", commitSha, err)
+	}
+	treeShaByPath := map[string]string{"": commitSha}
+	for _, entry := range entryList {
+		if entry.Type == "tree" {
+			treeShaByPath[entry.Path] = entry.Id
+		}
+	}
+	provider.trees[commitSha] = nil
+	for _, entry := range entryList {
+		parentSha := treeShaByPath[path.Dir(entry.Path)]
+		if path.Dir(entry.Path) == "." {
+			parentSha = commitSha
+		}
+		if entry.Type == "tree" {
+			if _, ok := provider.trees[entry.Id]; !ok {
+				provider.trees[entry.Id] = nil
+			}
+		}
+		provider.trees[parentSha] = append(provider.trees[parentSha], &githubapi.TreeEntryElement{
+			Path: entry.Name,
+			Mode: entry.Mode,
+			Type: entry.Type,
+			Sha:  entry.Id,
+		})
+	}
+	return nil
+}
+
+func (provider *gitlabProvider) GetBlob(sha string) (*githubapi.BlobResponse, error) {
+	blobResp, err := provider.git.GetBlob(sha)
+	if err != nil {
+		return nil, err
+	}
+	return &githubapi.BlobResponse{
+		Sha:      blobResp.Sha,
+		Size:     blobResp.Size,
+		Content:  blobResp.Content,
+		Encoding: blobResp.Encoding,
+	}, nil
+}
+
+func (provider *gitlabProvider) ListBranches() ([]*githubapi.BranchResponse, error) {
+	gitlabList, err := provider.git.ListBranches()
+	if err != nil {
+		return nil, err
+	}
+	var branchList []*githubapi.BranchResponse
+	for _, gitlabBranch := range gitlabList {
+		branch := &githubapi.BranchResponse{Name: gitlabBranch.Name, Protected: gitlabBranch.Protected}
+		branch.Commit.Sha = gitlabBranch.Commit.Id
+		branchList = append(branchList, branch)
+	}
+	return branchList, nil
+}
+
+func (provider *gitlabProvider) IsExistRepo() (bool, error) {
+	_, err := provider.git.GetProject()
+	var apiErr *gitlabapi.ApiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (provider *gitlabProvider) CommitActions(commit *ActionCommit) (*githubapi.CreateCommitResponse, error) {
+	commitData := &gitlabapi.CommitData{
+		Commit_message: commit.Message,
+		Author_name:    commit.AuthorName,
+		Author_email:   commit.AuthorEmail,
+		Start_sha:      commit.BaseCommit,
+		Actions:        []*gitlabapi.CommitAction{},
+	}
+	for _, action := range commit.Actions {
+		gitlabAction := &gitlabapi.CommitAction{
+			Action:        string(action.Action),
+			File_path:     action.Path,
+			Previous_path: action.PreviousPath,
+		}
+		if action.Content != nil {
+			content, encoding := encodeContent(action.Content)
+			gitlabAction.Content, gitlabAction.Encoding = content, "base64"
+			if encoding == Utf8 {
+				gitlabAction.Encoding = "text"
+			}
+		}
+		switch action.Action {
+		case FileCreate, FileUpdate, FileChmod:
+			executable := action.Executable
+			gitlabAction.Execute_filemode = &executable
+		}
+		commitData.Actions = append(commitData.Actions, gitlabAction)
+	}
+	commitResp, err := provider.git.CreateCommit(commitData)
+	if err != nil {
+		if isGitlabConflict(err) {
+			return nil, fmt.Errorf("error occured when CreateCommit. %w %s", ErrBranchMoved, err)
+		}
+		return nil, fmt.Errorf("error occured when CreateCommit. %w", err)
+	}
+	resp := &githubapi.CreateCommitResponse{
+		Sha:      commitResp.Id,
+		Html_url: commitResp.Web_url,
+		Message:  commitResp.Message,
+	}
+	//GitLabのtreeはコミットのshaで参照する
+	resp.Tree.Sha = commitResp.Id
+	resp.Author.Name, resp.Author.Email, resp.Author.Date = commitResp.Author_name, commitResp.Author_email, commitResp.Authored_date
+	resp.Commiter.Name, resp.Commiter.Email, resp.Commiter.Date = commitResp.Committer_name, commitResp.Committer_email, commitResp.Committed_date
+	for _, parentSha := range commitResp.Parent_ids {
+		resp.Parents = append(resp.Parents, struct {
+			Sha      string `json:"sha"`
+			Url      string `json:"url"`
+			Html_url string `json:"html_url"`
+		}{Sha: parentSha})
+	}
+	return resp, nil
+}
+
+// ブランチがstart_shaから進んでいる場合や、ファイルの有無が変更元のコミットと異なる場合のエラーか判定する
+func isGitlabConflict(err error) bool {
+	var apiErr *gitlabapi.ApiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode == http.StatusConflict {
+		return true
+	}
+	if apiErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	for _, message := range []string{"Please refresh", "already exists", "doesn't exist", "changed since"} {
+		if strings.Contains(apiErr.Body, message) {
+			return true
+		}
+	}
+	return false
+}
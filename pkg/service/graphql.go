@@ -0,0 +1,91 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// コミットの作成方法
+type CommitBackend string
+
+const (
+	BackendRest    CommitBackend = "rest"    //git data API(blob、tree、commit、refを順に作成する)
+	BackendGraphql CommitBackend = "graphql" //GraphQLのcreateCommitOnBranch。App tokenの場合は署名済み(verified)のコミットになる
+	BackendPush    CommitBackend = "push"    //オブジェクトを手元で作成し、packファイルにまとめてgit smart HTTPでpushする
+)
+
+// コミットの作成方法を設定する。空の場合はBackendRest。
+// BackendGraphqlは作者を指定できず、トークンのユーザーまたはAppがコミットの作者になる。
+// 実行ビットやシンボリックリンク、既存blobの再利用(移動・コピー)、空のリポジトリ、複数コミットのCreateCommitChainなど
+// createCommitOnBranchで表現できない場合はBackendRestで作成する。
+// BackendPushはGitHubのProviderでのみ使え、GitClient.RemoteUrlにpushする。
+func (gitInfo *GitInfo) SetCommitBackend(backend CommitBackend) {
+	gitInfo.backend = backend
+}
+
+// createCommitOnBranchで表現できる変更内容かを返す
+func canCommitByGraphql(changeList []*fileChange) bool {
+	for _, change := range changeList {
+		switch change.action {
+		case ActionUnchanged:
+			continue
+		case ActionDelete:
+			if change.baseEntry.Type != "blob" {
+				return false
+			}
+		case ActionAdd, ActionModify:
+			if change.mode != "100644" || change.objType != "blob" || change.load == nil {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// createCommitOnBranchで1コミットを作成し、ブランチを更新する。
+// ブランチがparentShaから更新されていた場合はErrBranchMovedを返す。
+func (gitInfo *GitInfo) commitByGraphql(commitMsg string, parentSha string, changeList []*fileChange, progress *progressReporter) (*githubapi.CreateCommitResponse, error) {
+	git := gitInfo.client
+	input := &githubapi.CreateCommitOnBranchInput{ExpectedHeadOid: parentSha}
+	input.Branch.RepositoryNameWithOwner = git.Owner + "/" + git.Repository
+	input.Branch.BranchName = git.Branch
+	headline, body, _ := strings.Cut(commitMsg, "\n")
+	input.Message.Headline = headline
+	input.Message.Body = strings.TrimLeft(body, "\n")
+	for _, change := range changeList {
+		switch change.action {
+		case ActionDelete:
+			input.FileChanges.Deletions = append(input.FileChanges.Deletions, &githubapi.FileDeletion{Path: change.path})
+		case ActionAdd, ActionModify:
+			data, err := change.load()
+			if err != nil {
+				return nil, fmt.Errorf("error occured when read %s. %w", change.path, err)
+			}
+			input.FileChanges.Additions = append(input.FileChanges.Additions, &githubapi.FileAddition{
+				Path:     change.path,
+				Contents: base64.StdEncoding.EncodeToString(data),
+			})
+		}
+	}
+
+	progress.step(PhaseCommit, false)
+	createCommitResp, err := git.CreateCommitOnBranch(input)
+	if err != nil {
+		var graphqlErrs githubapi.GraphqlErrors
+		if errors.As(err, &graphqlErrs) && (graphqlErrs.HasType("STALE_DATA") || strings.Contains(graphqlErrs.Error(), "Expected branch to point to")) {
+			return nil, fmt.Errorf("error occured when createCommitOnBranch. %w %s", ErrBranchMoved, err)
+		}
+		return nil, fmt.Errorf("error occured when createCommitOnBranch. %w", err)
+	}
+	progress.step(PhaseCommit, true)
+	//createCommitOnBranchはブランチの更新まで行う
+	progress.step(PhaseRef, false)
+	progress.step(PhaseRef, true)
+	return createCommitResp, nil
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// 再開できるコミット作成がないことを表すエラー
+var ErrNothingToResume = errors.New("nothing to resume.")
+
+// コミット作成の途中経過を記録するファイル。GitInfo.SetJournalで指定する。
+// 1行1レコードのJSONで追記し、ブランチの更新まで完了した時点で空にする。
+// 途中で失敗した場合は、同じジャーナルを指定して再実行するとアップロード済みのblobを再利用し、
+// ResumeCommitを呼ぶと最後に完了した段階(blob、tree、commit、ref)から続きを実行する。
+type Journal struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	records []*journalRecord
+}
+
+// ジャーナルの1レコード
+type journalRecord struct {
+	Type string `json:"type"` //start, plan, blob, tree, commit
+
+	//start: コミット作成の開始
+	Owner      string `json:"owner,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Branch     string `json:"branch,omitempty"`
+	BaseCommit string `json:"base_commit,omitempty"`
+	Groups     int    `json:"groups,omitempty"`
+
+	//plan: 1コミット分の変更内容
+	Group    int             `json:"group,omitempty"`
+	Message  string          `json:"message,omitempty"`
+	BaseTree string          `json:"base_tree,omitempty"`
+	Changes  []*journalEntry `json:"changes,omitempty"`
+
+	//blob: アップロード済みのblob。tree、commit: 作成済みのオブジェクト
+	Path     string          `json:"path,omitempty"`
+	Sha      string          `json:"sha,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"` //commitのCreateCommit APIのレスポンス
+}
+
+// planに記録するパス単位の変更内容
+type journalEntry struct {
+	Path      string     `json:"path"`
+	Action    PlanAction `json:"action"`
+	Mode      string     `json:"mode"`
+	Type      string     `json:"type"`
+	Sha       string     `json:"sha,omitempty"`
+	LocalPath string     `json:"local_path,omitempty"` //アップロードする内容をローカルファイルから読み込む場合
+	Eol       string     `json:"eol,omitempty"`        //ローカルファイルの改行の変換方法
+	Upload    bool       `json:"upload,omitempty"`     //blobのアップロードが必要
+}
+
+// ジャーナルファイルを開く。存在しない場合は作成する。
+func OpenJournal(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	journal := &Journal{path: path}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 256*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		record := &journalRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			//書き込み途中で終了した最後の行は無視する
+			break
+		}
+		journal.records = append(journal.records, record)
+	}
+	journal.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+// ジャーナルファイルを閉じる。
+func (journal *Journal) Close() error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	return journal.file.Close()
+}
+
+// 記録を破棄する。
+func (journal *Journal) Reset() error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if err := journal.file.Truncate(0); err != nil {
+		return err
+	}
+	journal.records = nil
+	return nil
+}
+
+// 完了していないコミット作成の記録があるかを返す。
+func (journal *Journal) Pending() bool {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	return journal.lastStart() >= 0
+}
+
+// ジャーナルを設定する。nilの場合は記録しない。
+func (gitInfo *GitInfo) SetJournal(journal *Journal) {
+	gitInfo.journal = journal
+}
+
+func (journal *Journal) append(record *journalRecord) error {
+	if journal == nil {
+		return nil
+	}
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := journal.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error occured when write journal %s. %w", journal.path, err)
+	}
+	journal.records = append(journal.records, record)
+	return nil
+}
+
+// 最後のstartレコードの位置を返す。ない場合は-1
+func (journal *Journal) lastStart() int {
+	for i := len(journal.records) - 1; i >= 0; i-- {
+		if journal.records[i].Type == "start" {
+			return i
+		}
+	}
+	return -1
+}
+
+// 同じリポジトリにアップロード済みのblobのsha
+func (journal *Journal) uploadedBlobs(provider Provider) map[string]bool {
+	uploaded := make(map[string]bool)
+	if journal == nil {
+		return uploaded
+	}
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	owner, repository, _ := provider.RepositoryInfo()
+	sameRepo := false
+	for _, record := range journal.records {
+		switch record.Type {
+		case "start":
+			sameRepo = record.Owner == owner && record.Repository == repository
+		case "blob":
+			if sameRepo {
+				uploaded[record.Sha] = true
+			}
+		}
+	}
+	return uploaded
+}
+
+func (journal *Journal) recordStart(provider Provider, baseCommit string, groups int) error {
+	owner, repository, branch := provider.RepositoryInfo()
+	return journal.append(&journalRecord{Type: "start", Owner: owner, Repository: repository, Branch: branch, BaseCommit: baseCommit, Groups: groups})
+}
+
+func (journal *Journal) recordPlan(group int, message string, baseTreeSha string, changeList []*fileChange, uploaded map[string]bool) error {
+	if journal == nil {
+		return nil
+	}
+	record := &journalRecord{Type: "plan", Group: group, Message: message, BaseTree: baseTreeSha}
+	for _, change := range changeList {
+		if change.action == ActionUnchanged {
+			continue
+		}
+		entry := &journalEntry{
+			Path:      change.path,
+			Action:    change.action,
+			Mode:      change.mode,
+			Type:      change.objType,
+			Sha:       change.sha,
+			LocalPath: change.localPath,
+			Eol:       string(change.eol),
+			Upload:    needsUpload(change, uploaded),
+		}
+		if change.action == ActionDelete {
+			entry.Mode = change.baseEntry.Mode
+			entry.Type = change.baseEntry.Type
+		}
+		record.Changes = append(record.Changes, entry)
+	}
+	return journal.append(record)
+}
+
+func (journal *Journal) recordBlob(path string, sha string) error {
+	return journal.append(&journalRecord{Type: "blob", Path: path, Sha: sha})
+}
+
+func (journal *Journal) recordTree(group int, sha string) error {
+	return journal.append(&journalRecord{Type: "tree", Group: group, Sha: sha})
+}
+
+func (journal *Journal) recordCommit(group int, resp *githubapi.CreateCommitResponse) error {
+	if journal == nil {
+		return nil
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return journal.append(&journalRecord{Type: "commit", Group: group, Sha: resp.Sha, Response: data})
+}
+
+// ブランチの更新まで完了したので記録を破棄する。
+// 破棄に失敗しても、次のResumeCommitでブランチが更新済みであることを確認して破棄する。
+func (journal *Journal) recordDone() error {
+	if journal == nil {
+		return nil
+	}
+	return journal.Reset()
+}
+
+// 最後のコミット作成の記録
+type journalRun struct {
+	start   *journalRecord
+	plans   map[int]*journalRecord
+	trees   map[int]string
+	commits map[int]*githubapi.CreateCommitResponse
+}
+
+func (journal *Journal) lastRun() (*journalRun, error) {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	index := journal.lastStart()
+	if index < 0 {
+		return nil, ErrNothingToResume
+	}
+	run := &journalRun{
+		start:   journal.records[index],
+		plans:   make(map[int]*journalRecord),
+		trees:   make(map[int]string),
+		commits: make(map[int]*githubapi.CreateCommitResponse),
+	}
+	for _, record := range journal.records[index+1:] {
+		switch record.Type {
+		case "plan":
+			run.plans[record.Group] = record
+		case "tree":
+			run.trees[record.Group] = record.Sha
+		case "commit":
+			resp := &githubapi.CreateCommitResponse{}
+			if err := json.Unmarshal(record.Response, resp); err != nil {
+				return nil, fmt.Errorf("invalid commit record in journal. %w", err)
+			}
+			run.commits[record.Group] = resp
+		}
+	}
+	return run, nil
+}
+
+// ジャーナルに記録された最後のコミット作成を、最後に完了した段階から再開する。
+// アップロードが済んでいないblobはローカルファイルから読み込み、内容が変わっている場合はエラーにする。
+// 記録後にブランチが他のコミットで更新されていた場合はErrBranchMovedを返すので、元の操作からやり直すこと。
+func (gitInfo *GitInfo) ResumeCommit() ([]*githubapi.CreateCommitResponse, error) {
+	journal := gitInfo.journal
+	if journal == nil {
+		return nil, errors.New("journal is not set.")
+	}
+	run, err := journal.lastRun()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := gitInfo.objectProvider(); err != nil {
+		return nil, err
+	}
+	if gitInfo.stagesObjects() {
+		//記録したtreeやcommitはpushしていなければリモートに存在しない
+		return nil, ErrNotSupported
+	}
+	owner, repository, branch := gitInfo.provider.RepositoryInfo()
+	if run.start.Owner != owner || run.start.Repository != repository || run.start.Branch != branch {
+		return nil, fmt.Errorf("journal is for %s/%s %s.", run.start.Owner, run.start.Repository, run.start.Branch)
+	}
+
+	head, err := gitInfo.getBranchHead()
+	if err != nil {
+		return nil, err
+	}
+	if last, ok := run.commits[run.start.Groups]; ok && head.commitSha == last.Sha {
+		//ブランチの更新後に終了していた
+		journal.recordDone()
+		return run.commitList(), nil
+	}
+	if head.commitSha != run.start.BaseCommit {
+		return nil, fmt.Errorf("branch is at %s but the journal was written for %s. %w", head.commitSha, run.start.BaseCommit, ErrBranchMoved)
+	}
+
+	uploaded := journal.uploadedBlobs(gitInfo.provider)
+	progress := gitInfo.newProgressReporter(run.start.Groups, 1)
+	parentSha := run.start.BaseCommit
+	var respList []*githubapi.CreateCommitResponse
+	for group := 1; group <= run.start.Groups; group++ {
+		if progress != nil {
+			progress.group = group
+		}
+		if resp, ok := run.commits[group]; ok {
+			respList = append(respList, resp)
+			parentSha = resp.Sha
+			continue
+		}
+		plan, ok := run.plans[group]
+		if !ok {
+			return nil, fmt.Errorf("changes of commit %d are not recorded. run the commit again. %w", group, ErrNothingToResume)
+		}
+		treeSha, ok := run.trees[group]
+		if !ok {
+			changeList, err := plan.fileChanges(uploaded)
+			if err != nil {
+				return nil, err
+			}
+			treeSha, err = gitInfo.writeTree(newBaseTree(gitInfo.provider, plan.BaseTree), changeList, uploaded, progress)
+			if err != nil {
+				return nil, err
+			}
+			if err := journal.recordTree(group, treeSha); err != nil {
+				return nil, err
+			}
+		}
+		progress.step(PhaseCommit, false)
+		resp, err := gitInfo.writeCommit(plan.Message, treeSha, parentSha)
+		if err != nil {
+			return nil, err
+		}
+		if err := journal.recordCommit(group, resp); err != nil {
+			return nil, err
+		}
+		progress.step(PhaseCommit, true)
+		respList = append(respList, resp)
+		parentSha = resp.Sha
+	}
+
+	progress.step(PhaseRef, false)
+	if err := gitInfo.updateBranchRef(parentSha, run.start.BaseCommit); err != nil {
+		return nil, err
+	}
+	progress.step(PhaseRef, true)
+	journal.recordDone()
+	return respList, nil
+}
+
+func (run *journalRun) commitList() []*githubapi.CreateCommitResponse {
+	var respList []*githubapi.CreateCommitResponse
+	for group := 1; group <= run.start.Groups; group++ {
+		respList = append(respList, run.commits[group])
+	}
+	return respList
+}
+
+// planの記録からtree作成用の変更内容を復元する
+func (plan *journalRecord) fileChanges(uploaded map[string]bool) ([]*fileChange, error) {
+	var changeList []*fileChange
+	for _, entry := range plan.Changes {
+		change := &fileChange{
+			path:    entry.Path,
+			mode:    entry.Mode,
+			objType: entry.Type,
+			sha:     entry.Sha,
+			action:  entry.Action,
+			size:    -1,
+		}
+		if entry.Action == ActionDelete {
+			change.sha = ""
+			change.baseEntry = &githubapi.TreeEntryElement{Path: entry.Path, Mode: entry.Mode, Type: entry.Type, Sha: entry.Sha}
+		}
+		if entry.Upload && !uploaded[entry.Sha] {
+			if entry.LocalPath == "" {
+				return nil, fmt.Errorf("content of %s was not uploaded and is not a local file. run the commit again. %w", entry.Path, ErrNothingToResume)
+			}
+			localPath, expected, eol := entry.LocalPath, entry.Sha, eolConversion(entry.Eol)
+			load := func() ([]byte, error) {
+				data, err := os.ReadFile(localPath)
+				if err != nil {
+					return nil, err
+				}
+				return normalizeEol(data, eol), nil
+			}
+			data, err := load()
+			if err != nil {
+				return nil, fmt.Errorf("error occured when read %s. %w", localPath, err)
+			}
+			if hashBlob(data) != expected {
+				return nil, fmt.Errorf("%s was changed after the journal was written. run the commit again.", localPath)
+			}
+			change.size = len(data)
+			change.load = load
+		}
+		changeList = append(changeList, change)
+	}
+	return changeList, nil
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	gitobj "github.com/daze-doragon/go-gituse/pkg/gitobj"
+)
+
+// ローカルのbareリポジトリのProvider。gitコマンドを使わずにオブジェクトを書き込み、ブランチのrefをロックして更新する。
+// RepositoryInfoのownerは空、repositoryはリポジトリのパスを返す。
+type localProvider struct {
+	repo   *gitobj.Repository
+	branch string
+}
+
+// ローカルのbareリポジトリからProviderを作成する。branchが空の場合はHEADが指すブランチを使う
+func NewLocalProvider(repo *gitobj.Repository, branch string) ObjectProvider {
+	if branch == "" {
+		branch, _ = repo.HeadBranch()
+	}
+	if branch == "" {
+		branch = "main"
+	}
+	return &localProvider{repo: repo, branch: branch}
+}
+
+// パスを指定してローカルのbareリポジトリに接続するGitInfoを作成する。リポジトリはgitobj.InitBareで作成できる
+func GetGitInfoByLocalRepository(path string, branch string, author string, email string) (*GitInfo, error) {
+	repo, err := gitobj.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error occured when open the repository. %w", err)
+	}
+	return GetGitInfoByProvider(NewLocalProvider(repo, branch), author, email)
+}
+
+func (provider *localProvider) RepositoryInfo() (string, string, string) {
+	return "", provider.repo.Path, provider.branch
+}
+
+func (provider *localProvider) BranchHead() (string, string, error) {
+	commitSha, err := provider.repo.ReadRef("refs/heads/" + provider.branch)
+	if err != nil {
+		return "", "", fmt.Errorf("error occured when read the branch. %w", err)
+	}
+	if commitSha == "" {
+		return "", "", nil
+	}
+	commit, err := provider.repo.ReadCommit(commitSha)
+	if err != nil {
+		return "", "", fmt.Errorf("error occured when read the latest commit. %w", err)
+	}
+	return commitSha, commit.Tree, nil
+}
+
+func (provider *localProvider) GetTree(sha string, recursive bool) (*githubapi.GetTreeResponse, error) {
+	treeResp := &githubapi.GetTreeResponse{Sha: sha}
+	var walk func(treeSha string, prefix string) error
+	walk = func(treeSha string, prefix string) error {
+		entries, err := provider.repo.ReadTree(treeSha)
+		if err != nil {
+			return fmt.Errorf("error occured when read tree %s. %w", treeSha, err)
+		}
+		for _, entry := range entries {
+			element := &githubapi.TreeEntryElement{
+				Path: prefix + entry.Name,
+				Mode: entry.Mode,
+				Type: entry.Type(),
+				Sha:  entry.Sha,
+			}
+			if element.Type == gitobj.TypeBlob {
+				if _, element.Size, err = provider.repo.ObjectInfo(entry.Sha); err != nil {
+					return fmt.Errorf("error occured when read blob %s. %w", entry.Sha, err)
+				}
+			}
+			treeResp.Tree = append(treeResp.Tree, element)
+			if recursive && element.Type == gitobj.TypeTree {
+				if err := walk(entry.Sha, element.Path+"/"); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(sha, ""); err != nil {
+		return nil, err
+	}
+	return treeResp, nil
+}
+
+func (provider *localProvider) GetBlob(sha string) (*githubapi.BlobResponse, error) {
+	objType, data, err := provider.repo.ReadObject(sha)
+	if err != nil {
+		return nil, err
+	}
+	if objType != gitobj.TypeBlob {
+		return nil, fmt.Errorf("%s is not a blob.", sha)
+	}
+	return &githubapi.BlobResponse{
+		Sha:      sha,
+		Size:     len(data),
+		Content:  base64.StdEncoding.EncodeToString(data),
+		Encoding: "base64",
+	}, nil
+}
+
+func (provider *localProvider) ListBranches() ([]*githubapi.BranchResponse, error) {
+	names, refs, err := provider.repo.ListRefs("refs/heads/")
+	if err != nil {
+		return nil, err
+	}
+	var branchList []*githubapi.BranchResponse
+	for _, name := range names {
+		branch := &githubapi.BranchResponse{Name: strings.TrimPrefix(name, "refs/heads/")}
+		branch.Commit.Sha = refs[name]
+		branchList = append(branchList, branch)
+	}
+	return branchList, nil
+}
+
+func (provider *localProvider) IsExistRepo() (bool, error) {
+	_, err := os.Stat(filepath.Join(provider.repo.Path, "HEAD"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (provider *localProvider) PutBlob(data []byte) (string, error) {
+	return provider.repo.WriteObject(gitobj.TypeBlob, data)
+}
+
+func (provider *localProvider) PutTree(baseTreeSha string, entries []*githubapi.TreeDataElement) (string, error) {
+	return editTree(provider, baseTreeSha, entries)
+}
+
+func (provider *localProvider) readTree(sha string) ([]*gitobj.TreeEntry, error) {
+	return provider.repo.ReadTree(sha)
+}
+
+// 存在しないオブジェクトを参照するtreeは作成しない
+func (provider *localProvider) writeTree(entries []*gitobj.TreeEntry) (string, error) {
+	for _, entry := range entries {
+		if entry.Type() != gitobj.TypeCommit && !provider.repo.HasObject(entry.Sha) {
+			return "", fmt.Errorf("%s: object %s does not exist.", entry.Name, entry.Sha)
+		}
+	}
+	return provider.repo.WriteTree(entries)
+}
+
+func (provider *localProvider) PutCommit(commitData *githubapi.CommitData) (*githubapi.CreateCommitResponse, error) {
+	if _, err := provider.repo.ReadTree(commitData.Tree); err != nil {
+		return nil, fmt.Errorf("error occured when read tree %s. %w", commitData.Tree, err)
+	}
+	for _, parent := range commitData.Parents {
+		if _, err := provider.repo.ReadCommit(parent); err != nil {
+			return nil, fmt.Errorf("error occured when read parent %s. %w", parent, err)
+		}
+	}
+	commit, err := makeCommitObject(commitData)
+	if err != nil {
+		return nil, err
+	}
+	sha, err := provider.repo.WriteCommit(commit)
+	if err != nil {
+		return nil, err
+	}
+	return commitObjectResponse(sha, commit), nil
+}
+
+func (provider *localProvider) UpdateBranch(commitSha string, previousSha string) error {
+	err := provider.repo.UpdateRef("refs/heads/"+provider.branch, commitSha, previousSha)
+	if errors.Is(err, gitobj.ErrRefMoved) {
+		return fmt.Errorf("error occured when update ref. %w %s", ErrBranchMoved, err)
+	}
+	if err != nil {
+		return fmt.Errorf("error occured when update ref. %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// ファイルまたはディレクトリを移動するCommitElementを作成する。既存のblobを再利用するためアップロードは発生しない。
+func MakeCommitElementForMove(fromPath string, toPath string) (*CommitElement, error) {
+	return makeCommitElementForMoveOrCopy(fromPath, toPath, true)
+}
+
+// ファイルまたはディレクトリをコピーするCommitElementを作成する。既存のblobを再利用するためアップロードは発生しない。
+func MakeCommitElementForCopy(fromPath string, toPath string) (*CommitElement, error) {
+	return makeCommitElementForMoveOrCopy(fromPath, toPath, false)
+}
+
+func makeCommitElementForMoveOrCopy(fromPath string, toPath string, removeSource bool) (*CommitElement, error) {
+	fromPath = strings.Trim(fromPath, "/")
+	toPath = strings.Trim(toPath, "/")
+	if fromPath == "" || toPath == "" {
+		return nil, errors.New("fromPath and toPath must not be empty.")
+	}
+	if fromPath == toPath {
+		return nil, errors.New("fromPath and toPath are the same.")
+	}
+	if strings.HasPrefix(toPath, fromPath+"/") {
+		return nil, errors.New("toPath must not be inside fromPath.")
+	}
+	element := &CommitElement{
+		pathInRepo:   toPath,
+		sourcePath:   fromPath,
+		removeSource: removeSource,
+	}
+	return element, nil
+}
+
+// 移動・コピーのCommitElementを変更内容に変換する。ディレクトリの場合は配下のファイルを全て対象にする。
+func prepareMoveChanges(base *baseTree, element *CommitElement) ([]*fileChange, error) {
+	sourceList, err := lookupFiles(base, element.sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(sourceList) == 0 {
+		return nil, fmt.Errorf("%s does not exist in branch.", element.sourcePath)
+	}
+
+	var changeList []*fileChange
+	for _, source := range sourceList {
+		destPath := element.pathInRepo + strings.TrimPrefix(source.Path, element.sourcePath)
+		change := &fileChange{
+			path:    destPath,
+			mode:    source.Mode,
+			objType: source.Type,
+			sha:     source.Sha,
+			size:    source.Size,
+		}
+		if err := change.compareWithBase(base); err != nil {
+			return nil, err
+		}
+		changeList = append(changeList, change)
+		if element.removeSource {
+			changeList = append(changeList, &fileChange{
+				path:      source.Path,
+				size:      -1,
+				action:    ActionDelete,
+				baseEntry: source,
+			})
+		}
+	}
+	return changeList, nil
+}
+
+// パスに対応するファイルを返す。ディレクトリの場合は配下のファイルを全て返す。存在しない場合は空。
+func lookupFiles(base *baseTree, repoPath string) ([]*githubapi.TreeEntryElement, error) {
+	var entry *githubapi.TreeEntryElement
+	if strings.Trim(repoPath, "/") == "" {
+		//ルートの場合はリポジトリ全体
+		if base.rootSha == "" {
+			return nil, nil
+		}
+		entry = &githubapi.TreeEntryElement{Type: "tree", Sha: base.rootSha}
+	} else {
+		var err error
+		entry, err = base.lookup(repoPath)
+		if err != nil || entry == nil {
+			return nil, err
+		}
+	}
+	if entry.Type != "tree" {
+		return []*githubapi.TreeEntryElement{{
+			Path: strings.Trim(repoPath, "/"),
+			Mode: entry.Mode,
+			Type: entry.Type,
+			Sha:  entry.Sha,
+			Size: entry.Size,
+		}}, nil
+	}
+	children, err := base.listRecursive(entry.Sha)
+	if err != nil {
+		return nil, err
+	}
+	var fileList []*githubapi.TreeEntryElement
+	for _, child := range children {
+		if child.Type == "tree" {
+			continue
+		}
+		fileList = append(fileList, &githubapi.TreeEntryElement{
+			Path: strings.TrimPrefix(path.Join(strings.Trim(repoPath, "/"), child.Path), "/"),
+			Mode: child.Mode,
+			Type: child.Type,
+			Sha:  child.Sha,
+			Size: child.Size,
+		})
+	}
+	return fileList, nil
+}
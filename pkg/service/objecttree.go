@@ -0,0 +1,207 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	gitobj "github.com/daze-doragon/go-gituse/pkg/gitobj"
+)
+
+// treeオブジェクトを読み書きする先。ローカルのリポジトリやpush前のオブジェクト
+type treeStore interface {
+	readTree(sha string) ([]*gitobj.TreeEntry, error)
+	writeTree(entries []*gitobj.TreeEntry) (string, error)
+}
+
+// 1階層分のtreeを作成できるProvider。変更のあるディレクトリだけを下から作り直し、変更のないディレクトリは元のshaを参照する
+type treeWriter interface {
+	writeTree(entries []*gitobj.TreeEntry) (string, error)
+}
+
+// コミット元のtreeをbaseTreeのキャッシュから読み込み、treeWriterで書き込むtreeStore
+type baseTreeStore struct {
+	base   *baseTree
+	writer treeWriter
+}
+
+func (store *baseTreeStore) readTree(sha string) ([]*gitobj.TreeEntry, error) {
+	list, err := store.base.entries(sha)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*gitobj.TreeEntry
+	for _, element := range list {
+		entries = append(entries, &gitobj.TreeEntry{Mode: element.Mode, Name: element.Path, Sha: element.Sha})
+	}
+	return entries, nil
+}
+
+func (store *baseTreeStore) writeTree(entries []*gitobj.TreeEntry) (string, error) {
+	return store.writer.writeTree(entries)
+}
+
+// baseのtreeにentriesを適用したtreeを作成する。treeWriterの場合は変更のあるディレクトリだけを作り直す
+func putTree(git ObjectProvider, base *baseTree, entries []*githubapi.TreeDataElement) (string, error) {
+	writer, ok := git.(treeWriter)
+	if !ok {
+		return git.PutTree(base.rootSha, entries)
+	}
+	return editTree(&baseTreeStore{base: base, writer: writer}, base.rootSha, entries)
+}
+
+// baseTreeShaのtreeにentriesを適用したtreeを作成する。Shaが空の要素はそのパスを削除する
+func editTree(store treeStore, baseTreeSha string, entries []*githubapi.TreeDataElement) (string, error) {
+	root := &treeNode{sha: baseTreeSha}
+	for _, entry := range entries {
+		parts := strings.Split(strings.Trim(entry.Path, "/"), "/")
+		deleting := entry.Sha == ""
+		node := root
+		for _, dir := range parts[:len(parts)-1] {
+			child, err := node.child(store, dir, !deleting)
+			if err != nil {
+				return "", err
+			}
+			node = child
+			if node == nil {
+				break
+			}
+		}
+		if node == nil {
+			//存在しないディレクトリ配下の削除
+			continue
+		}
+		if err := node.load(store); err != nil {
+			return "", err
+		}
+		name := parts[len(parts)-1]
+		delete(node.children, name)
+		if deleting {
+			delete(node.entries, name)
+		} else {
+			node.entries[name] = &gitobj.TreeEntry{Mode: entry.Mode, Name: name, Sha: entry.Sha}
+		}
+	}
+	treeSha, err := root.write(store)
+	if err != nil {
+		return "", err
+	}
+	if treeSha == "" {
+		//ルートは空でもtreeを作成する
+		return store.writeTree(nil)
+	}
+	return treeSha, nil
+}
+
+// editTreeで変更するディレクトリ。変更のないディレクトリは読み込まずに元のshaを使う
+type treeNode struct {
+	sha      string
+	entries  map[string]*gitobj.TreeEntry //nilの場合は未読み込み
+	children map[string]*treeNode
+}
+
+func (node *treeNode) load(store treeStore) error {
+	if node.entries != nil {
+		return nil
+	}
+	node.entries = make(map[string]*gitobj.TreeEntry)
+	node.children = make(map[string]*treeNode)
+	if node.sha == "" {
+		return nil
+	}
+	entries, err := store.readTree(node.sha)
+	if err != nil {
+		return fmt.Errorf("error occured when read tree %s. %w", node.sha, err)
+	}
+	for _, entry := range entries {
+		node.entries[entry.Name] = entry
+	}
+	return nil
+}
+
+// 子のディレクトリを返す。存在しない場合はcreateならば作成し、そうでなければnilを返す
+func (node *treeNode) child(store treeStore, name string, create bool) (*treeNode, error) {
+	if err := node.load(store); err != nil {
+		return nil, err
+	}
+	if child, ok := node.children[name]; ok {
+		return child, nil
+	}
+	var child *treeNode
+	if entry, ok := node.entries[name]; ok && entry.Type() == gitobj.TypeTree {
+		child = &treeNode{sha: entry.Sha}
+	} else if create {
+		//ファイルがある場合はディレクトリに置き換える
+		child = &treeNode{}
+	} else {
+		return nil, nil
+	}
+	node.children[name] = child
+	return child, nil
+}
+
+// 変更したディレクトリを書き込み、shaを返す。空になったディレクトリは空を返す
+func (node *treeNode) write(store treeStore) (string, error) {
+	if node.entries == nil {
+		return node.sha, nil
+	}
+	for name, child := range node.children {
+		childSha, err := child.write(store)
+		if err != nil {
+			return "", err
+		}
+		if childSha == "" {
+			delete(node.entries, name)
+		} else {
+			node.entries[name] = &gitobj.TreeEntry{Mode: "040000", Name: name, Sha: childSha}
+		}
+	}
+	if len(node.entries) == 0 {
+		return "", nil
+	}
+	var entries []*gitobj.TreeEntry
+	for _, entry := range node.entries {
+		entries = append(entries, entry)
+	}
+	return store.writeTree(entries)
+}
+
+// CommitDataからcommitの内容を作成する。作者の日時が空の場合は現在時刻、コミッターは作者と同じにする
+func makeCommitObject(commitData *githubapi.CommitData) (*gitobj.Commit, error) {
+	author := gitobj.Signature{When: time.Now()}
+	if commitData.Author != nil {
+		author.Name, author.Email = commitData.Author.Name, commitData.Author.Email
+		if commitData.Author.Date != "" {
+			when, err := time.Parse(time.RFC3339, commitData.Author.Date)
+			if err != nil {
+				return nil, fmt.Errorf("invalid commit date %s. %w", commitData.Author.Date, err)
+			}
+			author.When = when
+		}
+	}
+	return &gitobj.Commit{
+		Tree:      commitData.Tree,
+		Parents:   commitData.Parents,
+		Author:    author,
+		Committer: author,
+		Message:   commitData.Message,
+	}, nil
+}
+
+// 作成したcommitをCreateCommit APIのレスポンスの形式で返す
+func commitObjectResponse(sha string, commit *gitobj.Commit) *githubapi.CreateCommitResponse {
+	resp := &githubapi.CreateCommitResponse{Sha: sha, Message: commit.Message}
+	resp.Tree.Sha = commit.Tree
+	author, committer := commit.Author, commit.Committer
+	resp.Author.Name, resp.Author.Email, resp.Author.Date = author.Name, author.Email, author.When.Format(time.RFC3339)
+	resp.Commiter.Name, resp.Commiter.Email, resp.Commiter.Date = committer.Name, committer.Email, committer.When.Format(time.RFC3339)
+	for _, parent := range commit.Parents {
+		resp.Parents = append(resp.Parents, struct {
+			Sha      string `json:"sha"`
+			Url      string `json:"url"`
+			Html_url string `json:"html_url"`
+		}{Sha: parent})
+	}
+	return resp
+}
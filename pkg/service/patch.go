@@ -0,0 +1,459 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// unified diffの内、1ファイル分の変更を表現する構造体
+type FilePatch struct {
+	OldPath  string //新規ファイルの場合は空
+	NewPath  string //削除ファイルの場合は空
+	OldMode  string
+	NewMode  string
+	IsNew    bool
+	IsDelete bool
+	IsRename bool
+	IsCopy   bool
+	IsBinary bool
+	Hunks    []*Hunk
+}
+
+// unified diffの@@で始まる1ブロックを表現する構造体
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Header   string
+	Lines    []string //先頭文字(' ', '+', '-')付きの行
+	OldNoEOL bool     //変更前の最終行に改行がない
+	NewNoEOL bool     //変更後の最終行に改行がない
+}
+
+// hunk単位の適用結果
+type HunkResult struct {
+	Path     string
+	Hunk     int //1始まりのhunk番号。ファイル単位のエラーの場合は0
+	OldStart int
+	Applied  bool
+	Offset   int //記載位置から何行ずれた位置に適用したか
+	Reason   string
+}
+
+// パッチが適用できなかった場合のエラー。Resultsには全hunkの適用結果が入る。
+type PatchConflictError struct {
+	Results []*HunkResult
+}
+
+func (e *PatchConflictError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("patch does not apply.")
+	for _, result := range e.Results {
+		if result.Applied {
+			continue
+		}
+		if result.Hunk == 0 {
+			sb.WriteString(fmt.Sprintf("\n  %s: %s", result.Path, result.Reason))
+		} else {
+			sb.WriteString(fmt.Sprintf("\n  %s hunk #%d (line %d): %s", result.Path, result.Hunk, result.OldStart, result.Reason))
+		}
+	}
+	return sb.String()
+}
+
+var hunkHeaderRgx = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// git形式のunified diffを解析する。
+func ParsePatch(patch string) ([]*FilePatch, error) {
+	var fileList []*FilePatch
+	var current *FilePatch
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			oldPath, newPath := splitDiffGitPaths(strings.TrimPrefix(line, "diff --git "))
+			current = &FilePatch{OldPath: oldPath, NewPath: newPath}
+			fileList = append(fileList, current)
+		case current != nil && strings.HasPrefix(line, "old mode "):
+			current.OldMode = strings.TrimPrefix(line, "old mode ")
+		case current != nil && strings.HasPrefix(line, "new mode "):
+			current.NewMode = strings.TrimPrefix(line, "new mode ")
+		case current != nil && strings.HasPrefix(line, "new file mode "):
+			current.IsNew = true
+			current.NewMode = strings.TrimPrefix(line, "new file mode ")
+		case current != nil && strings.HasPrefix(line, "deleted file mode "):
+			current.IsDelete = true
+			current.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+		case current != nil && strings.HasPrefix(line, "rename from "):
+			current.IsRename = true
+			current.OldPath = strings.TrimPrefix(line, "rename from ")
+		case current != nil && strings.HasPrefix(line, "rename to "):
+			current.IsRename = true
+			current.NewPath = strings.TrimPrefix(line, "rename to ")
+		case current != nil && strings.HasPrefix(line, "copy from "):
+			current.IsCopy = true
+			current.OldPath = strings.TrimPrefix(line, "copy from ")
+		case current != nil && strings.HasPrefix(line, "copy to "):
+			current.IsCopy = true
+			current.NewPath = strings.TrimPrefix(line, "copy to ")
+		case current != nil && strings.HasPrefix(line, "index "):
+			//index abc..def 100644 の形式ではモードも記載される
+			fields := strings.Fields(line)
+			if len(fields) == 3 && current.OldMode == "" && current.NewMode == "" {
+				current.OldMode = fields[2]
+				current.NewMode = fields[2]
+			}
+		case current != nil && (strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch"):
+			current.IsBinary = true
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			oldPath := parsePatchFilePath(strings.TrimPrefix(line, "--- "))
+			newPath := parsePatchFilePath(strings.TrimPrefix(lines[i+1], "+++ "))
+			if current == nil || len(current.Hunks) > 0 {
+				//diff --gitヘッダのない通常のunified diff
+				current = &FilePatch{OldPath: oldPath, NewPath: newPath}
+				fileList = append(fileList, current)
+			}
+			if oldPath == "" {
+				current.IsNew = true
+				current.OldPath = ""
+			} else {
+				current.OldPath = oldPath
+			}
+			if newPath == "" {
+				current.IsDelete = true
+				current.NewPath = ""
+			} else {
+				current.NewPath = newPath
+			}
+			i++
+		case strings.HasPrefix(line, "@@ "):
+			if current == nil {
+				return nil, fmt.Errorf("hunk without file header at line %d.", i+1)
+			}
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			current.Hunks = append(current.Hunks, hunk)
+			i = next - 1
+		}
+	}
+	for _, filePatch := range fileList {
+		if filePatch.IsNew {
+			filePatch.OldPath = ""
+		}
+		if filePatch.IsDelete {
+			filePatch.NewPath = ""
+		}
+	}
+	if len(fileList) == 0 {
+		return nil, errors.New("no file changes found in patch.")
+	}
+	return fileList, nil
+}
+
+// linesのstart行目から始まるhunkを解析する。戻り値のnextはhunkの次の行番号。
+func parseHunk(lines []string, start int) (*Hunk, int, error) {
+	match := hunkHeaderRgx.FindStringSubmatch(lines[start])
+	if match == nil {
+		return nil, 0, fmt.Errorf("invalid hunk header at line %d. %s", start+1, lines[start])
+	}
+	hunk := &Hunk{Header: match[5]}
+	hunk.OldStart, _ = strconv.Atoi(match[1])
+	hunk.OldLines = 1
+	if match[2] != "" {
+		hunk.OldLines, _ = strconv.Atoi(match[2])
+	}
+	hunk.NewStart, _ = strconv.Atoi(match[3])
+	hunk.NewLines = 1
+	if match[4] != "" {
+		hunk.NewLines, _ = strconv.Atoi(match[4])
+	}
+
+	oldRemain, newRemain := hunk.OldLines, hunk.NewLines
+	i := start + 1
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, `\`) {
+			//"\ No newline at end of file" は直前の行に対する注記
+			if len(hunk.Lines) > 0 {
+				switch hunk.Lines[len(hunk.Lines)-1][0] {
+				case '-':
+					hunk.OldNoEOL = true
+				case '+':
+					hunk.NewNoEOL = true
+				default:
+					hunk.OldNoEOL = true
+					hunk.NewNoEOL = true
+				}
+			}
+			continue
+		}
+		if oldRemain == 0 && newRemain == 0 {
+			break
+		}
+		if line == "" {
+			//空行のコンテキスト行は先頭の空白が落ちていることがある
+			line = " "
+		}
+		switch line[0] {
+		case ' ':
+			oldRemain--
+			newRemain--
+		case '-':
+			oldRemain--
+		case '+':
+			newRemain--
+		default:
+			return nil, 0, fmt.Errorf("invalid line in hunk at line %d. %s", i+1, line)
+		}
+		if oldRemain < 0 || newRemain < 0 {
+			return nil, 0, fmt.Errorf("hunk line count mismatch at line %d.", i+1)
+		}
+		hunk.Lines = append(hunk.Lines, line)
+	}
+	if oldRemain != 0 || newRemain != 0 {
+		return nil, 0, fmt.Errorf("hunk at line %d is truncated.", start+1)
+	}
+	return hunk, i, nil
+}
+
+// "diff --git a/x b/y" のパス部分を分割する
+func splitDiffGitPaths(s string) (string, string) {
+	if strings.HasPrefix(s, "a/") {
+		if idx := strings.LastIndex(s, " b/"); idx >= 0 {
+			return s[2:idx], s[idx+3:]
+		}
+	}
+	fields := strings.Fields(s)
+	if len(fields) == 2 {
+		return fields[0], fields[1]
+	}
+	return s, s
+}
+
+// ---/+++ 行のパスを取り出す。/dev/nullの場合は空文字を返す。
+func parsePatchFilePath(s string) string {
+	if idx := strings.Index(s, "\t"); idx >= 0 {
+		s = s[:idx]
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		return s[2:]
+	}
+	return s
+}
+
+// ファイルの内容にhunkを適用する。適用できないhunkがあった場合はokがfalseになる。
+func applyHunks(path string, content []byte, hunks []*Hunk) ([]byte, []*HunkResult, bool) {
+	text := string(content)
+	noEOL := len(text) > 0 && !strings.HasSuffix(text, "\n")
+	var lines []string
+	if text != "" {
+		lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+
+	var results []*HunkResult
+	var resultLines []string
+	ok := true
+	cursor := 0
+	drift := 0
+	for idx, hunk := range hunks {
+		var oldLines, newLines []string
+		for _, line := range hunk.Lines {
+			switch line[0] {
+			case ' ':
+				oldLines = append(oldLines, line[1:])
+				newLines = append(newLines, line[1:])
+			case '-':
+				oldLines = append(oldLines, line[1:])
+			case '+':
+				newLines = append(newLines, line[1:])
+			}
+		}
+		expected := hunk.OldStart - 1
+		if hunk.OldLines == 0 {
+			expected = hunk.OldStart
+		}
+		expected += drift
+		result := &HunkResult{Path: path, Hunk: idx + 1, OldStart: hunk.OldStart}
+		results = append(results, result)
+
+		at := findHunkPosition(lines, oldLines, expected, cursor)
+		if at < 0 {
+			ok = false
+			result.Reason = "context does not match."
+			continue
+		}
+		result.Applied = true
+		result.Offset = at - expected
+		drift += result.Offset
+		resultLines = append(resultLines, lines[cursor:at]...)
+		resultLines = append(resultLines, newLines...)
+		cursor = at + len(oldLines)
+		if cursor == len(lines) {
+			noEOL = hunk.NewNoEOL
+		}
+	}
+	if !ok {
+		return nil, results, false
+	}
+	resultLines = append(resultLines, lines[cursor:]...)
+	if len(resultLines) == 0 {
+		return []byte{}, results, true
+	}
+	out := strings.Join(resultLines, "\n")
+	if !noEOL {
+		out += "\n"
+	}
+	return []byte(out), results, true
+}
+
+// oldLinesが一致する位置をexpectedの近い順に探す。見つからない場合は-1を返す。
+func findHunkPosition(lines []string, oldLines []string, expected int, min int) int {
+	max := len(lines) - len(oldLines)
+	if max < min {
+		return -1
+	}
+	matchAt := func(at int) bool {
+		if at < min || at > max {
+			return false
+		}
+		for i, line := range oldLines {
+			if lines[at+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+	for delta := 0; expected-delta >= min || expected+delta <= max; delta++ {
+		if matchAt(expected - delta) {
+			return expected - delta
+		}
+		if delta != 0 && matchAt(expected+delta) {
+			return expected + delta
+		}
+	}
+	return -1
+}
+
+// unified diffをブランチの最新コミットに適用してコミットを作成する。コンフリクトした場合は*PatchConflictErrorを返す。
+// パッチはコミットを作成するたびにその時点のブランチに適用するため、ブランチが更新されて作り直す場合も他のコミットの変更を上書きしない。
+func (gitInfo *GitInfo) CreateCommitByPatch(commitMsg string, patch string) (*githubapi.CreateCommitResponse, error) {
+	fileList, err := ParsePatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("error occured when parse patch. %w", err)
+	}
+	return gitInfo.CreateCommitByElement(commitMsg, []*CommitElement{{patch: fileList}})
+}
+
+// パッチの要素をbaseに適用し、パス単位の変更内容に変換する
+func preparePatchChanges(base *baseTree, element *CommitElement) ([]*fileChange, error) {
+	elementList, err := makeCommitElementListByPatch(base, element.patch)
+	if err != nil {
+		return nil, err
+	}
+	return prepareChanges(base, elementList, nil, false, nil)
+}
+
+// 解析したパッチをbaseに適用し、CommitElementを作成する
+func makeCommitElementListByPatch(base *baseTree, fileList []*FilePatch) ([]*CommitElement, error) {
+	var elementList []*CommitElement
+	var results []*HunkResult
+	conflict := false
+	fileError := func(path string, reason string) {
+		conflict = true
+		results = append(results, &HunkResult{Path: path, Reason: reason})
+	}
+
+	for _, filePatch := range fileList {
+		path := filePatch.NewPath
+		if filePatch.IsDelete {
+			path = filePatch.OldPath
+		}
+		if filePatch.IsBinary {
+			fileError(path, "binary patch is not supported.")
+			continue
+		}
+
+		//変更前のファイルを取得
+		var content []byte
+		var baseEntry *githubapi.TreeEntryElement
+		if !filePatch.IsNew {
+			entry, err := base.lookup(filePatch.OldPath)
+			if err != nil {
+				return nil, err
+			}
+			if entry == nil || entry.Type != "blob" {
+				fileError(filePatch.OldPath, "file does not exist in branch.")
+				continue
+			}
+			baseEntry = entry
+			if len(filePatch.Hunks) > 0 {
+				content, err = base.readBlob(entry.Sha)
+				if err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			entry, err := base.lookup(filePatch.NewPath)
+			if err != nil {
+				return nil, err
+			}
+			if entry != nil {
+				fileError(filePatch.NewPath, "file already exists in branch.")
+				continue
+			}
+		}
+
+		//hunkを適用
+		patched, hunkResults, ok := applyHunks(path, content, filePatch.Hunks)
+		results = append(results, hunkResults...)
+		if !ok {
+			conflict = true
+			continue
+		}
+
+		if filePatch.IsDelete {
+			if len(patched) != 0 {
+				fileError(path, "deleted file patch does not remove the whole content.")
+				continue
+			}
+			elementList = append(elementList, &CommitElement{pathInRepo: path, deleted: true})
+			continue
+		}
+
+		mode := filePatch.NewMode
+		if mode == "" && baseEntry != nil {
+			mode = baseEntry.Mode
+		}
+		element := &CommitElement{
+			pathInRepo: filePatch.NewPath,
+			mode:       mode,
+		}
+		if len(filePatch.Hunks) == 0 && baseEntry != nil {
+			//内容に変更がない場合(モード変更、リネーム)は既存のblobを使う
+			element.blobSha = baseEntry.Sha
+		} else {
+			element.data = patched
+		}
+		elementList = append(elementList, element)
+		if filePatch.IsRename {
+			elementList = append(elementList, &CommitElement{pathInRepo: filePatch.OldPath, deleted: true})
+		}
+	}
+	if conflict {
+		return nil, &PatchConflictError{Results: results}
+	}
+	return elementList, nil
+}
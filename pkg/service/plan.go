@@ -0,0 +1,389 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// パス単位の変更の種類
+type PlanAction string
+
+const (
+	ActionAdd        PlanAction = "add"
+	ActionModify     PlanAction = "modify"
+	ActionDelete     PlanAction = "delete"
+	ActionUnchanged  PlanAction = "unchanged"
+	ActionModeChange PlanAction = "mode change"
+)
+
+// コミットを作成した場合に行われる変更の一覧
+type CommitPlan struct {
+	Owner         string
+	Repository    string
+	Branch        string
+	Message       string
+	BaseCommitSha string //空のリポジトリの場合は空
+	BaseTreeSha   string
+	Entries       []*PlanEntry
+}
+
+// パス単位の変更内容。Old*は変更前、New*は変更後の値で、存在しない場合は空(サイズは-1)。
+type PlanEntry struct {
+	Path    string
+	Action  PlanAction
+	OldMode string
+	NewMode string
+	OldSha  string
+	NewSha  string
+	OldSize int
+	NewSize int
+}
+
+// CommitElementをbaseに対して評価した、パス単位の変更内容
+type fileChange struct {
+	path      string
+	mode      string
+	objType   string
+	sha       string                 //変更後のオブジェクトのsha(削除の場合は空)
+	size      int                    //変更後のサイズ。不明な場合は-1
+	load      func() ([]byte, error) //アップロードする内容を取得する。既存のblobを使う場合はnil
+	localPath string                 //loadがローカルファイルを読み込む場合のパス
+	eol       eolConversion          //loadがローカルファイルの改行を変換する方法
+	action    PlanAction
+	baseEntry *githubapi.TreeEntryElement //変更前のtree要素。存在しない場合はnil
+}
+
+// baseの同じパスの要素と比較してactionを決める
+func (change *fileChange) compareWithBase(base *baseTree) error {
+	entry, err := base.lookup(change.path)
+	if err != nil {
+		return err
+	}
+	change.baseEntry = entry
+	if change.mode == "" {
+		change.mode = "100644"
+		if entry != nil && entry.Type == "blob" {
+			change.mode = entry.Mode
+		}
+	}
+	if change.objType == "" {
+		change.objType = "blob"
+	}
+	switch {
+	case entry == nil:
+		change.action = ActionAdd
+	case entry.Sha == change.sha && entry.Mode == change.mode:
+		change.action = ActionUnchanged
+	case entry.Sha == change.sha:
+		change.action = ActionModeChange
+	default:
+		change.action = ActionModify
+	}
+	return nil
+}
+
+// CommitElement配列をbaseに対して評価し、パス単位の変更内容に変換する。APIへの書き込みは行わない。
+// cacheにshaがあるローカルファイルは読み込まない。normalizeの場合はローカルファイルと指定したデータの改行を.gitattributesに従って変換する。
+func prepareChanges(base *baseTree, elementList []*CommitElement, cache *BlobCache, normalize bool, progress *progressReporter) ([]*fileChange, error) {
+	var changeList []*fileChange
+	hashProgress := Progress{Phase: PhaseHash}
+	for _, element := range elementList {
+		if needsHash(element) {
+			hashProgress.Total++
+		}
+	}
+	progress.report(hashProgress)
+	modules := &gitmodulesFile{}
+	var attributes *gitattributes
+	if normalize {
+		attributes = newGitattributes(base, elementList)
+	}
+	for _, element := range elementList {
+		switch {
+		case element.patch != nil:
+			patchChangeList, err := preparePatchChanges(base, element)
+			if err != nil {
+				return nil, err
+			}
+			changeList = append(changeList, patchChangeList...)
+			continue
+		case element.submodule != nil:
+			change, err := prepareSubmoduleChange(base, element, modules)
+			if err != nil {
+				return nil, err
+			}
+			changeList = append(changeList, change)
+			continue
+		case element.deleted:
+			fileList, err := lookupFiles(base, element.pathInRepo)
+			if err != nil {
+				return nil, err
+			}
+			if len(fileList) == 0 {
+				//存在しないファイルの削除は何もしない
+				changeList = append(changeList, &fileChange{path: element.pathInRepo, size: -1, action: ActionUnchanged})
+			}
+			for _, file := range fileList {
+				changeList = append(changeList, &fileChange{path: file.Path, size: -1, action: ActionDelete, baseEntry: file})
+			}
+			continue
+		case element.mirrorKeep != nil:
+			//ローカルに存在しないファイルを削除する
+			fileList, err := lookupFiles(base, element.pathInRepo)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range fileList {
+				if !element.mirrorKeep[file.Path] {
+					changeList = append(changeList, &fileChange{path: file.Path, size: -1, action: ActionDelete, baseEntry: file})
+				}
+			}
+			continue
+		case element.sourcePath != "":
+			//移動・コピーは既存のblobをそのまま使う
+			moveChangeList, err := prepareMoveChanges(base, element)
+			if err != nil {
+				return nil, fmt.Errorf("error occured when resolve %s. %w", element.sourcePath, err)
+			}
+			changeList = append(changeList, moveChangeList...)
+			continue
+		}
+
+		change := &fileChange{
+			path: element.pathInRepo,
+			mode: element.mode,
+			sha:  element.blobSha,
+			size: -1,
+		}
+		if element.transform != nil {
+			//変換関数はコミットのたびに最新のファイル内容で評価する
+			data, _, err := transformContent(base, element)
+			if err != nil {
+				return nil, fmt.Errorf("error occured when transform %s. %w", element.pathInRepo, err)
+			}
+			change.sha = hashBlob(data)
+			change.size = len(data)
+			change.load = func() ([]byte, error) { return data, nil }
+		} else if element.blobSha == "" && element.pathInLocal != "" {
+			//ローカルファイルはメモリに保持せず、アップロード時に再度読み込む
+			localPath := element.pathInLocal
+			eol, err := attributes.conversion(element.pathInRepo)
+			if err != nil {
+				return nil, fmt.Errorf("error occured when read .gitattributes. %w", err)
+			}
+			change.localPath = localPath
+			change.eol = eol
+			change.load = func() ([]byte, error) {
+				data, err := os.ReadFile(localPath)
+				if err != nil {
+					return nil, err
+				}
+				return normalizeEol(data, eol), nil
+			}
+			var info os.FileInfo
+			if cache != nil {
+				var err error
+				info, err = os.Stat(localPath)
+				if err != nil {
+					return nil, fmt.Errorf("error occured when read %s. %w", element.pathInRepo, err)
+				}
+			}
+			if sha, size, ok := cache.lookup(localPath, info, eol); ok {
+				change.sha = sha
+				change.size = size
+			} else {
+				data, err := change.load()
+				if err != nil {
+					return nil, fmt.Errorf("error occured when read %s. %w", element.pathInRepo, err)
+				}
+				change.sha = hashBlob(data)
+				change.size = len(data)
+				if info != nil {
+					cache.store(localPath, info, eol, change.sha, change.size)
+				}
+			}
+		} else if element.blobSha == "" && element.fsys != nil {
+			//fs.FSのファイルもメモリに保持せず、アップロード時に再度読み込む
+			fsys, name := element.fsys, element.pathInFS
+			eol, err := attributes.conversion(element.pathInRepo)
+			if err != nil {
+				return nil, fmt.Errorf("error occured when read .gitattributes. %w", err)
+			}
+			change.load = func() ([]byte, error) {
+				data, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					return nil, err
+				}
+				return normalizeEol(data, eol), nil
+			}
+			data, err := change.load()
+			if err != nil {
+				return nil, fmt.Errorf("error occured when read %s. %w", element.pathInRepo, err)
+			}
+			change.sha = hashBlob(data)
+			change.size = len(data)
+		} else if element.blobSha == "" {
+			data, err := readElementContent(element)
+			if err != nil {
+				return nil, fmt.Errorf("error occured when read %s. %w", element.pathInRepo, err)
+			}
+			if element.mode != "120000" {
+				//シンボリックリンクのリンク先は変換しない
+				eol, err := attributes.conversion(element.pathInRepo)
+				if err != nil {
+					return nil, fmt.Errorf("error occured when read .gitattributes. %w", err)
+				}
+				data = normalizeEol(data, eol)
+			}
+			change.sha = hashBlob(data)
+			change.size = len(data)
+			change.load = func() ([]byte, error) { return data, nil }
+		}
+		if needsHash(element) {
+			hashProgress.Current++
+			hashProgress.Bytes += int64(change.size)
+			hashProgress.Path = change.path
+			progress.report(hashProgress)
+		}
+		if err := change.compareWithBase(base); err != nil {
+			return nil, err
+		}
+		changeList = append(changeList, change)
+	}
+	if modules.changed {
+		//サブモジュールの追加やurlの変更は.gitmodulesの変更にまとめる
+		for _, change := range changeList {
+			if change.path == gitmodulesPath {
+				return nil, errors.New(".gitmodules is changed by both a submodule and another element.")
+			}
+		}
+		change, err := modules.fileChange(base)
+		if err != nil {
+			return nil, err
+		}
+		changeList = append(changeList, change)
+	}
+	return changeList, nil
+}
+
+// 内容を読み込んでshaを計算する要素かを返す
+func needsHash(element *CommitElement) bool {
+	if element.deleted || element.mirrorKeep != nil || element.sourcePath != "" || element.submodule != nil || element.patch != nil {
+		return false
+	}
+	return element.transform != nil || element.blobSha == ""
+}
+
+// CommitElement配列でコミットを作成した場合の変更内容を返す。blob、tree、commit、refは作成しない。
+func (gitInfo *GitInfo) PlanCommitByElement(commitMsg string, elementList []*CommitElement) (*CommitPlan, error) {
+	head, err := gitInfo.getBranchHead()
+	if err != nil {
+		return nil, err
+	}
+	base := newBaseTree(gitInfo.provider, head.treeSha)
+	changeList, err := prepareChanges(base, elementList, gitInfo.blobCache, gitInfo.normalizeEol, gitInfo.newProgressReporter(1, 1))
+	if err != nil {
+		return nil, err
+	}
+	owner, repository, branch := gitInfo.provider.RepositoryInfo()
+	plan := &CommitPlan{
+		Owner:         owner,
+		Repository:    repository,
+		Branch:        branch,
+		Message:       commitMsg,
+		BaseCommitSha: head.commitSha,
+		BaseTreeSha:   head.treeSha,
+	}
+	for _, change := range changeList {
+		entry := &PlanEntry{
+			Path:    change.path,
+			Action:  change.action,
+			OldSize: -1,
+			NewSize: -1,
+		}
+		if change.baseEntry != nil {
+			entry.OldMode = change.baseEntry.Mode
+			entry.OldSha = change.baseEntry.Sha
+			entry.OldSize = change.baseEntry.Size
+		}
+		if change.action != ActionDelete && change.sha != "" {
+			entry.NewMode = change.mode
+			entry.NewSha = change.sha
+			entry.NewSize = change.size
+			if entry.NewSize < 0 && entry.NewSha == entry.OldSha {
+				entry.NewSize = entry.OldSize
+			}
+		}
+		plan.Entries = append(plan.Entries, entry)
+	}
+	return plan, nil
+}
+
+// ローカルのパスを指定してコミットを作成した場合の変更内容を返す。
+func (gitInfo *GitInfo) PlanCommitByLocalDir(commitMsg string, localPath string) (*CommitPlan, error) {
+	commitEleList, err := MakeCommitElementListByLocalPath(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("error occured when make commitElementList. %w", err)
+	}
+	return gitInfo.PlanCommitByElement(commitMsg, commitEleList)
+}
+
+// fs.FSを指定してコミットを作成した場合の変更内容を返す。
+func (gitInfo *GitInfo) PlanCommitByFS(commitMsg string, fsys fs.FS) (*CommitPlan, error) {
+	commitEleList, err := MakeCommitElementListByFS(fsys, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error occured when make commitElementList. %w", err)
+	}
+	return gitInfo.PlanCommitByElement(commitMsg, commitEleList)
+}
+
+// 変更が1件以上あるかを返す
+func (plan *CommitPlan) HasChanges() bool {
+	for _, entry := range plan.Entries {
+		if entry.Action != ActionUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// git diff --name-status に近い形式の変更内容の要約を返す
+func (plan *CommitPlan) String() string {
+	var sb strings.Builder
+	base := plan.BaseCommitSha
+	if base == "" {
+		base = "empty repository"
+	} else if len(base) > 7 {
+		base = base[:7]
+	}
+	sb.WriteString(fmt.Sprintf("%s/%s %s (base: %s)\n", plan.Owner, plan.Repository, plan.Branch, base))
+	counts := make(map[PlanAction]int)
+	for _, entry := range plan.Entries {
+		counts[entry.Action]++
+		switch entry.Action {
+		case ActionAdd:
+			sb.WriteString(fmt.Sprintf("  A  %s (%s, %s)\n", entry.Path, entry.NewMode, formatPlanSize(entry.NewSize)))
+		case ActionModify:
+			sb.WriteString(fmt.Sprintf("  M  %s (%s -> %s)\n", entry.Path, formatPlanSize(entry.OldSize), formatPlanSize(entry.NewSize)))
+		case ActionDelete:
+			sb.WriteString(fmt.Sprintf("  D  %s (%s)\n", entry.Path, formatPlanSize(entry.OldSize)))
+		case ActionModeChange:
+			sb.WriteString(fmt.Sprintf("  T  %s (%s -> %s)\n", entry.Path, entry.OldMode, entry.NewMode))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("%d added, %d modified, %d deleted, %d mode changed, %d unchanged",
+		counts[ActionAdd], counts[ActionModify], counts[ActionDelete], counts[ActionModeChange], counts[ActionUnchanged]))
+	return sb.String()
+}
+
+func formatPlanSize(size int) string {
+	if size < 0 {
+		return "? bytes"
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// 事前確認の各項目の結果
+type PreflightStatus string
+
+const (
+	PreflightPassed  PreflightStatus = "passed"
+	PreflightWarning PreflightStatus = "warning" //コミットの前に対応が必要だが、失敗とはみなさない
+	PreflightFailed  PreflightStatus = "failed"
+	PreflightUnknown PreflightStatus = "unknown" //APIからは確認できない
+	PreflightSkipped PreflightStatus = "skipped" //前の項目が失敗したため確認していない
+)
+
+// 事前確認の項目名
+const (
+	CheckToken        = "token"
+	CheckRepository   = "repository"
+	CheckBranch       = "branch"
+	CheckContentWrite = "contents:write"
+)
+
+// 事前確認の1項目
+type PreflightCheck struct {
+	Name   string
+	Status PreflightStatus
+	Detail string
+}
+
+// Preflightの結果
+type PreflightReport struct {
+	Owner         string
+	Repository    string
+	Branch        string
+	TokenType     string   //classic, fine-grained, app installation, unknown
+	Scopes        []string //classic tokenのスコープ。X-OAuth-Scopesヘッダが返されなかった場合はnil
+	DefaultBranch string
+	Checks        []*PreflightCheck
+}
+
+// 失敗した項目がないかを返す。確認できなかった項目と警告は失敗とみなさない。
+func (report *PreflightReport) Ok() bool {
+	for _, check := range report.Checks {
+		if check.Status == PreflightFailed || check.Status == PreflightSkipped {
+			return false
+		}
+	}
+	return true
+}
+
+// 項目名を指定して結果を返す
+func (report *PreflightReport) Check(name string) *PreflightCheck {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	return nil
+}
+
+func (report *PreflightReport) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s/%s %s (token: %s)", report.Owner, report.Repository, report.Branch, report.TokenType))
+	for _, check := range report.Checks {
+		sb.WriteString(fmt.Sprintf("\n  [%s] %s: %s", check.Status, check.Name, check.Detail))
+	}
+	return sb.String()
+}
+
+func (report *PreflightReport) add(name string, status PreflightStatus, detail string) {
+	report.Checks = append(report.Checks, &PreflightCheck{Name: name, Status: status, Detail: detail})
+}
+
+// コミットを作成する前に、トークン、リポジトリ、ブランチ、書き込み権限を確認する。書き込みは行わない。
+// 確認結果はreportに入り、errorは通信エラー等で確認自体ができなかった場合のみ返す。
+func (gitInfo *GitInfo) Preflight() (*PreflightReport, error) {
+	git, err := gitInfo.githubClient()
+	if err != nil {
+		return nil, err
+	}
+	report := &PreflightReport{
+		Owner:      git.Owner,
+		Repository: git.Repository,
+		Branch:     git.Branch,
+		TokenType:  "unknown",
+	}
+	token, err := git.GetToken()
+	if err != nil {
+		report.add(CheckToken, PreflightFailed, err.Error())
+		report.add(CheckRepository, PreflightSkipped, "")
+		report.add(CheckBranch, PreflightSkipped, "")
+		report.add(CheckContentWrite, PreflightSkipped, "")
+		return report, nil
+	}
+	report.TokenType = detectTokenType(token)
+
+	//トークンとリポジトリ
+	repoResp, header, err := git.GetRepoInfo()
+	var apiErr *githubapi.ApiError
+	if err != nil && !errors.As(err, &apiErr) {
+		return nil, fmt.Errorf("error occured when get repository. %w", err)
+	}
+	if header != nil && len(header.Values("X-OAuth-Scopes")) > 0 {
+		//スコープのないclassic tokenでは空のヘッダが返る
+		report.Scopes = []string{}
+		for _, scope := range strings.Split(header.Get("X-OAuth-Scopes"), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				report.Scopes = append(report.Scopes, scope)
+			}
+		}
+	}
+	if apiErr != nil {
+		switch apiErr.StatusCode {
+		case http.StatusUnauthorized:
+			report.add(CheckToken, PreflightFailed, "token is invalid or expired.")
+			report.add(CheckRepository, PreflightSkipped, "")
+		case http.StatusNotFound:
+			report.add(CheckToken, PreflightPassed, "token is accepted.")
+			report.add(CheckRepository, PreflightFailed, "repository does not exist or the token cannot access it.")
+		case http.StatusForbidden:
+			report.add(CheckToken, PreflightPassed, "token is accepted.")
+			report.add(CheckRepository, PreflightFailed, "access to the repository is forbidden. "+apiErr.Body)
+		default:
+			report.add(CheckToken, PreflightUnknown, "")
+			report.add(CheckRepository, PreflightFailed, fmt.Sprintf("unexpected status %d. %s", apiErr.StatusCode, apiErr.Body))
+		}
+		report.add(CheckBranch, PreflightSkipped, "")
+		report.add(CheckContentWrite, PreflightSkipped, "")
+		return report, nil
+	}
+	report.DefaultBranch = repoResp.Default_branch
+	report.add(CheckToken, PreflightPassed, "token is accepted.")
+	if repoResp.Archived || repoResp.Disabled {
+		report.add(CheckRepository, PreflightFailed, "repository is archived or disabled and cannot be written.")
+	} else {
+		report.add(CheckRepository, PreflightPassed, repoResp.Full_name+" is accessible.")
+	}
+
+	//ブランチ
+	canPush := repoResp.Permissions != nil && repoResp.Permissions.Push
+	ref, err := git.GetLatestRef()
+	switch {
+	case err == nil && ref.Ref == "":
+		report.add(CheckBranch, PreflightPassed, "repository is empty. the branch will be created by the first commit.")
+	case err == nil:
+		report.add(CheckBranch, PreflightPassed, "branch exists at "+ref.Object.Sha+".")
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		//ブランチは作成できるため失敗とはしない
+		if canPush && repoResp.Default_branch != "" {
+			report.add(CheckBranch, PreflightWarning, "branch does not exist. create it from the default branch "+repoResp.Default_branch+" before committing.")
+		} else {
+			report.add(CheckBranch, PreflightWarning, "branch does not exist. create it before committing.")
+		}
+	default:
+		return nil, fmt.Errorf("error occured when get the latest ref. %w", err)
+	}
+
+	//書き込み権限
+	report.checkContentWrite(git, repoResp, canPush)
+	return report, nil
+}
+
+// contents:write権限を確認する。トークンの種類によって確認方法が異なる。
+func (report *PreflightReport) checkContentWrite(git *githubapi.GitClient, repoResp *githubapi.RepoResponse, canPush bool) {
+	if repoResp.Archived {
+		report.add(CheckContentWrite, PreflightFailed, "repository is archived.")
+		return
+	}
+	if report.Scopes != nil {
+		//classic tokenはスコープで判定する
+		for _, scope := range report.Scopes {
+			if scope == "repo" || (scope == "public_repo" && !repoResp.Private) {
+				if canPush {
+					report.add(CheckContentWrite, PreflightPassed, "token has "+scope+" scope and push permission.")
+				} else {
+					report.add(CheckContentWrite, PreflightFailed, "token has "+scope+" scope but the user cannot push to the repository.")
+				}
+				return
+			}
+		}
+		report.add(CheckContentWrite, PreflightFailed, "token does not have repo scope.")
+		return
+	}
+	if appSource, ok := git.TokenSource.(*githubapi.AppTokenSource); ok && appSource.Permissions() != nil {
+		//GitHub Appはトークン発行時に付与された権限で判定する
+		if appSource.Permissions()["contents"] == "write" {
+			report.add(CheckContentWrite, PreflightPassed, "installation token has contents:write.")
+		} else {
+			report.add(CheckContentWrite, PreflightFailed, "installation token does not have contents:write.")
+		}
+		return
+	}
+	if repoResp.Permissions != nil && !canPush {
+		report.add(CheckContentWrite, PreflightFailed, "token cannot push to the repository.")
+		return
+	}
+	if report.TokenType == "classic" {
+		//GitHub Enterprise Serverのプロキシ等でヘッダが返されない場合はスコープを確認できない
+		report.add(CheckContentWrite, PreflightUnknown, "push is allowed for the repository, but the token scopes were not returned by the API. make sure the token has repo scope.")
+		return
+	}
+	//fine-grained tokenの権限はAPIから取得できない
+	report.add(CheckContentWrite, PreflightUnknown, "push is allowed for the repository, but fine-grained token permissions cannot be read from the API. make sure the token has Contents: Read and write.")
+}
+
+// トークンの接頭辞から種類を判定する
+func detectTokenType(token string) string {
+	switch {
+	case strings.HasPrefix(token, "ghp_") || strings.HasPrefix(token, "gho_"):
+		return "classic"
+	case strings.HasPrefix(token, "github_pat_"):
+		return "fine-grained"
+	case strings.HasPrefix(token, "ghs_"):
+		return "app installation"
+	case token == "":
+		return "none"
+	}
+	return "unknown"
+}
@@ -0,0 +1,68 @@
+package service
+
+// コミット作成の処理段階
+type ProgressPhase string
+
+const (
+	PhaseScan   ProgressPhase = "scan"   //ローカルファイルの列挙
+	PhaseHash   ProgressPhase = "hash"   //ファイルの読み込みとshaの計算
+	PhaseUpload ProgressPhase = "upload" //blobのアップロード
+	PhaseTree   ProgressPhase = "tree"   //treeの作成
+	PhaseCommit ProgressPhase = "commit" //commitの作成
+	PhaseRef    ProgressPhase = "ref"    //ブランチの更新
+)
+
+// 進捗の通知内容。各段階の開始時にCurrent=0で1度通知し、以降は1件完了するごとに通知する。
+type Progress struct {
+	Phase      ProgressPhase
+	Path       string //完了したファイルのパス(scan、hash、upload)
+	Current    int    //完了した件数
+	Total      int    //全件数。scanでは不明なため0
+	Bytes      int64  //完了したバイト数(hash、upload)
+	TotalBytes int64  //全バイト数(upload)。不明な場合は0
+	Group      int    //CreateCommitChainの何番目のコミットか(1から)
+	Groups     int    //CreateCommitChainのコミット数
+	Attempt    int    //ブランチの競合で作り直した場合に2以上になる
+}
+
+// 進捗を受け取る関数。コミット作成と同じgoroutineで呼ばれるため、時間のかかる処理は行わないこと。
+type ProgressFunc func(progress Progress)
+
+// コミット作成の進捗を受け取る関数を設定する。nilの場合は通知しない。
+func (gitInfo *GitInfo) SetProgressFunc(fn ProgressFunc) {
+	gitInfo.progress = fn
+}
+
+// 1回のコミット作成中の進捗通知。nilの場合は何もしない。
+type progressReporter struct {
+	fn      ProgressFunc
+	group   int
+	groups  int
+	attempt int
+}
+
+func (gitInfo *GitInfo) newProgressReporter(groups int, attempt int) *progressReporter {
+	if gitInfo.progress == nil {
+		return nil
+	}
+	return &progressReporter{fn: gitInfo.progress, group: 1, groups: groups, attempt: attempt}
+}
+
+func (reporter *progressReporter) report(progress Progress) {
+	if reporter == nil {
+		return
+	}
+	progress.Group = reporter.group
+	progress.Groups = reporter.groups
+	progress.Attempt = reporter.attempt
+	reporter.fn(progress)
+}
+
+// 1件だけの段階(tree、commit、ref)の開始と完了を通知する
+func (reporter *progressReporter) step(phase ProgressPhase, done bool) {
+	progress := Progress{Phase: phase, Total: 1}
+	if done {
+		progress.Current = 1
+	}
+	reporter.report(progress)
+}
@@ -0,0 +1,369 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	gitobj "github.com/daze-doragon/go-gituse/pkg/gitobj"
+)
+
+// Providerがその操作に対応していないことを表すエラー
+var ErrNotSupported = errors.New("operation is not supported by the provider.")
+
+// コミット先(GitHub、GitLab等のforgeやローカルのリポジトリ)に対する操作。treeとblobはGitHubのAPIの形式で返す。
+// コミットはObjectProviderまたはActionProviderのどちらかで作成する。
+type Provider interface {
+	// リポジトリの所有者、名前、対象のブランチ
+	RepositoryInfo() (owner string, repository string, branch string)
+	// ブランチの最新コミットとtreeのsha。空のリポジトリの場合はどちらも空を返す。
+	// treeのshaはGetTreeに渡す値で、forgeによってはコミットのshaになる。
+	BranchHead() (commitSha string, treeSha string, err error)
+	GetTree(sha string, recursive bool) (*githubapi.GetTreeResponse, error)
+	GetBlob(sha string) (*githubapi.BlobResponse, error)
+	ListBranches() ([]*githubapi.BranchResponse, error)
+	IsExistRepo() (bool, error)
+}
+
+// blob、tree、commit、refを個別に作成するProvider。CreateCommitChainでは全コミットの作成後に1度だけブランチを更新する。
+type ObjectProvider interface {
+	Provider
+	PutBlob(data []byte) (string, error)
+	// baseTreeShaのtreeにentriesを適用したtreeを作成する。Shaが空の要素はそのパスを削除する
+	PutTree(baseTreeSha string, entries []*githubapi.TreeDataElement) (string, error)
+	PutCommit(commit *githubapi.CommitData) (*githubapi.CreateCommitResponse, error)
+	// ブランチをcommitShaに更新する。previousShaが空の場合はブランチを作成する。
+	// ブランチがpreviousShaから更新されていた場合はErrBranchMovedを返す
+	UpdateBranch(commitSha string, previousSha string) error
+}
+
+// 変更内容の一覧から1コミットを作成し、ブランチも更新するProvider
+type ActionProvider interface {
+	Provider
+	// コミットを作成する。戻り値のTree.ShaはGetTreeに渡せる値にする
+	CommitActions(commit *ActionCommit) (*githubapi.CreateCommitResponse, error)
+}
+
+// ActionProviderで作成するコミット
+type ActionCommit struct {
+	Message     string
+	AuthorName  string
+	AuthorEmail string
+	BaseCommit  string //変更の元にしたコミット。空のリポジトリでは空文字列
+	Actions     []*FileAction
+}
+
+// ファイル単位の変更の種類
+type FileActionType string
+
+const (
+	FileCreate FileActionType = "create"
+	FileUpdate FileActionType = "update"
+	FileDelete FileActionType = "delete"
+	FileMove   FileActionType = "move"  //PreviousPathからPathへ移動する。Contentがnilの場合は内容を変更しない
+	FileChmod  FileActionType = "chmod" //Executableのみ変更する
+)
+
+// ファイル単位の変更内容
+type FileAction struct {
+	Action       FileActionType
+	Path         string
+	PreviousPath string
+	Content      []byte
+	Executable   bool
+
+	//変更前のblobのshaと実行権限。createの場合は空。forgeによっては前提条件として送る
+	PreviousSha        string
+	PreviousExecutable bool
+}
+
+// GitHubのProvider。git data APIでblob、tree、commit、refを個別に作成する
+type githubProvider struct {
+	*githubapi.GitClient
+}
+
+// GitHubのクライアントからProviderを作成する
+func NewGithubProvider(client *githubapi.GitClient) ObjectProvider {
+	if client.Branch == "" {
+		client.Branch = "main"
+	}
+	return &githubProvider{client}
+}
+
+func (provider *githubProvider) RepositoryInfo() (string, string, string) {
+	return provider.Owner, provider.Repository, provider.Branch
+}
+
+func (provider *githubProvider) BranchHead() (string, string, error) {
+	ref, err := provider.GetLatestRef()
+	if err != nil {
+		return "", "", fmt.Errorf("error occured when get the latest ref. %w", err)
+	}
+	if ref.Ref == "" {
+		return "", "", nil
+	}
+	commitResp, err := provider.GetCommit(ref.Object.Sha)
+	if err != nil {
+		return "", "", fmt.Errorf("error occured when get the latest commit. %w", err)
+	}
+	return commitResp.Sha, commitResp.Tree.Sha, nil
+}
+
+func (provider *githubProvider) PutBlob(data []byte) (string, error) {
+	content, encoding := encodeContent(data)
+	blob := &githubapi.BlobData{Content: content, Encoding: "base64"}
+	if encoding == Utf8 {
+		blob.Encoding = "utf-8"
+	}
+	createBlobResp, err := provider.CreateBlob(blob)
+	if err != nil {
+		return "", err
+	}
+	return createBlobResp.Sha, nil
+}
+
+func (provider *githubProvider) PutTree(baseTreeSha string, entries []*githubapi.TreeDataElement) (string, error) {
+	tree := &githubapi.TreeData{Tree: entries}
+	if baseTreeSha != "" {
+		tree.Base_tree = &baseTreeSha
+	}
+	createTreeResp, err := provider.CreateTree(tree)
+	if err != nil {
+		return "", err
+	}
+	return createTreeResp.SHA, nil
+}
+
+// 1階層分のtreeをbase_treeなしで作成する。配下のディレクトリはshaで参照する
+func (provider *githubProvider) writeTree(entries []*gitobj.TreeEntry) (string, error) {
+	tree := &githubapi.TreeData{Tree: []*githubapi.TreeDataElement{}}
+	for _, entry := range entries {
+		tree.Tree = append(tree.Tree, &githubapi.TreeDataElement{Path: entry.Name, Mode: entry.Mode, Type: entry.Type(), Sha: entry.Sha})
+	}
+	createTreeResp, err := provider.CreateTree(tree)
+	if err != nil {
+		return "", err
+	}
+	return createTreeResp.SHA, nil
+}
+
+func (provider *githubProvider) PutCommit(commit *githubapi.CommitData) (*githubapi.CreateCommitResponse, error) {
+	return provider.CreateCommit(commit)
+}
+
+func (provider *githubProvider) UpdateBranch(commitSha string, previousSha string) error {
+	if previousSha == "" {
+		//空のリポジトリだった場合はref作成
+		_, err := provider.CreateRef(&githubapi.CreateRefData{
+			Ref: fmt.Sprintf("refs/heads/%s", provider.Branch),
+			Sha: commitSha,
+		})
+		if err != nil {
+			return fmt.Errorf("error occured when CreateRef. %w", err)
+		}
+		return nil
+	}
+	//これ以前のコミットがある場合はref更新
+	_, err := provider.UpdateRef(&githubapi.UpdRefData{
+		Sha:   commitSha,
+		Force: false,
+	})
+	if err != nil {
+		var apiErr *githubapi.ApiError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity && strings.Contains(apiErr.Body, "fast forward") {
+			return fmt.Errorf("error occured when UpdateRef. %w %s", ErrBranchMoved, err)
+		}
+		return fmt.Errorf("error occured when UpdateRef. %w", err)
+	}
+	return nil
+}
+
+// Providerを指定してGitHub操作用のオブジェクトを作成する。GitHub以外のforgeにコミットする場合に使う。
+// GitHubのProvider以外では、リポジトリの作成や設定、Preflight、GraphQL等のGitHub固有の機能はErrNotSupportedを返す。
+// ResumeCommitはObjectProviderの場合のみ使える。
+func GetGitInfoByProvider(provider Provider, author string, email string) (*GitInfo, error) {
+	if provider == nil {
+		return nil, errors.New("provider is nil.")
+	}
+	gitInfo := &GitInfo{
+		provider:     provider,
+		author_name:  author,
+		author_email: email,
+	}
+	if github, ok := provider.(*githubProvider); ok {
+		gitInfo.client = github.GitClient
+	}
+	if pusher, ok := provider.(*pushProvider); ok {
+		//GitHub固有の機能は読み込みに使うProviderのクライアントで行う
+		if github, ok := pusher.Provider.(*githubProvider); ok {
+			gitInfo.client = github.GitClient
+		}
+		gitInfo.backend = BackendPush
+		gitInfo.pusher = pusher
+	}
+	return gitInfo, nil
+}
+
+// blob、tree、commit、refを個別に作成するProviderを返す。対応していない場合はErrNotSupportedを返す。
+func (gitInfo *GitInfo) objectProvider() (ObjectProvider, error) {
+	if gitInfo.backend == BackendPush {
+		if gitInfo.pusher == nil {
+			if gitInfo.client == nil {
+				return nil, ErrNotSupported
+			}
+			gitInfo.pusher = NewPushProvider(gitInfo.provider, GithubRemote(gitInfo.client))
+		}
+		return gitInfo.pusher, nil
+	}
+	provider, ok := gitInfo.provider.(ObjectProvider)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return provider, nil
+}
+
+// treeとblobを読み込むProvider。pushする場合はpush前のオブジェクトも読み込める
+func (gitInfo *GitInfo) treeReader() Provider {
+	if provider, err := gitInfo.objectProvider(); err == nil {
+		return provider
+	}
+	return gitInfo.provider
+}
+
+// オブジェクトをpushまで手元に置くかを返す。その場合はジャーナルに記録したblob、tree、commitがリモートにない
+func (gitInfo *GitInfo) stagesObjects() bool {
+	provider, err := gitInfo.objectProvider()
+	if err != nil {
+		return false
+	}
+	_, ok := provider.(*pushProvider)
+	return ok
+}
+
+// GitHub固有の機能で使うクライアントを返す。GitHub以外のProviderの場合はErrNotSupportedを返す。
+func (gitInfo *GitInfo) githubClient() (*githubapi.GitClient, error) {
+	if gitInfo.client == nil {
+		return nil, ErrNotSupported
+	}
+	return gitInfo.client, nil
+}
+
+// ActionProviderでCommitGroupの順にコミットを作成する。コミットごとにブランチが更新される。
+// エラーの場合も作成済みのコミットを返す。
+func (gitInfo *GitInfo) createCommitChainByActions(provider ActionProvider, groupList []*CommitGroup, progress *progressReporter) ([]*githubapi.CreateCommitResponse, error) {
+	head, err := gitInfo.getBranchHead()
+	if err != nil {
+		return nil, err
+	}
+	var respList []*githubapi.CreateCommitResponse
+	base := newBaseTree(provider, head.treeSha)
+	baseCommit := head.commitSha
+	for i, group := range groupList {
+		if progress != nil {
+			progress.group = i + 1
+		}
+		changeList, err := prepareChanges(base, group.Elements, gitInfo.blobCache, gitInfo.normalizeEol, progress)
+		if err != nil {
+			return respList, err
+		}
+		actionList, err := makeFileActions(base, changeList)
+		if err != nil {
+			return respList, err
+		}
+		progress.step(PhaseCommit, false)
+		createCommitResp, err := provider.CommitActions(&ActionCommit{
+			Message:     group.Message,
+			AuthorName:  gitInfo.author_name,
+			AuthorEmail: gitInfo.author_email,
+			BaseCommit:  baseCommit,
+			Actions:     actionList,
+		})
+		if err != nil {
+			return respList, fmt.Errorf("error occured when create commit. %w", err)
+		}
+		progress.step(PhaseCommit, true)
+		respList = append(respList, createCommitResp)
+		base = newBaseTree(provider, createCommitResp.Tree.Sha)
+		baseCommit = createCommitResp.Sha
+	}
+	//コミットの作成時にブランチも更新されている
+	progress.step(PhaseRef, false)
+	progress.step(PhaseRef, true)
+	return respList, nil
+}
+
+// パス単位の変更内容をファイル単位の変更に変換する。既存のblobを移動する場合はmoveにする。
+func makeFileActions(base *baseTree, changeList []*fileChange) ([]*FileAction, error) {
+	//移動元の候補(削除されるblob)
+	deleted := make(map[string]*fileChange)
+	for _, change := range changeList {
+		if change.action == ActionDelete && change.baseEntry.Type == "blob" {
+			deleted[change.baseEntry.Sha] = change
+		}
+	}
+	moved := make(map[*fileChange]bool)
+	var actionList []*FileAction
+	for _, change := range changeList {
+		switch change.action {
+		case ActionUnchanged, ActionDelete:
+			continue
+		}
+		if change.objType != "blob" || (change.mode != "100644" && change.mode != "100755") {
+			return nil, fmt.Errorf("%s: symlinks and submodules cannot be committed by this provider. %w", change.path, ErrNotSupported)
+		}
+		action := &FileAction{Path: change.path, Executable: change.mode == "100755"}
+		if change.baseEntry != nil {
+			action.PreviousSha = change.baseEntry.Sha
+			action.PreviousExecutable = change.baseEntry.Mode == "100755"
+		}
+		switch change.action {
+		case ActionModeChange:
+			action.Action = FileChmod
+			actionList = append(actionList, action)
+			continue
+		case ActionModify:
+			action.Action = FileUpdate
+		default:
+			action.Action = FileCreate
+		}
+		if change.load == nil {
+			//既存のblobを使う場合、同じblobが削除されていれば移動として扱う
+			if source := deleted[change.sha]; source != nil && !moved[source] && source.baseEntry.Mode == change.mode && action.Action == FileCreate {
+				moved[source] = true
+				action.Action = FileMove
+				action.PreviousPath = source.path
+				action.PreviousSha = source.baseEntry.Sha
+				action.PreviousExecutable = source.baseEntry.Mode == "100755"
+				actionList = append(actionList, action)
+				continue
+			}
+			data, err := base.readBlob(change.sha)
+			if err != nil {
+				return nil, err
+			}
+			action.Content = data
+		} else {
+			data, err := change.load()
+			if err != nil {
+				return nil, fmt.Errorf("error occured when read %s. %w", change.path, err)
+			}
+			action.Content = data
+		}
+		actionList = append(actionList, action)
+	}
+	//ファイルをディレクトリに置き換える場合に備えて削除を先に行う
+	var deleteList []*FileAction
+	for _, change := range changeList {
+		if change.action == ActionDelete && !moved[change] {
+			deleteList = append(deleteList, &FileAction{
+				Action:             FileDelete,
+				Path:               change.path,
+				PreviousSha:        change.baseEntry.Sha,
+				PreviousExecutable: change.baseEntry.Mode == "100755",
+			})
+		}
+	}
+	return append(deleteList, actionList...), nil
+}
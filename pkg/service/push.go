@@ -0,0 +1,201 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	gitobj "github.com/daze-doragon/go-gituse/pkg/gitobj"
+	gitpush "github.com/daze-doragon/go-gituse/pkg/gitpush"
+)
+
+// blob、tree、commitを手元で作成し、ブランチの更新時にpackファイルにまとめてgit smart HTTPでpushするProvider。
+// 読み込みは元のProviderで行うため、何千ファイルの変更でもオブジェクトの作成はpushの1リクエストになる。
+// pushが成功するまでオブジェクトはメモリ上にだけあるため、ジャーナルのblobは再利用せず、ResumeCommitにも対応しない。
+type pushProvider struct {
+	Provider
+	remote *gitpush.Remote
+
+	mu     sync.Mutex
+	staged map[string]*gitobj.PackObject //pushしていないオブジェクト
+	order  []string                      //stagedに追加した順
+}
+
+// 読み込みにproviderを使い、remoteにpushするProviderを作成する。
+// providerのBranchHeadはtreeのshaを返す必要がある(GitHub、Gitea、ローカルのリポジトリ)
+func NewPushProvider(provider Provider, remote *gitpush.Remote) ObjectProvider {
+	return &pushProvider{Provider: provider, remote: remote, staged: make(map[string]*gitobj.PackObject)}
+}
+
+// GitHubのクライアントの認証情報でpushするremoteを作成する。URLはGitClient.RemoteUrlを使う
+func GithubRemote(client *githubapi.GitClient) *gitpush.Remote {
+	return &gitpush.Remote{
+		Url:         client.RemoteUrl(),
+		TokenSource: githubTokenSource{client},
+		Context:     client.Context,
+		HttpClient:  client.HttpClient,
+	}
+}
+
+// GitClientのトークン(TokenSourceまたはToken)を返すTokenSource
+type githubTokenSource struct {
+	client *githubapi.GitClient
+}
+
+func (source githubTokenSource) Token() (string, error) {
+	return source.client.GetToken()
+}
+
+// オブジェクトをpushするまで手元に置く
+func (provider *pushProvider) stage(objType string, data []byte) string {
+	sha := gitobj.HashObject(objType, data)
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if _, ok := provider.staged[sha]; !ok {
+		provider.staged[sha] = &gitobj.PackObject{Type: objType, Data: data}
+		provider.order = append(provider.order, sha)
+	}
+	return sha
+}
+
+// pushしていないオブジェクトを返す
+func (provider *pushProvider) stagedObject(sha string) (*gitobj.PackObject, bool) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	object, ok := provider.staged[sha]
+	return object, ok
+}
+
+// pushしていないtreeも読み込む。CreateCommitChainの2つ目以降のコミットは前のコミットのtreeを元にする
+func (provider *pushProvider) GetTree(sha string, recursive bool) (*githubapi.GetTreeResponse, error) {
+	object, ok := provider.stagedObject(sha)
+	if !ok {
+		return provider.Provider.GetTree(sha, recursive)
+	}
+	entries, err := gitobj.DecodeTree(object.Data)
+	if err != nil {
+		return nil, err
+	}
+	treeResp := &githubapi.GetTreeResponse{Sha: sha}
+	for _, entry := range entries {
+		element := &githubapi.TreeEntryElement{Path: entry.Name, Mode: entry.Mode, Type: entry.Type(), Sha: entry.Sha}
+		if blob, ok := provider.stagedObject(entry.Sha); ok && element.Type == gitobj.TypeBlob {
+			element.Size = len(blob.Data)
+		}
+		treeResp.Tree = append(treeResp.Tree, element)
+		if recursive && element.Type == gitobj.TypeTree {
+			childResp, err := provider.GetTree(entry.Sha, true)
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range childResp.Tree {
+				child.Path = entry.Name + "/" + child.Path
+				treeResp.Tree = append(treeResp.Tree, child)
+			}
+		}
+	}
+	return treeResp, nil
+}
+
+func (provider *pushProvider) GetBlob(sha string) (*githubapi.BlobResponse, error) {
+	object, ok := provider.stagedObject(sha)
+	if !ok {
+		return provider.Provider.GetBlob(sha)
+	}
+	return &githubapi.BlobResponse{
+		Sha:      sha,
+		Size:     len(object.Data),
+		Content:  base64.StdEncoding.EncodeToString(object.Data),
+		Encoding: "base64",
+	}, nil
+}
+
+func (provider *pushProvider) PutBlob(data []byte) (string, error) {
+	return provider.stage(gitobj.TypeBlob, data), nil
+}
+
+func (provider *pushProvider) PutTree(baseTreeSha string, entries []*githubapi.TreeDataElement) (string, error) {
+	return editTree(provider, baseTreeSha, entries)
+}
+
+func (provider *pushProvider) readTree(sha string) ([]*gitobj.TreeEntry, error) {
+	treeResp, err := provider.GetTree(sha, false)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*gitobj.TreeEntry
+	for _, element := range treeResp.Tree {
+		entries = append(entries, &gitobj.TreeEntry{Mode: element.Mode, Name: element.Path, Sha: element.Sha})
+	}
+	return entries, nil
+}
+
+func (provider *pushProvider) writeTree(entries []*gitobj.TreeEntry) (string, error) {
+	data, err := gitobj.EncodeTree(entries)
+	if err != nil {
+		return "", err
+	}
+	return provider.stage(gitobj.TypeTree, data), nil
+}
+
+func (provider *pushProvider) PutCommit(commitData *githubapi.CommitData) (*githubapi.CreateCommitResponse, error) {
+	commit, err := makeCommitObject(commitData)
+	if err != nil {
+		return nil, err
+	}
+	sha := provider.stage(gitobj.TypeCommit, gitobj.EncodeCommit(commit))
+	return commitObjectResponse(sha, commit), nil
+}
+
+// 手元のオブジェクトをpackファイルにまとめ、ブランチの更新と一緒にpushする。
+// 失敗した場合はオブジェクトを残し、作り直したコミットのpushで再度送る
+func (provider *pushProvider) UpdateBranch(commitSha string, previousSha string) error {
+	_, _, branch := provider.RepositoryInfo()
+	refName := "refs/heads/" + branch
+	adv, err := provider.remote.ListRefs()
+	if err != nil {
+		return fmt.Errorf("error occured when list refs. %w", err)
+	}
+	//packを送る前に、ブランチが更新されていないかを確認する
+	if current := adv.Refs[refName]; current != previousSha {
+		return fmt.Errorf("error occured when push. %w %s is at %q, expected %q.", ErrBranchMoved, refName, current, previousSha)
+	}
+
+	provider.mu.Lock()
+	objects := make([]*gitobj.PackObject, 0, len(provider.order))
+	for _, sha := range provider.order {
+		objects = append(objects, provider.staged[sha])
+	}
+	provider.mu.Unlock()
+
+	_, err = provider.remote.Push(adv, []*gitpush.RefUpdate{{Name: refName, Old: previousSha, New: commitSha}}, objects)
+	var rejected *gitpush.RejectedError
+	if errors.As(err, &rejected) && isStaleRefReason(rejected) {
+		return fmt.Errorf("error occured when push. %w %s", ErrBranchMoved, err)
+	}
+	if err != nil {
+		return fmt.Errorf("error occured when push. %w", err)
+	}
+
+	provider.mu.Lock()
+	provider.staged = make(map[string]*gitobj.PackObject)
+	provider.order = nil
+	provider.mu.Unlock()
+	return nil
+}
+
+// refが他のpushで更新されていたことによる拒否かを返す
+func isStaleRefReason(rejected *gitpush.RejectedError) bool {
+	for _, status := range rejected.Statuses {
+		reason := strings.ToLower(status.Reason)
+		for _, stale := range []string{"stale info", "fetch first", "non-fast-forward", "failed to lock", "cannot lock ref", "failed to update ref"} {
+			if strings.Contains(reason, stale) {
+				return true
+			}
+		}
+	}
+	return false
+}
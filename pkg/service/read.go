@@ -0,0 +1,33 @@
+package service
+
+import (
+	"fmt"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// ブランチの最新コミットにあるファイルの内容を取得する。
+func (gitInfo *GitInfo) GetFileContent(repoPath string) ([]byte, error) {
+	base, err := gitInfo.getBaseTree()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := base.lookup(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil || entry.Type != "blob" {
+		_, _, branch := gitInfo.provider.RepositoryInfo()
+		return nil, fmt.Errorf("%s does not exist in branch %s.", repoPath, branch)
+	}
+	return base.readBlob(entry.Sha)
+}
+
+// リポジトリのブランチの一覧を取得する。
+func (gitInfo *GitInfo) ListBranches() ([]*githubapi.BranchResponse, error) {
+	branchList, err := gitInfo.provider.ListBranches()
+	if err != nil {
+		return nil, fmt.Errorf("error occured when list branches. %w", err)
+	}
+	return branchList, nil
+}
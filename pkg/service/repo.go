@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// CreateRepoのオプション。リポジトリ名とownerはGitInfoのものを使う。
+type CreateRepoOption struct {
+	Organization       bool   //ownerをorganizationとして作成する
+	Visibility         string //private(デフォルト), public, internal(organizationのみ)
+	Description        string
+	Homepage           string
+	AutoInit           bool   //READMEを含む最初のコミットを作成する
+	DefaultBranch      string //デフォルトブランチ名。AutoInitまたはテンプレートの場合のみ作成時に変更する
+	GitignoreTemplate  string //例: Go
+	LicenseTemplate    string //例: mit
+	IsTemplate         bool   //作成したリポジトリをテンプレートにする
+	TemplateOwner      string //指定した場合はテンプレートリポジトリから作成する
+	TemplateRepository string
+	IncludeAllBranches bool          //テンプレートの全ブランチを含める
+	TemplateTimeout    time.Duration //テンプレートからのブランチの生成を待つ最大時間。0の場合は30秒
+}
+
+// オプションを指定してリポジトリを作成する。
+// 空のリポジトリの場合、デフォルトブランチは最初にコミットしたブランチになる。
+// テンプレートからの生成は非同期のため、デフォルトブランチが作成されるまで待つ。待ちきれなかった場合は作成したリポジトリとエラーを返す。
+func (gitInfo *GitInfo) CreateRepo(option *CreateRepoOption) (*githubapi.RepoResponse, error) {
+	if option == nil {
+		option = &CreateRepoOption{}
+	}
+	git, err := gitInfo.githubClient()
+	if err != nil {
+		return nil, err
+	}
+	private := true
+	switch option.Visibility {
+	case "", "private":
+	case "public":
+		private = false
+	case "internal":
+		if !option.Organization {
+			return nil, errors.New("internal visibility is only available for organization repositories.")
+		}
+		private = false
+	default:
+		return nil, fmt.Errorf("unknown visibility %s.", option.Visibility)
+	}
+
+	var repoResp *githubapi.RepoResponse
+	if option.TemplateOwner != "" || option.TemplateRepository != "" {
+		if option.TemplateOwner == "" || option.TemplateRepository == "" {
+			return nil, errors.New("both TemplateOwner and TemplateRepository are required.")
+		}
+		if option.Visibility == "internal" {
+			return nil, errors.New("internal visibility cannot be used with a template.")
+		}
+		repoData := &githubapi.CreateRepoFromTemplateData{
+			Owner:                git.Owner,
+			Name:                 git.Repository,
+			Description:          option.Description,
+			Include_all_branches: option.IncludeAllBranches,
+			Private:              private,
+		}
+		repoResp, err = git.CreateRepoFromTemplate(option.TemplateOwner, option.TemplateRepository, repoData)
+		if err == nil {
+			if err := gitInfo.waitForBranch(repoResp.Default_branch, option.TemplateTimeout); err != nil {
+				return repoResp, err
+			}
+		}
+	} else {
+		repoData := &githubapi.CreateRepoData{
+			Name:               git.Repository,
+			Description:        option.Description,
+			Homepage:           option.Homepage,
+			Private:            private,
+			Auto_init:          option.AutoInit,
+			Gitignore_template: option.GitignoreTemplate,
+			License_template:   option.LicenseTemplate,
+			Is_template:        option.IsTemplate,
+		}
+		org := ""
+		if option.Organization {
+			org = git.Owner
+			repoData.Visibility = option.Visibility
+		}
+		repoResp, err = git.CreateRepo(org, repoData)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error occured when create repository. %w", err)
+	}
+
+	initialized := option.AutoInit || option.GitignoreTemplate != "" || option.LicenseTemplate != "" || option.TemplateOwner != ""
+	if option.DefaultBranch == "" || option.DefaultBranch == repoResp.Default_branch || !initialized {
+		return repoResp, nil
+	}
+	return gitInfo.changeDefaultBranch(repoResp, option.DefaultBranch)
+}
+
+// ブランチが作成されるまで一定間隔で確認する
+func (gitInfo *GitInfo) waitForBranch(branch string, timeout time.Duration) error {
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	target := *gitInfo.client
+	target.Branch = branch
+	ctx := target.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	deadline := time.Now().Add(timeout)
+	wait := 100 * time.Millisecond
+	for {
+		ref, err := target.GetLatestRef()
+		var apiErr *githubapi.ApiError
+		if err == nil && ref.Ref != "" {
+			return nil
+		}
+		//生成中は空のリポジトリまたはブランチがない状態になる
+		if err != nil && !(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound) {
+			return fmt.Errorf("error occured when get branch %s. %w", branch, err)
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("repository was created from the template, but branch %s was not generated within %s.", branch, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, 2*time.Second)
+	}
+}
+
+// 初期ブランチと同じコミットでブランチを作成し、デフォルトブランチにする。初期ブランチは削除しない。
+func (gitInfo *GitInfo) changeDefaultBranch(repoResp *githubapi.RepoResponse, branch string) (*githubapi.RepoResponse, error) {
+	initial := *gitInfo.client
+	initial.Branch = repoResp.Default_branch
+	ref, err := initial.GetLatestRef()
+	if err != nil {
+		return nil, fmt.Errorf("error occured when get the initial branch. %w", err)
+	}
+	if ref.Ref == "" {
+		return nil, fmt.Errorf("initial branch %s does not exist.", repoResp.Default_branch)
+	}
+	refData := &githubapi.CreateRefData{
+		Ref: "refs/heads/" + branch,
+		Sha: ref.Object.Sha,
+	}
+	if _, err := initial.CreateRef(refData); err != nil {
+		return nil, fmt.Errorf("error occured when create branch %s. %w", branch, err)
+	}
+	return gitInfo.UpdateRepoSettings(&githubapi.UpdateRepoData{Default_branch: &branch})
+}
+
+// リポジトリの設定を変更する。nilの項目は変更しない。
+func (gitInfo *GitInfo) UpdateRepoSettings(settings *githubapi.UpdateRepoData) (*githubapi.RepoResponse, error) {
+	git, err := gitInfo.githubClient()
+	if err != nil {
+		return nil, err
+	}
+	repoResp, err := git.UpdateRepo(settings)
+	if err != nil {
+		return nil, fmt.Errorf("error occured when update repository settings. %w", err)
+	}
+	return repoResp, nil
+}
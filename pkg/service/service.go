@@ -1,29 +1,49 @@
 package service
 
 import (
+	"bytes"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
 	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
 )
 
+// MakeCommitElementByFileDataに渡すデータの形式
+type Encoding int
+
 const (
-	FormattedBinary int = 1
-	Utf8            int = 2
+	FormattedBinary Encoding = 1 //base64でエンコードしたバイナリ
+	Utf8            Encoding = 2 //UTF-8のテキスト
 )
 
+// ブランチ更新の競合時にコミットを作り直す回数
+const maxCommitAttempts = 3
+
+// コミット中にブランチが他のコミットで更新され、refを更新できなかったことを表すエラー
+var ErrBranchMoved = errors.New("branch was updated by another commit.")
+
 type GitInfo struct {
-	client       *githubapi.GitClient
+	client       *githubapi.GitClient //GitHub以外のProviderの場合はnil
+	provider     Provider
 	author_name  string
 	author_email string
+	progress     ProgressFunc
+	journal      *Journal
+	blobCache    *BlobCache
+	backend      CommitBackend
+	pusher       ObjectProvider //BackendPushの場合に使うProvider
+	normalizeEol bool           //trueの場合は.gitattributesに従ってCRLFをLFに変換する
 }
 
 // コミットの要素になるデータ(blob単位)
@@ -31,8 +51,20 @@ type CommitElement struct {
 	pathInRepo   string
 	pathInLocal  string
 	content      string
-	encodingType int //0:データなし 1:base64_binary 2:utf-8
+	encodingType Encoding               //0:データなし 1:base64_binary 2:utf-8
+	data         []byte                 //MakeCommitElementByBytesで指定した内容
+	reader       func() ([]byte, error) //MakeCommitElementByReaderで指定した内容。変更内容の確認時の最初の呼び出しで全て読み込み、以降は同じ内容を返す
+	fsys         fs.FS                  //nilでない場合はpathInFSをfsysから読み込む
+	pathInFS     string
 	blobSha      string
+	mode         string //空の場合は100644
+	deleted      bool   //trueの場合はpathInRepoを削除する
+	transform    func([]byte) ([]byte, error)
+	sourcePath   string           //移動・コピー元のパス
+	removeSource bool             //trueの場合はsourcePathを削除する(移動)
+	mirrorKeep   map[string]bool  //nilでない場合はpathInRepo配下でこのセットにないファイルを削除する
+	submodule    *SubmoduleOption //nilでない場合はpathInRepoにblobShaのgitlinkを設定する
+	patch        []*FilePatch     //nilでない場合はコミットのたびにbaseへパッチを適用する
 }
 
 // GitHub操作用のオブジェクト
@@ -54,6 +86,35 @@ func GetGitInfo(token *string, owner string, repoName string, branch *string, au
 	}
 	gitInfo := &GitInfo{
 		client:       gitClient,
+		provider:     &githubProvider{gitClient},
+		author_name:  author,
+		author_email: email,
+	}
+	return gitInfo, nil
+}
+
+// MakeCommitElementListByLocalPathWithOptionのオプション
+type LocalDirOption struct {
+	Prefix string //リポジトリ内の配置先ディレクトリ。空の場合はリポジトリのルート
+	Mirror bool   //trueの場合はPrefix配下でローカルに存在しないファイルを削除する
+
+	SkipGit   bool //trueの場合は.gitディレクトリと.gitファイルをコミットしない
+	FileModes bool //trueの場合はシンボリックリンクを120000、実行権限のあるファイルを100755としてコミットする。falseの場合はリンク先の内容を通常のファイルとしてコミットする
+
+	Progress ProgressFunc //ファイルを1件列挙するごとにPhaseScanで呼ばれる
+}
+
+// 作成済みのGitClientを指定してGitHub操作用のオブジェクトを作成する。TokenSourceを使う場合はこちらを使う。
+func GetGitInfoByClient(client *githubapi.GitClient, author string, email string) (*GitInfo, error) {
+	if client == nil {
+		return nil, errors.New("client is nil.")
+	}
+	if client.Branch == "" {
+		client.Branch = "main"
+	}
+	gitInfo := &GitInfo{
+		client:       client,
+		provider:     &githubProvider{client},
 		author_name:  author,
 		author_email: email,
 	}
@@ -62,20 +123,106 @@ func GetGitInfo(token *string, owner string, repoName string, branch *string, au
 
 // ローカルのファイルパスを指定してCommitElementを作成する。
 func MakeCommitElementListByLocalPath(localPath string) ([]*CommitElement, error) {
+	return MakeCommitElementListByLocalPathWithOption(localPath, nil)
+}
+
+// ローカルのファイルパスとオプションを指定してCommitElementを作成する。
+func MakeCommitElementListByLocalPathWithOption(localPath string, option *LocalDirOption) ([]*CommitElement, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("error occured when process file in localPath. %w", err)
+	}
+	dir, root := localPath, "."
+	if !info.IsDir() {
+		//ファイルを直接指定した場合
+		dir, root = filepath.Dir(localPath), filepath.Base(localPath)
+	}
+	readLink := func(name string) (string, error) {
+		return os.Readlink(filepath.Join(dir, filepath.FromSlash(name)))
+	}
+	return walkCommitElements(os.DirFS(dir), root, option, readLink, func(repoPath string, name string) *CommitElement {
+		return &CommitElement{
+			pathInRepo:  repoPath,
+			pathInLocal: filepath.Join(dir, filepath.FromSlash(name)),
+		}
+	})
+}
+
+// fsysのファイルをルートからたどってCommitElementを作成する。embed.FS、fstest.MapFS、zip.Readerなどを使える。
+// ファイルの内容はコミットの作成時に読み込む
+func MakeCommitElementListByFS(fsys fs.FS, option *LocalDirOption) ([]*CommitElement, error) {
+	if fsys == nil {
+		return nil, errors.New("fsys is nil.")
+	}
+	readLink := func(name string) (string, error) {
+		if linkFS, ok := fsys.(interface {
+			ReadLink(name string) (string, error)
+		}); ok {
+			return linkFS.ReadLink(name)
+		}
+		//ReadLinkを持たないfs.FSはシンボリックリンクの内容をリンク先として扱う
+		data, err := fs.ReadFile(fsys, name)
+		return string(data), err
+	}
+	return walkCommitElements(fsys, ".", option, readLink, func(repoPath string, name string) *CommitElement {
+		return &CommitElement{
+			pathInRepo: repoPath,
+			fsys:       fsys,
+			pathInFS:   name,
+		}
+	})
+}
+
+// fsysのroot(ディレクトリまたはファイル)配下のファイルを列挙し、newElementでCommitElementを作成する。
+// Prefix、Mirror、Progress、SkipGit、FileModesはローカルのパスとfs.FSで同じように扱う
+func walkCommitElements(fsys fs.FS, root string, option *LocalDirOption, readLink func(name string) (string, error), newElement func(repoPath string, name string) *CommitElement) ([]*CommitElement, error) {
+	if option == nil {
+		option = &LocalDirOption{}
+	}
+	prefix := strings.Trim(option.Prefix, "/")
 	var commitEleList []*CommitElement
-	err := filepath.WalkDir(localPath, func(path string, d os.DirEntry, err error) error {
+	localPathSet := make(map[string]bool)
+	if option.Progress != nil {
+		option.Progress(Progress{Phase: PhaseScan})
+	}
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if option.SkipGit && d.Name() == ".git" && name != root {
+			//.gitディレクトリとworktreeの.gitファイルはコミットしない
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
 		if !d.IsDir() {
-			separator := string(os.PathSeparator)
-			pathEle := strings.Split(path, separator)
-			repoPath := strings.Join(pathEle[1:], "/")
-			ele := &CommitElement{
-				pathInRepo:  repoPath,
-				pathInLocal: path,
+			relPath := name
+			if root != "." {
+				relPath = strings.TrimPrefix(strings.TrimPrefix(name, root), "/")
+			}
+			if relPath == "" {
+				//ファイルを直接指定した場合
+				relPath = path.Base(name)
+			}
+			repoPath := relPath
+			if prefix != "" {
+				repoPath = prefix + "/" + repoPath
+			}
+			var element *CommitElement
+			if option.FileModes {
+				element, err = newWalkedElement(d, repoPath, name, readLink, newElement)
+				if err != nil {
+					return err
+				}
+			} else {
+				element = newElement(repoPath, name)
+			}
+			commitEleList = append(commitEleList, element)
+			localPathSet[repoPath] = true
+			if option.Progress != nil {
+				option.Progress(Progress{Phase: PhaseScan, Path: repoPath, Current: len(commitEleList)})
 			}
-			commitEleList = append(commitEleList, ele)
 		}
 		return nil
 	})
@@ -83,11 +230,37 @@ func MakeCommitElementListByLocalPath(localPath string) ([]*CommitElement, error
 	if err != nil {
 		return nil, fmt.Errorf("error occured when process file in localPath. %w", err)
 	}
+	if option.Mirror {
+		commitEleList = append(commitEleList, &CommitElement{
+			pathInRepo: prefix,
+			mirrorKeep: localPathSet,
+		})
+	}
 	return commitEleList, nil
 }
 
+// 列挙したファイルの種類に合わせてCommitElementを作成する。シンボリックリンクはreadLinkで読んだリンク先を内容にする
+func newWalkedElement(d fs.DirEntry, repoPath string, name string, readLink func(name string) (string, error), newElement func(repoPath string, name string) *CommitElement) (*CommitElement, error) {
+	if d.Type()&fs.ModeSymlink != 0 {
+		target, err := readLink(name)
+		if err != nil {
+			return nil, err
+		}
+		return &CommitElement{pathInRepo: repoPath, data: []byte(target), mode: "120000"}, nil
+	}
+	element := newElement(repoPath, name)
+	info, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0o111 != 0 {
+		element.mode = "100755"
+	}
+	return element, nil
+}
+
 // ファイルデータを指定してCommitElementを作成する。encType 1:binary(base64encode) 2:utf-8
-func MakeCommitElementByFileData(repoPath string, fileContent string, encType int) (*CommitElement, error) {
+func MakeCommitElementByFileData(repoPath string, fileContent string, encType Encoding) (*CommitElement, error) {
 	if !(encType == FormattedBinary || encType == Utf8) {
 		return nil, errors.New("invalid encType 1:binary(base64encode) 2:utf-8")
 	}
@@ -108,9 +281,57 @@ func MakeCommitElementByFileData(repoPath string, fileContent string, encType in
 	return element, nil
 }
 
-// 空のリポジトリかを確認する(未テスト)
+// ファイルの内容を指定してCommitElementを作成する。テキストかバイナリかはアップロード時に判定する
+func MakeCommitElementByBytes(repoPath string, data []byte) (*CommitElement, error) {
+	if repoPath == "" {
+		return nil, errors.New("repoPath is empty.")
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	element := &CommitElement{
+		pathInRepo: repoPath,
+		data:       bytes.Clone(data),
+	}
+	return element, nil
+}
+
+// readerから読み込んだ内容でCommitElementを作成する。readerはアップロード時ではなく、コミットの作成開始時に変更内容を確認するため一度だけ最後まで読み込む。
+// 読み込んだ内容はshaの計算とアップロード、コミットの作り直しに使うためメモリに保持する。readerがio.Closerの場合は読み込み後に閉じる
+func MakeCommitElementByReader(repoPath string, reader io.Reader) (*CommitElement, error) {
+	if repoPath == "" {
+		return nil, errors.New("repoPath is empty.")
+	}
+	if reader == nil {
+		return nil, errors.New("reader is nil.")
+	}
+	element := &CommitElement{
+		pathInRepo: repoPath,
+		reader: sync.OnceValues(func() ([]byte, error) {
+			if closer, ok := reader.(io.Closer); ok {
+				defer closer.Close()
+			}
+			return io.ReadAll(reader)
+		}),
+	}
+	return element, nil
+}
+
+// リポジトリ上のファイルを削除するCommitElementを作成する。
+func MakeCommitElementForDelete(repoPath string) (*CommitElement, error) {
+	if repoPath == "" {
+		return nil, errors.New("repoPath is empty.")
+	}
+	element := &CommitElement{
+		pathInRepo: repoPath,
+		deleted:    true,
+	}
+	return element, nil
+}
+
+// 空のリポジトリかを確認する。状態を詳しく知りたい場合はGetRepoStateを使う
 func (gitInfo *GitInfo) IsEmptyRepository() (bool, error) {
-	git, err := githubapi.GetGitClient(&gitInfo.client.Token, gitInfo.client.Owner, gitInfo.client.Repository, &gitInfo.client.Branch)
+	git, err := gitInfo.githubClient()
 	if err != nil {
 		return false, err
 	}
@@ -118,7 +339,7 @@ func (gitInfo *GitInfo) IsEmptyRepository() (bool, error) {
 }
 
 func (gitInfo *GitInfo) CreatePrivateRepo() error {
-	git, err := githubapi.GetGitClient(&gitInfo.client.Token, gitInfo.client.Owner, gitInfo.client.Repository, &gitInfo.client.Branch)
+	git, err := gitInfo.githubClient()
 	if err != nil {
 		return err
 	}
@@ -126,7 +347,7 @@ func (gitInfo *GitInfo) CreatePrivateRepo() error {
 }
 
 func (gitInfo *GitInfo) DeletePrivateRepo() error {
-	git, err := githubapi.GetGitClient(&gitInfo.client.Token, gitInfo.client.Owner, gitInfo.client.Repository, &gitInfo.client.Branch)
+	git, err := gitInfo.githubClient()
 	if err != nil {
 		return err
 	}
@@ -135,7 +356,46 @@ func (gitInfo *GitInfo) DeletePrivateRepo() error {
 
 // ローカルのパスを指定しコミットを作る。指定したパスはリポジトリのルートと認識しそれに応じたパスでコミットを作成する。
 func (gitInfo *GitInfo) CreateCommitByLocalDir(commitMsg string, localPath string) (*githubapi.CreateCommitResponse, error) {
-	commitEleList, err := MakeCommitElementListByLocalPath(localPath)
+	return gitInfo.CreateCommitByLocalDirWithOption(commitMsg, localPath, nil)
+}
+
+// ローカルのパスとオプションを指定しコミットを作る。
+func (gitInfo *GitInfo) CreateCommitByLocalDirWithOption(commitMsg string, localPath string, option *LocalDirOption) (*githubapi.CreateCommitResponse, error) {
+	if option == nil {
+		option = &LocalDirOption{}
+	}
+	if option.Progress == nil && gitInfo.progress != nil {
+		withProgress := *option
+		withProgress.Progress = gitInfo.progress
+		option = &withProgress
+	}
+	commitEleList, err := MakeCommitElementListByLocalPathWithOption(localPath, option)
+	if err != nil {
+		return nil, fmt.Errorf("error occured when make commitElementList. %w", err)
+	}
+	createCommitResp, err := gitInfo.CreateCommitByElement(commitMsg, commitEleList)
+	if err != nil {
+		return nil, fmt.Errorf("error occured when createCommit. %w", err)
+	}
+	return createCommitResp, nil
+}
+
+// fs.FSのファイルでコミットを作る。fsysのルートをリポジトリのルートとしてCreateCommitByLocalDirと同じように扱う。
+func (gitInfo *GitInfo) CreateCommitByFS(commitMsg string, fsys fs.FS) (*githubapi.CreateCommitResponse, error) {
+	return gitInfo.CreateCommitByFSWithOption(commitMsg, fsys, nil)
+}
+
+// fs.FSとオプションを指定しコミットを作る。
+func (gitInfo *GitInfo) CreateCommitByFSWithOption(commitMsg string, fsys fs.FS, option *LocalDirOption) (*githubapi.CreateCommitResponse, error) {
+	if option == nil {
+		option = &LocalDirOption{}
+	}
+	if option.Progress == nil && gitInfo.progress != nil {
+		withProgress := *option
+		withProgress.Progress = gitInfo.progress
+		option = &withProgress
+	}
+	commitEleList, err := MakeCommitElementListByFS(fsys, option)
 	if err != nil {
 		return nil, fmt.Errorf("error occured when make commitElementList. %w", err)
 	}
@@ -147,74 +407,108 @@ func (gitInfo *GitInfo) CreateCommitByLocalDir(commitMsg string, localPath strin
 }
 
 // 作成したCommitElement配列を指定してコミットを作成する。戻り値はCreateCommit APIのレスポンス構造体 CommitIDにはcoreateCommitResponse.Shaでアクセスできる。
+// コミット中にブランチが更新された場合は、最新のコミットを元に作り直す。
 func (gitInfo *GitInfo) CreateCommitByElement(commitMsg string, elementList []*CommitElement) (*githubapi.CreateCommitResponse, error) {
-	git := gitInfo.client
-	var isEmptyRepo bool
+	groupList := []*CommitGroup{{Message: commitMsg, Elements: elementList}}
+	respList, err := gitInfo.CreateCommitChain(groupList)
+	if err != nil {
+		return nil, err
+	}
+	return respList[0], nil
+}
 
-	//refを取得して最新commitを確認
-	ref, err := git.GetLatestRef()
+// 変更内容のblobを作成し、baseを元にしたtreeを作成する。変更がない場合は元のtreeをそのまま返す。
+func (gitInfo *GitInfo) writeTree(base *baseTree, changeList []*fileChange, uploaded map[string]bool, progress *progressReporter) (string, error) {
+	git, err := gitInfo.objectProvider()
 	if err != nil {
-		return nil, fmt.Errorf("error occured when get the latest ref. %w", err)
+		return "", err
 	}
-	isEmptyRepo = (ref.Ref == "")
 
-	//最新commitを取得してbasetree取得
-	var commitResp *githubapi.CommitResponse
-	if !isEmptyRepo {
-		commitResp, err = git.GetCommit(ref.Object.Sha)
-		if err != nil {
-			return nil, fmt.Errorf("error occured when get the latest commit. %q", err)
+	//アップロードするblobの件数とサイズ
+	uploadProgress := Progress{Phase: PhaseUpload}
+	counted := make(map[string]bool)
+	for _, change := range changeList {
+		if needsUpload(change, uploaded) && !counted[change.sha] {
+			counted[change.sha] = true
+			uploadProgress.Total++
+			if change.size > 0 {
+				uploadProgress.TotalBytes += int64(change.size)
+			}
 		}
-	} else {
-		commitResp = &githubapi.CommitResponse{}
 	}
+	progress.report(uploadProgress)
 
-	//CommitElementをループしてblobを作成
+	//変更のあるファイルのblobを作成
 	var treeDataEleList []*githubapi.TreeDataElement
-	for _, element := range elementList {
-		blobData, err := getBlobDataByElement(element)
-		if err != nil {
-			return nil, fmt.Errorf("error occured when create blobData. %w", err)
+	for _, change := range changeList {
+		switch change.action {
+		case ActionUnchanged:
+			continue
+		case ActionDelete:
+			//削除はshaをnullにしたtree要素で表現する
+			treeDataEleList = append(treeDataEleList, &githubapi.TreeDataElement{
+				Path: change.path,
+				Mode: change.baseEntry.Mode,
+				Type: change.baseEntry.Type,
+			})
+			continue
 		}
-		createBlobResp, err := git.CreateBlob(blobData)
-		if err != nil {
-			return nil, fmt.Errorf("error occured when create blob %w", err)
-		}
-		element.blobSha = createBlobResp.Sha //blob id 更新
-
-		treeDataEle := &githubapi.TreeDataElement{
-			Path: element.pathInRepo,
-			Mode: "100644",
-			Type: "blob",
-			Sha:  element.blobSha,
+		if needsUpload(change, uploaded) {
+			data, err := change.load()
+			if err != nil {
+				return "", fmt.Errorf("error occured when read %s. %w", change.path, err)
+			}
+			blobSha, err := git.PutBlob(data)
+			if err != nil {
+				return "", fmt.Errorf("error occured when create blob %w", err)
+			}
+			change.sha = blobSha
+			uploaded[change.sha] = true
+			if err := gitInfo.journal.recordBlob(change.path, change.sha); err != nil {
+				return "", err
+			}
+			uploadProgress.Current++
+			uploadProgress.Bytes += int64(len(data))
+			uploadProgress.Path = change.path
+			progress.report(uploadProgress)
 		}
-		treeDataEleList = append(treeDataEleList, treeDataEle)
+		treeDataEleList = append(treeDataEleList, &githubapi.TreeDataElement{
+			Path: change.path,
+			Mode: change.mode,
+			Type: change.objType,
+			Sha:  change.sha,
+		})
 	}
 
 	//作成したblobをまとめるtreeを作成
-	var baseTree *string
-	if isEmptyRepo {
-		baseTree = nil
-	} else {
-		baseTree = &commitResp.Tree.Sha
-	}
-	tree := &githubapi.TreeData{
-		Base_tree: baseTree,
-		Tree:      treeDataEleList,
+	progress.step(PhaseTree, false)
+	if len(treeDataEleList) == 0 && base.rootSha != "" {
+		progress.step(PhaseTree, true)
+		return base.rootSha, nil
 	}
-	createTreeResp, err := git.CreateTree(tree)
+	treeSha, err := putTree(git, base, treeDataEleList)
 	if err != nil {
-		return nil, fmt.Errorf("error occured when create tree. %w", err)
+		return "", fmt.Errorf("error occured when create tree. %w", err)
 	}
+	progress.step(PhaseTree, true)
+	return treeSha, nil
+}
 
-	//commit:date
-	now := time.Now()
-	loc, _ := time.LoadLocation("Asia/Tokyo")
+// blobのアップロードが必要かを返す
+func needsUpload(change *fileChange, uploaded map[string]bool) bool {
+	return (change.action == ActionAdd || change.action == ActionModify) && change.load != nil && !uploaded[change.sha]
+}
 
+// treeを指定してcommitを作成する。parentShaが空の場合は親のないcommitになる。
+func (gitInfo *GitInfo) writeCommit(commitMsg string, treeSha string, parentSha string) (*githubapi.CreateCommitResponse, error) {
+	git, err := gitInfo.objectProvider()
+	if err != nil {
+		return nil, err
+	}
 	//commitを作成
 	var parents []string
-	if !isEmptyRepo {
-		parents = append(parents, commitResp.Sha)
+	if parentSha != "" {
+		parents = append(parents, parentSha)
 	}
 	commitData := &githubapi.CommitData{
 		Message: commitMsg,
@@ -225,41 +519,57 @@ func (gitInfo *GitInfo) CreateCommitByElement(commitMsg string, elementList []*C
 		}{
 			Name:  gitInfo.author_name,
 			Email: gitInfo.author_email,
-			Date:  now.In(loc).Format("2006-01-02T15:04:05+09:00"),
+			Date:  commitDate(),
 		},
 		Parents: parents,
-		Tree:    createTreeResp.SHA,
+		Tree:    treeSha,
 	}
-	createCommitResp, err := git.CreateCommit(commitData)
+	createCommitResp, err := git.PutCommit(commitData)
 	if err != nil {
 		return nil, fmt.Errorf("error occured when CreateCommit. %w", err)
 	}
+	return createCommitResp, nil
+}
 
-	//refの更新
-	if isEmptyRepo {
-		//空のリポジトリだった場合はref作成
-		refData := &githubapi.CreateRefData{
-			Ref: fmt.Sprintf("ref/head/%s", git.Branch),
-			Sha: createCommitResp.Sha,
-		}
-		updateRefResp, err := git.CreateRef(refData)
-		if err != nil {
-			return nil, fmt.Errorf("error occured when CreateRef. %w", err)
-		}
-		fmt.Printf(updateRefResp.Ref)
-	} else {
-		//これ以前のコミットがある場合はref更新
-		refData := &githubapi.UpdRefData{
-			Sha:   createCommitResp.Sha,
-			Force: false,
-		}
-		updRefResp, err := git.UpdateRef(refData)
-		if err != nil {
-			return nil, fmt.Errorf("error occured when UpdateRef. %w", err)
-		}
-		fmt.Printf(updRefResp.Ref)
+// コミットの日時(日本時間)
+func commitDate() string {
+	now := time.Now()
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	return now.In(loc).Format("2006-01-02T15:04:05+09:00")
+}
+
+// ブランチのrefをpreviousShaからcommitShaに更新する。previousShaが空の場合は空のリポジトリとしてrefを作成する。
+// ブランチが他のコミットで更新されていた場合はErrBranchMovedを返す。
+func (gitInfo *GitInfo) updateBranchRef(commitSha string, previousSha string) error {
+	git, err := gitInfo.objectProvider()
+	if err != nil {
+		return err
 	}
-	return createCommitResp, nil
+	return git.UpdateBranch(commitSha, previousSha)
+}
+
+// ブランチの最新コミットとそのtree。空のリポジトリの場合はどちらも空
+type branchHead struct {
+	commitSha string
+	treeSha   string
+}
+
+// ブランチの最新コミットを取得する
+func (gitInfo *GitInfo) getBranchHead() (*branchHead, error) {
+	commitSha, treeSha, err := gitInfo.provider.BranchHead()
+	if err != nil {
+		return nil, err
+	}
+	return &branchHead{commitSha: commitSha, treeSha: treeSha}, nil
+}
+
+// ブランチの最新コミットのtreeを取得する
+func (gitInfo *GitInfo) getBaseTree() (*baseTree, error) {
+	head, err := gitInfo.getBranchHead()
+	if err != nil {
+		return nil, err
+	}
+	return newBaseTree(gitInfo.provider, head.treeSha), nil
 }
 
 // 文字列がbase64エンコードされたものかを確認する。
@@ -279,44 +589,34 @@ func isBase64(s string) bool {
 	return true
 }
 
-// CommitElementからBlobData構造体を返す。elementがローカルパスを持つ場合は、対象ファイルのcontentをbinaryでBlobを作る。
-func getBlobDataByElement(element *CommitElement) (*githubapi.BlobData, error) {
-	var blobData *githubapi.BlobData
+// CommitElementのファイル内容を返す。elementがローカルパスを持つ場合は、対象ファイルの内容を読み込む。
+func readElementContent(element *CommitElement) ([]byte, error) {
+	if element.reader != nil {
+		return element.reader()
+	}
+	if element.data != nil {
+		return element.data, nil
+	}
+	if element.fsys != nil {
+		return fs.ReadFile(element.fsys, element.pathInFS)
+	}
 	if element.pathInLocal != "" {
 		//ローカルパス指定
-		file, err := os.Open(element.pathInLocal)
-		if err != nil {
-			return nil, err
-		}
-		defer file.Close()
-		var data []byte
-		buf := make([]byte, 4096)
-		for {
-			n, err := file.Read(buf)
-			if err == io.EOF {
-				break
-			}
-			data = append(data, buf[:n]...)
-		}
-		encoded := base64.StdEncoding.EncodeToString(data)
-		blobData = &githubapi.BlobData{
-			Content:  encoded,
-			Encoding: "base64",
-		}
-	} else if element.content != "" && element.encodingType != 0 {
-		//content指定
-		var encStr string
-		if element.encodingType == FormattedBinary {
-			encStr = "base64"
-		} else if element.encodingType == Utf8 {
-			encStr = "utf8"
-		} else {
-			return nil, errors.New("elementのencodingが不正です。")
-		}
-		blobData = &githubapi.BlobData{
-			Content:  element.content,
-			Encoding: encStr,
-		}
+		return os.ReadFile(element.pathInLocal)
+	}
+	//content指定
+	if element.encodingType == FormattedBinary {
+		return base64.StdEncoding.DecodeString(element.content)
+	} else if element.encodingType == Utf8 {
+		return []byte(element.content), nil
+	}
+	return nil, errors.New("elementのencodingが不正です。")
+}
+
+// APIに送る内容の形式を選ぶ。UTF-8のテキストはそのまま、それ以外はbase64でエンコードする
+func encodeContent(data []byte) (string, Encoding) {
+	if utf8.Valid(data) && !isBinaryData(data) {
+		return string(data), Utf8
 	}
-	return blobData, nil
+	return base64.StdEncoding.EncodeToString(data), FormattedBinary
 }
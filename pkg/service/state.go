@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// リポジトリとブランチの状態
+type RepoState string
+
+const (
+	RepoNotFound      RepoState = "not found"      //リポジトリが存在しない。アクセス権のないプライベートリポジトリも含む
+	RepoInaccessible  RepoState = "inaccessible"   //トークンが無効、またはアクセスが拒否された
+	RepoEmpty         RepoState = "empty"          //コミットが1つもない
+	RepoBranchMissing RepoState = "branch missing" //コミットはあるがブランチが存在しない
+	RepoReady         RepoState = "ready"          //ブランチが存在する
+)
+
+// GetRepoStateの結果
+type RepoStatus struct {
+	State         RepoState
+	DefaultBranch string //RepoNotFound、RepoInaccessibleの場合は空
+	HeadSha       string //ブランチの最新コミット。RepoReadyの場合のみ
+	Detail        string //RepoInaccessibleの場合のAPIのレスポンス
+}
+
+// リポジトリと対象ブランチの状態を取得する。状態の判定に使うAPIが想定外のエラーを返した場合はerrorを返す。
+func (gitInfo *GitInfo) GetRepoState() (*RepoStatus, error) {
+	git, err := gitInfo.githubClient()
+	if err != nil {
+		return nil, err
+	}
+	repoResp, _, err := git.GetRepoInfo()
+	var apiErr *githubapi.ApiError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusNotFound:
+			return &RepoStatus{State: RepoNotFound}, nil
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return &RepoStatus{State: RepoInaccessible, Detail: apiErr.Body}, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error occured when get repository. %w", err)
+	}
+
+	status := &RepoStatus{DefaultBranch: repoResp.Default_branch}
+	ref, err := git.GetLatestRef()
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		status.State = RepoBranchMissing
+		return status, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error occured when get the latest ref. %w", err)
+	}
+	if ref.Ref == "" {
+		status.State = RepoEmpty
+		return status, nil
+	}
+	status.State = RepoReady
+	status.HeadSha = ref.Object.Sha
+	return status, nil
+}
+
+// リポジトリが存在し、アクセスできるかを返す。
+func (gitInfo *GitInfo) IsExistRepo() (bool, error) {
+	return gitInfo.provider.IsExistRepo()
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// サブモジュールを表すtree要素のモード
+const gitlinkMode = "160000"
+
+// サブモジュールの設定ファイル
+const gitmodulesPath = ".gitmodules"
+
+// MakeCommitElementForSubmoduleのオプション
+type SubmoduleOption struct {
+	Url    string //.gitmodulesのurl。新しいサブモジュールの場合は必須。既存のサブモジュールで指定した場合は書き換える
+	Name   string //.gitmodulesのsubmoduleの名前。空の場合はパス。既存のサブモジュールでは無視する
+	Branch string //.gitmodulesのbranch。空の場合は変更しない
+}
+
+var commitShaRgx = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// サブモジュールの参照先(gitlink)をcommitShaに設定するCommitElementを作成する。
+// optionがnilまたはUrlが空の場合は既存のサブモジュールの更新のみで、.gitmodulesに登録されていないパスはエラーにする。
+// Urlを指定した場合は新しいサブモジュールも追加でき、.gitmodulesを同じコミットで更新する。
+func MakeCommitElementForSubmodule(repoPath string, commitSha string, option *SubmoduleOption) (*CommitElement, error) {
+	repoPath = strings.Trim(repoPath, "/")
+	if repoPath == "" {
+		return nil, errors.New("repoPath is empty.")
+	}
+	if repoPath == gitmodulesPath {
+		return nil, errors.New(".gitmodules cannot be a submodule.")
+	}
+	if !commitShaRgx.MatchString(commitSha) {
+		return nil, fmt.Errorf("invalid commit sha %q.", commitSha)
+	}
+	if option == nil {
+		option = &SubmoduleOption{}
+	}
+	if strings.ContainsAny(option.Url+option.Name+option.Branch, "\n\"\\") {
+		return nil, errors.New("url, name and branch must not contain newlines, quotes or backslashes.")
+	}
+	element := &CommitElement{
+		pathInRepo: repoPath,
+		blobSha:    commitSha,
+		mode:       gitlinkMode,
+		submodule:  option,
+	}
+	return element, nil
+}
+
+// サブモジュールのCommitElementをgitlinkの変更内容に変換し、必要な場合は.gitmodulesを書き換える
+func prepareSubmoduleChange(base *baseTree, element *CommitElement, modules *gitmodulesFile) (*fileChange, error) {
+	entry, err := base.lookup(element.pathInRepo)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil && entry.Mode != gitlinkMode {
+		return nil, fmt.Errorf("%s is not a submodule.", element.pathInRepo)
+	}
+	if err := modules.load(base); err != nil {
+		return nil, fmt.Errorf("error occured when read .gitmodules. %w", err)
+	}
+	option := element.submodule
+	section := modules.sectionByPath(element.pathInRepo)
+	if option.Url == "" && (entry == nil || section == nil) {
+		return nil, fmt.Errorf("%s is not a submodule. set url to add a new submodule.", element.pathInRepo)
+	}
+	var name string
+	if section != nil {
+		name = section.name
+	} else {
+		name = option.Name
+		if name == "" {
+			name = element.pathInRepo
+		}
+		if modules.sectionByName(name) != nil {
+			return nil, fmt.Errorf("submodule %q already exists in .gitmodules.", name)
+		}
+		modules.addSection(name)
+		modules.set(name, "path", element.pathInRepo)
+	}
+	if option.Url != "" {
+		modules.set(name, "url", option.Url)
+	}
+	if option.Branch != "" {
+		modules.set(name, "branch", option.Branch)
+	}
+	change := &fileChange{
+		path:    element.pathInRepo,
+		mode:    gitlinkMode,
+		objType: "commit",
+		sha:     element.blobSha,
+		size:    -1,
+	}
+	if err := change.compareWithBase(base); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// .gitmodulesの内容。書き換えた行以外はそのまま残す
+type gitmodulesFile struct {
+	lines    []string
+	sections []*gitmodulesSection
+	changed  bool
+	loaded   bool
+}
+
+// .gitmodulesの[submodule "name"]の範囲
+type gitmodulesSection struct {
+	name  string
+	start int //見出しの行
+	end   int //次の見出しの行(最後の場合は行数)
+}
+
+var gitmodulesSectionRgx = regexp.MustCompile(`^\s*\[\s*submodule\s+"((?:[^"\\]|\\.)*)"\s*\]`)
+var gitmodulesHeaderRgx = regexp.MustCompile(`^\s*\[`)
+var gitmodulesKeyRgx = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z0-9-]*)\s*(?:=\s*(.*?))?\s*$`)
+
+// baseの.gitmodulesを読み込む。存在しない場合は空にする
+func (modules *gitmodulesFile) load(base *baseTree) error {
+	if modules.loaded {
+		return nil
+	}
+	modules.loaded = true
+	entry, err := base.lookup(gitmodulesPath)
+	if err != nil || entry == nil {
+		return err
+	}
+	if entry.Type != "blob" {
+		return errors.New(".gitmodules is not a file.")
+	}
+	data, err := base.readBlob(entry.Sha)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		modules.lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	modules.parse()
+	return nil
+}
+
+func (modules *gitmodulesFile) parse() {
+	modules.sections = nil
+	var current *gitmodulesSection
+	for i, line := range modules.lines {
+		if !gitmodulesHeaderRgx.MatchString(line) {
+			continue
+		}
+		if current != nil {
+			current.end = i
+		}
+		current = nil
+		if match := gitmodulesSectionRgx.FindStringSubmatch(line); match != nil {
+			current = &gitmodulesSection{name: strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(match[1]), start: i}
+			modules.sections = append(modules.sections, current)
+		}
+	}
+	if current != nil {
+		current.end = len(modules.lines)
+	}
+}
+
+// セクション内のkeyの値と行を返す。ない場合は-1を返す
+func (modules *gitmodulesFile) get(section *gitmodulesSection, key string) (string, int) {
+	for i := section.start + 1; i < section.end; i++ {
+		line := strings.TrimSpace(modules.lines[i])
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		match := gitmodulesKeyRgx.FindStringSubmatch(line)
+		if match != nil && strings.EqualFold(match[1], key) {
+			value := match[2]
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			return value, i
+		}
+	}
+	return "", -1
+}
+
+func (modules *gitmodulesFile) sectionByPath(path string) *gitmodulesSection {
+	for _, section := range modules.sections {
+		if value, _ := modules.get(section, "path"); strings.Trim(value, "/") == path {
+			return section
+		}
+	}
+	return nil
+}
+
+func (modules *gitmodulesFile) sectionByName(name string) *gitmodulesSection {
+	for _, section := range modules.sections {
+		if section.name == name {
+			return section
+		}
+	}
+	return nil
+}
+
+func (modules *gitmodulesFile) addSection(name string) {
+	modules.lines = append(modules.lines, `[submodule "`+name+`"]`)
+	modules.changed = true
+	modules.parse()
+}
+
+// nameのサブモジュールのkeyの値を設定する。同じ値の場合は何もしない
+func (modules *gitmodulesFile) set(name string, key string, value string) {
+	section := modules.sectionByName(name)
+	current, index := modules.get(section, key)
+	if index >= 0 && current == value {
+		return
+	}
+	line := "\t" + key + " = " + value
+	if index >= 0 {
+		modules.lines[index] = line
+	} else {
+		//セクションの最後の空行でない行の後ろに追加する
+		insert := section.end
+		for insert > section.start+1 && strings.TrimSpace(modules.lines[insert-1]) == "" {
+			insert--
+		}
+		modules.lines = append(modules.lines[:insert], append([]string{line}, modules.lines[insert:]...)...)
+	}
+	modules.changed = true
+	modules.parse()
+}
+
+// 書き換えた.gitmodulesの変更内容を返す
+func (modules *gitmodulesFile) fileChange(base *baseTree) (*fileChange, error) {
+	data := []byte(strings.Join(modules.lines, "\n") + "\n")
+	change := &fileChange{
+		path: gitmodulesPath,
+		sha:  hashBlob(data),
+		size: len(data),
+		load: func() ([]byte, error) { return data, nil },
+	}
+	if err := change.compareWithBase(base); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// ブランチ上のファイル内容を変換関数で書き換えるCommitElementを作成する。
+// transformはコミット作成時に最新のファイル内容を引数に呼ばれ、ブランチの更新によりコミットを作り直す場合は再度呼ばれる。
+// ファイルが存在しない場合はnilが渡される。
+func MakeCommitElementByTransform(repoPath string, transform func([]byte) ([]byte, error)) (*CommitElement, error) {
+	if repoPath == "" {
+		return nil, errors.New("repoPath is empty.")
+	}
+	if transform == nil {
+		return nil, errors.New("transform is nil.")
+	}
+	element := &CommitElement{
+		pathInRepo: repoPath,
+		transform:  transform,
+	}
+	return element, nil
+}
+
+// 変換関数を評価して変換後のファイル内容を返す。あわせて変更前のファイルのtree要素を返す。
+func transformContent(base *baseTree, element *CommitElement) ([]byte, *githubapi.TreeEntryElement, error) {
+	var content []byte
+	entry, err := base.lookup(element.pathInRepo)
+	if err != nil {
+		return nil, nil, err
+	}
+	if entry != nil {
+		if entry.Type != "blob" {
+			return nil, nil, fmt.Errorf("%s is not a file.", element.pathInRepo)
+		}
+		content, err = base.readBlob(entry.Sha)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	transformed, err := element.transform(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	return transformed, entry, nil
+}
+
+// JSONファイルのkeyPath(ドット区切り、配列は添字)の値をvalueに書き換える変換関数を返す。
+// キーの順序とインデントは元のファイルに合わせる。途中のオブジェクトが存在しない場合は作成する。
+func UpdateJSONValue(keyPath string, value any) func([]byte) ([]byte, error) {
+	return func(content []byte) ([]byte, error) {
+		var root any
+		if len(bytes.TrimSpace(content)) == 0 {
+			root = &jsonObject{values: make(map[string]any)}
+		} else {
+			dec := json.NewDecoder(bytes.NewReader(content))
+			dec.UseNumber()
+			var err error
+			root, err = decodeJSONOrdered(dec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid json. %w", err)
+			}
+		}
+		root, err := setJSONValue(root, strings.Split(keyPath, "."), value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot set %s. %w", keyPath, err)
+		}
+		indent := detectJSONIndent(content)
+		var buf bytes.Buffer
+		if err := encodeJSONOrdered(&buf, root, indent, ""); err != nil {
+			return nil, err
+		}
+		if len(content) == 0 || bytes.HasSuffix(content, []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+// キーの出現順を保持するJSONオブジェクト
+type jsonObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func decodeJSONOrdered(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			obj := &jsonObject{values: make(map[string]any)}
+			for dec.More() {
+				keyToken, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, ok := keyToken.(string)
+				if !ok {
+					return nil, errors.New("object key is not a string.")
+				}
+				value, err := decodeJSONOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				if _, exists := obj.values[key]; !exists {
+					obj.keys = append(obj.keys, key)
+				}
+				obj.values[key] = value
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return obj, nil
+		case '[':
+			list := []any{}
+			for dec.More() {
+				value, err := decodeJSONOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return list, nil
+		}
+		return nil, fmt.Errorf("unexpected delimiter %s.", t)
+	default:
+		return t, nil
+	}
+}
+
+func setJSONValue(node any, keys []string, value any) (any, error) {
+	if len(keys) == 0 {
+		return value, nil
+	}
+	key := keys[0]
+	switch n := node.(type) {
+	case *jsonObject:
+		child, exists := n.values[key]
+		if !exists {
+			child = &jsonObject{values: make(map[string]any)}
+			n.keys = append(n.keys, key)
+		}
+		updated, err := setJSONValue(child, keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n.values[key] = updated
+		return n, nil
+	case []any:
+		idx, err := strconv.Atoi(key)
+		if err != nil || idx < 0 || idx >= len(n) {
+			return nil, fmt.Errorf("invalid array index %s.", key)
+		}
+		updated, err := setJSONValue(n[idx], keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[idx] = updated
+		return n, nil
+	case nil:
+		return setJSONValue(&jsonObject{values: make(map[string]any)}, keys, value)
+	default:
+		return nil, fmt.Errorf("%s is not an object.", key)
+	}
+}
+
+func encodeJSONOrdered(w io.Writer, node any, indent string, prefix string) error {
+	newline := "\n"
+	if indent == "" {
+		newline = ""
+	}
+	switch n := node.(type) {
+	case *jsonObject:
+		if len(n.keys) == 0 {
+			_, err := io.WriteString(w, "{}")
+			return err
+		}
+		io.WriteString(w, "{"+newline)
+		for i, key := range n.keys {
+			keyData, _ := json.Marshal(key)
+			io.WriteString(w, prefix+indent+string(keyData)+":")
+			if indent != "" {
+				io.WriteString(w, " ")
+			}
+			if err := encodeJSONOrdered(w, n.values[key], indent, prefix+indent); err != nil {
+				return err
+			}
+			if i < len(n.keys)-1 {
+				io.WriteString(w, ",")
+			}
+			io.WriteString(w, newline)
+		}
+		_, err := io.WriteString(w, prefix+"}")
+		return err
+	case []any:
+		if len(n) == 0 {
+			_, err := io.WriteString(w, "[]")
+			return err
+		}
+		io.WriteString(w, "["+newline)
+		for i, value := range n {
+			io.WriteString(w, prefix+indent)
+			if err := encodeJSONOrdered(w, value, indent, prefix+indent); err != nil {
+				return err
+			}
+			if i < len(n)-1 {
+				io.WriteString(w, ",")
+			}
+			io.WriteString(w, newline)
+		}
+		_, err := io.WriteString(w, prefix+"]")
+		return err
+	default:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent(prefix, indent)
+		if err := enc.Encode(n); err != nil {
+			return err
+		}
+		_, err := w.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+		return err
+	}
+}
+
+// 2行目の先頭の空白をインデントとみなす。1行のJSONの場合は空文字を返す。
+func detectJSONIndent(content []byte) string {
+	lines := strings.Split(string(content), "\n")
+	if len(bytes.TrimSpace(content)) == 0 {
+		return "  "
+	}
+	if len(lines) < 2 {
+		return ""
+	}
+	line := lines[1]
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+var yamlKeyRgx = regexp.MustCompile(`^(\s*)([^\s#:][^:#]*?|"[^"]*"|'[^']*'):(\s+|$)(.*)$`)
+var yamlPlainRgx = regexp.MustCompile(`^[A-Za-z0-9_./@-][A-Za-z0-9_./@ -]*$`)
+
+// YAMLファイルのkeyPath(ドット区切り)のスカラー値をvalueに書き換える変換関数を返す。
+// ブロック形式のマッピングのみ対応し、コメントやその他の行はそのまま残す。
+func UpdateYAMLValue(keyPath string, value any) func([]byte) ([]byte, error) {
+	return func(content []byte) ([]byte, error) {
+		keys := strings.Split(keyPath, ".")
+		lines := strings.Split(string(content), "\n")
+		type level struct {
+			indent int
+			key    string
+		}
+		var stack []level
+		for i, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+				continue
+			}
+			match := yamlKeyRgx.FindStringSubmatch(line)
+			indent := len(line) - len(strings.TrimLeft(line, " "))
+			for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+				stack = stack[:len(stack)-1]
+			}
+			if match == nil || strings.HasPrefix(trimmed, "- ") {
+				continue
+			}
+			key := strings.Trim(match[2], `"'`)
+			stack = append(stack, level{indent: indent, key: key})
+			if len(stack) != len(keys) {
+				continue
+			}
+			matched := true
+			for j := range keys {
+				if stack[j].key != keys[j] {
+					matched = false
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+			rest := match[4]
+			if rest == "" || strings.HasPrefix(rest, "#") || rest == "|" || rest == ">" {
+				return nil, fmt.Errorf("%s is not a scalar value.", keyPath)
+			}
+			comment := ""
+			if idx := strings.Index(rest, " #"); idx >= 0 && !strings.ContainsAny(rest[:idx], `"'`) {
+				comment = rest[idx:]
+			}
+			lines[i] = line[:len(line)-len(rest)] + formatYAMLScalar(value) + comment
+			return []byte(strings.Join(lines, "\n")), nil
+		}
+		return nil, fmt.Errorf("key %s not found.", keyPath)
+	}
+}
+
+// YAMLのスカラー値として出力する。特殊文字を含む文字列はダブルクォートで囲む。
+func formatYAMLScalar(value any) string {
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	switch strings.ToLower(s) {
+	case "", "true", "false", "yes", "no", "on", "off", "null", "~":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil || !yamlPlainRgx.MatchString(s) || strings.HasSuffix(s, " ") {
+		return strconv.Quote(s)
+	}
+	return s
+}
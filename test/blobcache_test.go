@@ -0,0 +1,114 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestBlobCache(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	dir := writeLocalFiles(t, map[string]string{"a.txt": "aaa\n", "b.txt": "bbb\n", "c.txt": "ccc\n"})
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.Chtimes(filepath.Join(dir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	cache, err := service.OpenBlobCache(cachePath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitInfo := fake.gitInfo(t, "main")
+	gitInfo.SetBlobCache(cache)
+	if _, err := gitInfo.CreateCommitByLocalDir("add files", dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	//保存したキャッシュを読み込めること
+	cache, err = service.OpenBlobCache(cachePath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 3 {
+		t.Fatalf("expected 3 cache entries, got %d", cache.Len())
+	}
+	gitInfo.SetBlobCache(cache)
+
+	//サイズと更新時刻が同じファイルは読み込まずにキャッシュのshaを使う
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("xxx\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := gitInfo.PlanCommitByLocalDir("plan", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.HasChanges() {
+		t.Errorf("cached files should be treated as unchanged.\n%s", plan)
+	}
+
+	//無効化したファイルは読み込み直す
+	cache.Invalidate(filepath.Join(dir, "a.txt"))
+	plan, err = gitInfo.PlanCommitByLocalDir("plan", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.HasChanges() {
+		t.Error("invalidated file should be read again.")
+	}
+
+	//更新時刻が変わったファイルは読み込み直す
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("yyy\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	blobs := fake.countCalls("POST", "/repos/owner/repo/git/blobs")
+	if _, err := gitInfo.CreateCommitByLocalDir("update files", dir); err != nil {
+		t.Fatal(err)
+	}
+	if count := fake.countCalls("POST", "/repos/owner/repo/git/blobs") - blobs; count != 2 {
+		t.Errorf("expected 2 blobs to be uploaded, got %d", count)
+	}
+	if content, _ := fake.fileContent("main", "b.txt"); content != "yyy\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	//更新直後のファイルはキャッシュしない
+	if cache.Len() != 3-1 {
+		t.Errorf("recently modified file should not be cached, got %d entries", cache.Len())
+	}
+
+	//件数の上限を超えた分は保存時に削除する
+	cache, err = service.OpenBlobCache(cachePath, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected 1 cache entry, got %d", cache.Len())
+	}
+
+	//壊れたキャッシュは空として扱う
+	if err := os.WriteFile(cachePath, []byte("{broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cache, err = service.OpenBlobCache(cachePath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("broken cache should be empty, got %d entries", cache.Len())
+	}
+}
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"path/filepath"
+	"testing"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// ファイルを1つずつ追加するn個のCommitGroupを作成する
+func chainGroups(n int) []*service.CommitGroup {
+	var groupList []*service.CommitGroup
+	for i := 1; i <= n; i++ {
+		name := string(rune('a'+i-1)) + ".txt"
+		element, _ := service.MakeCommitElementByFileData(name, name+"\n", service.Utf8)
+		groupList = append(groupList, &service.CommitGroup{Message: "add " + name, Elements: []*service.CommitElement{element}})
+	}
+	return groupList
+}
+
+func TestCreateCommitChain(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	baseSha := fake.seed("main", map[string]string{"README.md": "readme\n"})
+	gitInfo := fake.gitInfo(t, "main")
+
+	//コミットを積み重ね、refは最後に1度だけ更新する
+	respList, err := gitInfo.CreateCommitChain(chainGroups(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := fake.countCalls("PATCH", "/repos/owner/repo/git/refs/"); count != 1 {
+		t.Errorf("ref should be updated once, got %d", count)
+	}
+	if len(respList) != 3 || fake.refs["refs/heads/main"] != respList[2].Sha {
+		t.Fatalf("unexpected commits %+v", respList)
+	}
+	parent := baseSha
+	for i, resp := range respList {
+		if parents := fake.commitParents(resp.Sha); len(parents) != 1 || parents[0] != parent {
+			t.Errorf("commit %d should follow %s. %v", i+1, parent, parents)
+		}
+		parent = resp.Sha
+	}
+	if len(fake.files("main")) != 4 {
+		t.Errorf("unexpected files %v", fake.files("main"))
+	}
+
+	//2つ目のグループでblob、tree、commitの作成に失敗した場合はブランチを更新しない
+	for _, path := range []string{"/git/blobs", "/git/trees", "/git/commits"} {
+		t.Run(path, func(t *testing.T) {
+			fake := newFakeGitHub(t, "owner", "repo")
+			baseSha := fake.seed("main", map[string]string{"README.md": "readme\n"})
+			fake.failWhen = failNth("POST", path, 2)
+			if _, err := fake.gitInfo(t, "main").CreateCommitChain(chainGroups(3)); err == nil {
+				t.Fatal("chain should fail.")
+			}
+			if fake.refs["refs/heads/main"] != baseSha {
+				t.Errorf("branch should not be updated. %s", fake.refs["refs/heads/main"])
+			}
+			if count := fake.countCalls("PATCH", "/repos/owner/repo/git/refs/"); count != 0 {
+				t.Errorf("ref should not be updated, got %d", count)
+			}
+		})
+	}
+}
+
+func TestCreateCommitChainJournalError(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	journal, err := service.OpenJournal(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitInfo := fake.gitInfo(t, "main")
+	gitInfo.SetJournal(journal)
+
+	//ブランチの更新後にジャーナルを破棄できない場合は作成したコミットと一緒にエラーを返す
+	fake.beforeUpdateRef = func() { journal.Close() }
+	respList, err := gitInfo.CreateCommitChain(chainGroups(2))
+	if err == nil {
+		t.Fatal("journal error should be returned.")
+	}
+	if len(respList) != 2 || fake.refs["refs/heads/main"] != respList[1].Sha {
+		t.Errorf("created commits should be returned. %+v %v", respList, err)
+	}
+}
@@ -0,0 +1,96 @@
+package test
+
+import (
+	"testing"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestContentsCommit(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	seedSha := fake.seed("main", map[string]string{"README.md": "readme\n", "docs/old.txt": "old\n", "run.sh": "echo run\n"})
+	hook := &beforeRequestHook{suffix: "/contents/README.md"}
+	client := &githubapi.GitClient{
+		Token:      fake.token,
+		Owner:      fake.owner,
+		Repository: fake.repo,
+		Branch:     "main",
+		BaseUrl:    fake.server.URL,
+		Hooks:      []githubapi.Hook{hook},
+	}
+	gitInfo, err := service.GetGitInfoByClient(client, "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitCalls := func() int {
+		return fake.countCalls("POST", "/repos/owner/repo/git/") + fake.countCalls("PATCH", "/repos/owner/repo/git/")
+	}
+
+	//1ファイルの追加はContents APIの1リクエストで作成する
+	add, _ := service.MakeCommitElementByFileData("docs/new file.txt", "new\n", service.Utf8)
+	resp, err := gitInfo.CreateCommitByElement("add new file", []*service.CommitElement{add})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.countCalls("PUT", "/repos/owner/repo/contents/") != 1 || gitCalls() != 0 {
+		t.Errorf("commit should be created by the contents api. %v", fake.calls)
+	}
+	if fake.refs["refs/heads/main"] != resp.Sha || len(resp.Parents) != 1 || resp.Parents[0].Sha != seedSha || resp.Message != "add new file" {
+		t.Errorf("unexpected commit %+v", resp)
+	}
+	if content, _ := fake.fileContent("main", "docs/new file.txt"); content != "new\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+	//git data APIと同じくcommitterもauthorにする
+	if author, committer := fake.commitHeader(resp.Sha, "author"), fake.commitHeader(resp.Sha, "committer"); author != "tester <tester@example.com>" || committer != author {
+		t.Errorf("unexpected author %q committer %q", author, committer)
+	}
+
+	//削除
+	remove, _ := service.MakeCommitElementForDelete("docs/old.txt")
+	removeResp, err := gitInfo.CreateCommitByElement("remove old", []*service.CommitElement{remove})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committer := fake.commitHeader(removeResp.Sha, "committer"); committer != "tester <tester@example.com>" {
+		t.Errorf("unexpected committer %q", committer)
+	}
+	if _, ok := fake.files("main")["docs/old.txt"]; ok || fake.countCalls("DELETE", "/repos/owner/repo/contents/docs/old.txt") != 1 {
+		t.Errorf("file should be deleted by the contents api. %v", fake.calls)
+	}
+
+	//実行ビットのあるファイルや複数ファイルの変更はgit data APIで作成する
+	before := gitCalls()
+	script, _ := service.MakeCommitElementByFileData("run.sh", "echo updated\n", service.Utf8)
+	if _, err := gitInfo.CreateCommitByElement("update script", []*service.CommitElement{script}); err != nil {
+		t.Fatal(err)
+	}
+	if gitCalls() == before || fake.files("main")["run.sh"].mode != "100755" {
+		t.Errorf("executable file should be committed by the git data api. %v", fake.calls)
+	}
+	before = gitCalls()
+	a, _ := service.MakeCommitElementByFileData("a.txt", "a\n", service.Utf8)
+	b, _ := service.MakeCommitElementByFileData("b.txt", "b\n", service.Utf8)
+	if _, err := gitInfo.CreateCommitByElement("add a and b", []*service.CommitElement{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	if gitCalls() == before {
+		t.Errorf("multiple files should be committed by the git data api. %v", fake.calls)
+	}
+
+	//ファイルが他のコミットで更新された場合は最新の内容を元に作り直す
+	var movedSha string
+	hook.fn = func() { movedSha = fake.seed("main", map[string]string{"README.md": "changed by others\n"}) }
+	modify, _ := service.MakeCommitElementByFileData("README.md", "updated\n", service.Utf8)
+	resp, err = gitInfo.CreateCommitByElement("update readme", []*service.CommitElement{modify})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.countCalls("PUT", "/repos/owner/repo/contents/README.md") != 2 || resp.Parents[0].Sha != movedSha {
+		t.Errorf("commit should be retried on the moved branch. %v", fake.calls)
+	}
+	if content, _ := fake.fileContent("main", "README.md"); content != "updated\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+}
@@ -0,0 +1,126 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// 読み込みと終了の回数を数えるreader
+type countingReader struct {
+	io.Reader
+	reads  int
+	closed int
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	reader.reads++
+	return reader.Reader.Read(p)
+}
+
+func (reader *countingReader) Close() error {
+	reader.closed++
+	return nil
+}
+
+func TestMakeCommitElementByBytes(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	gitInfo := fake.gitInfo(t, "main")
+
+	text := []byte("hello\r\nworld\n")
+	binary := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	textElement, err := service.MakeCommitElementByBytes("hello.txt", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binaryElement, _ := service.MakeCommitElementByBytes("image.png", binary)
+	emptyElement, _ := service.MakeCommitElementByBytes("empty", nil)
+	//作成後に元のスライスを書き換えても影響しない
+	text[0] = 'H'
+	if _, err := service.MakeCommitElementByBytes("", text); err == nil {
+		t.Error("empty repoPath should be rejected.")
+	}
+
+	if _, err := gitInfo.CreateCommitByElement("add files", []*service.CommitElement{textElement, binaryElement, emptyElement}); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{"hello.txt": "hello\r\nworld\n", "image.png": string(binary), "empty": ""} {
+		if got, ok := fake.fileContent("main", path); !ok || got != content {
+			t.Errorf("%s: expected %q, got %q", path, content, got)
+		}
+	}
+	//テキストはutf-8、バイナリはbase64で送る
+	encodings := strings.Join(fake.encodings, ",")
+	if strings.Count(encodings, "utf-8") != 2 || strings.Count(encodings, "base64") != 1 {
+		t.Errorf("unexpected blob encodings %v", fake.encodings)
+	}
+
+	var encType service.Encoding = service.Utf8
+	if _, err := service.MakeCommitElementByFileData("typed.txt", "typed\n", encType); err != nil {
+		t.Error(err)
+	}
+	if _, err := service.MakeCommitElementByFileData("typed.txt", "typed\n", service.Encoding(3)); err == nil {
+		t.Error("invalid encoding should be rejected.")
+	}
+}
+
+func TestMakeCommitElementByReader(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	gitInfo := fake.gitInfo(t, "main")
+
+	content := bytes.Repeat([]byte("line\n"), 10000)
+	reader := &countingReader{Reader: bytes.NewReader(content)}
+	element, err := service.MakeCommitElementByReader("stream.txt", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//作成時には読み込まない
+	if reader.reads != 0 {
+		t.Errorf("reader should not be read when the element is created. %d reads", reader.reads)
+	}
+	//変更内容の確認時に、アップロードの前に全て読み込む
+	if _, err := gitInfo.PlanCommitByElement("plan", []*service.CommitElement{element}); err != nil {
+		t.Fatal(err)
+	}
+	if reader.reads == 0 || reader.closed != 1 || fake.countCalls("POST", "/repos/owner/repo/git/blobs") != 0 {
+		t.Errorf("reader should be read to the end before upload. %d reads, closed %d", reader.reads, reader.closed)
+	}
+
+	//ブランチが更新されてコミットを作り直す場合も同じ内容を使う
+	other, _ := service.MakeCommitElementByBytes("other.txt", []byte("other\n"))
+	fake.beforeUpdateRef = func() { fake.seed("main", map[string]string{"README.md": "changed by others\n"}) }
+	if _, err := gitInfo.CreateCommitByElement("add stream", []*service.CommitElement{element, other}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fake.fileContent("main", "stream.txt"); got != string(content) {
+		t.Errorf("unexpected content of %d bytes", len(got))
+	}
+	if got, _ := fake.fileContent("main", "README.md"); got != "changed by others\n" {
+		t.Errorf("commit should be rebuilt on the moved branch. %q", got)
+	}
+	if reader.closed != 1 {
+		t.Errorf("reader should be closed once, got %d", reader.closed)
+	}
+
+	if _, err := service.MakeCommitElementByReader("nil.txt", nil); err == nil {
+		t.Error("nil reader should be rejected.")
+	}
+	failing, _ := service.MakeCommitElementByReader("fail.txt", io.MultiReader(strings.NewReader("partial"), &failingReader{}))
+	if _, err := gitInfo.CreateCommitByElement("fail", []*service.CommitElement{failing}); !errors.Is(err, errReadFailed) {
+		t.Errorf("expected read error, got %v", err)
+	}
+}
+
+var errReadFailed = errors.New("read failed")
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errReadFailed
+}
@@ -0,0 +1,288 @@
+package test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	giteaapi "github.com/daze-doragon/go-gituse/pkg/giteaapi"
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// テスト用のGitea APIのfake。オブジェクトとブランチはfakeGitHubと同じ方法で保持する。
+type fakeGitea struct {
+	*fakeGitHub
+	giteaServer *httptest.Server
+	pageSize    int //一覧取得APIの1ページの最大件数
+}
+
+// fakeを起動する。テスト終了時に停止する。
+func newFakeGitea(t *testing.T, owner string, repo string) *fakeGitea {
+	fake := &fakeGitea{
+		fakeGitHub: newFakeGitHub(t, owner, repo),
+		pageSize:   100,
+	}
+	fake.giteaServer = httptest.NewServer(fake)
+	t.Cleanup(fake.giteaServer.Close)
+	return fake
+}
+
+// fakeに接続するGitInfoを作成する
+func (fake *fakeGitea) gitInfo(t *testing.T, branch string) *service.GitInfo {
+	client := &giteaapi.GiteaClient{
+		Token:      fake.token,
+		Owner:      fake.owner,
+		Repository: fake.repo,
+		Branch:     branch,
+		BaseUrl:    fake.giteaServer.URL + "/api/v1",
+	}
+	gitInfo, err := service.GetGitInfoByProvider(service.NewGiteaProvider(client), "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gitInfo
+}
+
+func (fake *fakeGitea) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	fake.mu.Lock()
+	fake.calls = append(fake.calls, r.Method+" "+r.URL.Path)
+	hook := fake.beforeUpdateRef
+	if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/contents") {
+		fake.beforeUpdateRef = nil
+	} else {
+		hook = nil
+	}
+	fake.mu.Unlock()
+	if hook != nil {
+		hook()
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if r.Header.Get("Authorization") != "token "+fake.token {
+		writeFakeMessage(w, http.StatusUnauthorized, "token is required")
+		return
+	}
+	prefix := "/api/v1/repos/" + fake.owner + "/" + fake.repo
+	if !strings.HasPrefix(r.URL.Path, prefix) || !fake.exists {
+		writeFakeMessage(w, http.StatusNotFound, "The target couldn't be found.")
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, prefix)
+	query := r.URL.Query()
+	switch {
+	case rest == "" && r.Method == "GET":
+		writeFakeJSON(w, http.StatusOK, map[string]any{
+			"id":             1,
+			"name":           fake.repo,
+			"full_name":      fake.owner + "/" + fake.repo,
+			"default_branch": "main",
+			"empty":          len(fake.refs) == 0,
+		})
+	case rest == "/branches" && r.Method == "GET":
+		var names []string
+		for ref := range fake.refs {
+			names = append(names, strings.TrimPrefix(ref, "refs/heads/"))
+		}
+		sort.Strings(names)
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		if limit <= 0 || limit > fake.pageSize {
+			limit = fake.pageSize
+		}
+		page, _ := strconv.Atoi(query.Get("page"))
+		if page <= 0 {
+			page = 1
+		}
+		branchList := []any{}
+		for i := (page - 1) * limit; i < len(names) && i < page*limit; i++ {
+			branchList = append(branchList, fake.branchJSON(names[i]))
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(names)))
+		writeFakeJSON(w, http.StatusOK, branchList)
+	case strings.HasPrefix(rest, "/branches/") && r.Method == "GET":
+		name := strings.TrimPrefix(rest, "/branches/")
+		if _, ok := fake.refs["refs/heads/"+name]; !ok {
+			writeFakeMessage(w, http.StatusNotFound, "branch does not exist ["+name+"]")
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, fake.branchJSON(name))
+	case strings.HasPrefix(rest, "/git/commits/") && r.Method == "GET":
+		sha := strings.TrimPrefix(rest, "/git/commits/")
+		if obj := fake.objects[sha]; obj == nil || obj.objType != "commit" {
+			writeFakeMessage(w, http.StatusNotFound, "commit not found")
+			return
+		}
+		_, message, _ := strings.Cut(string(fake.objects[sha].data), "\n\n")
+		parents := []map[string]string{}
+		for _, parent := range fake.commitParents(sha) {
+			parents = append(parents, map[string]string{"sha": parent})
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]any{
+			"sha":     sha,
+			"commit":  map[string]any{"message": message, "tree": map[string]string{"sha": fake.commitTree(sha)}},
+			"parents": parents,
+		})
+	case strings.HasPrefix(rest, "/git/trees/") && r.Method == "GET":
+		fake.listTree(w, strings.TrimPrefix(rest, "/git/trees/"), query)
+	case strings.HasPrefix(rest, "/git/blobs/") && r.Method == "GET":
+		sha := strings.TrimPrefix(rest, "/git/blobs/")
+		obj := fake.objects[sha]
+		if obj == nil || obj.objType != "blob" {
+			writeFakeMessage(w, http.StatusNotFound, "blob not found")
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]any{"sha": sha, "size": len(obj.data), "encoding": "base64", "content": base64.StdEncoding.EncodeToString(obj.data)})
+	case rest == "/contents" && r.Method == "POST":
+		fake.changeFiles(w, body)
+	default:
+		writeFakeMessage(w, http.StatusNotFound, "fake does not implement "+r.Method+" "+rest)
+	}
+}
+
+func (fake *fakeGitea) branchJSON(name string) map[string]any {
+	sha := fake.refs["refs/heads/"+name]
+	return map[string]any{"name": name, "commit": map[string]string{"id": sha, "url": "https://gitea.example.com/commit/" + sha}}
+}
+
+// Giteaと同様に、件数がper_pageを超える場合は最後のページでもtruncatedをtrueにする
+func (fake *fakeGitea) listTree(w http.ResponseWriter, sha string, query map[string][]string) {
+	if obj := fake.objects[sha]; obj == nil || obj.objType != "tree" {
+		writeFakeMessage(w, http.StatusNotFound, "tree not found")
+		return
+	}
+	recursive := len(query["recursive"]) > 0 && query["recursive"][0] == "true"
+	entryList := []map[string]any{}
+	var walk func(treeSha string, prefix string)
+	walk = func(treeSha string, prefix string) {
+		for _, entry := range fake.readTree(treeSha) {
+			size := 0
+			if entry.typ == "blob" {
+				size = len(fake.objects[entry.sha].data)
+			}
+			entryList = append(entryList, map[string]any{"path": prefix + entry.name, "mode": entry.mode, "type": entry.typ, "sha": entry.sha, "size": size})
+			if recursive && entry.typ == "tree" {
+				walk(entry.sha, prefix+entry.name+"/")
+			}
+		}
+	}
+	walk(sha, "")
+	perPage, page := fake.pageSize, 1
+	if values := query["per_page"]; len(values) > 0 {
+		if n, _ := strconv.Atoi(values[0]); n > 0 && n < perPage {
+			perPage = n
+		}
+	}
+	if values := query["page"]; len(values) > 0 {
+		if n, _ := strconv.Atoi(values[0]); n > 0 {
+			page = n
+		}
+	}
+	start := min((page-1)*perPage, len(entryList))
+	end := min(start+perPage, len(entryList))
+	writeFakeJSON(w, http.StatusOK, map[string]any{
+		"sha":         sha,
+		"tree":        entryList[start:end],
+		"truncated":   len(entryList) > perPage,
+		"page":        page,
+		"total_count": len(entryList),
+	})
+}
+
+// ChangeFiles APIのfilesを適用してコミットを作成する
+func (fake *fakeGitea) changeFiles(w http.ResponseWriter, body []byte) {
+	var req giteaapi.ChangeFilesData
+	json.Unmarshal(body, &req)
+	ref := "refs/heads/" + req.Branch
+	head, exists := fake.refs[ref]
+	if !exists && len(fake.refs) > 0 {
+		writeFakeMessage(w, http.StatusNotFound, "branch does not exist ["+req.Branch+"]")
+		return
+	}
+	files := make(map[string]fakeTreeEntry)
+	if exists {
+		fake.flatten(fake.commitTree(head), "", files)
+	}
+	fail := func(message string) {
+		writeFakeMessage(w, http.StatusUnprocessableEntity, message)
+	}
+	for _, file := range req.Files {
+		data, err := base64.StdEncoding.DecodeString(file.Content)
+		if err != nil {
+			fail("invalid base64 content")
+			return
+		}
+		source := file.Path
+		if file.From_path != "" {
+			source = file.From_path
+		}
+		current, found := files[source]
+		switch file.Operation {
+		case "create":
+			if found {
+				fail("repository file already exists [path: " + file.Path + "]")
+				return
+			}
+			files[file.Path] = fakeTreeEntry{name: file.Path, mode: "100644", typ: "blob", sha: fake.put("blob", data)}
+		case "update":
+			if !found {
+				writeFakeMessage(w, http.StatusNotFound, "repository file does not exist [path: "+source+"]")
+				return
+			}
+			if current.sha != file.Sha {
+				fail(fmt.Sprintf("sha does not match [given: %s, expected: %s]", file.Sha, current.sha))
+				return
+			}
+			if _, ok := files[file.Path]; ok && source != file.Path {
+				fail("repository file already exists [path: " + file.Path + "]")
+				return
+			}
+			delete(files, source)
+			files[file.Path] = fakeTreeEntry{name: file.Path, mode: current.mode, typ: "blob", sha: fake.put("blob", data)}
+		case "delete":
+			if !found {
+				writeFakeMessage(w, http.StatusNotFound, "repository file does not exist [path: "+source+"]")
+				return
+			}
+			if current.sha != file.Sha {
+				fail(fmt.Sprintf("sha does not match [given: %s, expected: %s]", file.Sha, current.sha))
+				return
+			}
+			delete(files, file.Path)
+		default:
+			fail("unknown operation " + file.Operation)
+			return
+		}
+	}
+	author := fmt.Sprintf("%s <%s>", req.Author.Name, req.Author.Email)
+	commit := "tree " + fake.buildTree(files) + "\n"
+	if exists {
+		commit += "parent " + head + "\n"
+	}
+	commit += "author " + author + " 0 +0000\ncommitter " + author + " 0 +0000\n\n" + req.Message
+	sha := fake.put("commit", []byte(commit))
+	fake.refs[ref] = sha
+	parents := []map[string]string{}
+	for _, parent := range fake.commitParents(sha) {
+		parents = append(parents, map[string]string{"sha": parent})
+	}
+	writeFakeJSON(w, http.StatusCreated, map[string]any{
+		"files": []any{},
+		"commit": map[string]any{
+			"sha":       sha,
+			"html_url":  "https://gitea.example.com/" + fake.owner + "/" + fake.repo + "/commit/" + sha,
+			"message":   req.Message,
+			"author":    map[string]string{"name": req.Author.Name, "email": req.Author.Email},
+			"committer": map[string]string{"name": req.Author.Name, "email": req.Author.Email},
+			"parents":   parents,
+			"tree":      map[string]string{"sha": fake.commitTree(sha)},
+		},
+	})
+}
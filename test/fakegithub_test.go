@@ -0,0 +1,833 @@
+package test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// テスト用のGitHub REST API(git data API)のfake。オブジェクトのshaは実際のgitと同じ方法で計算する。
+type fakeGitHub struct {
+	mu        sync.Mutex
+	server    *httptest.Server
+	owner     string
+	repo      string
+	token     string
+	exists    bool //falseの場合はリポジトリAPIが404を返す
+	forbidden bool //trueの場合はリポジトリAPIが403を返す
+	readOnly  bool //trueの場合はリポジトリのpush権限がない
+	archived  bool
+	scopes    []string       //nilでない場合はclassic tokenとしてX-OAuth-Scopesヘッダで返す
+	settings  map[string]any //作成・変更APIで指定されたリポジトリの設定
+	objects   map[string]*fakeObject
+	refs      map[string]string                    //refs/heads/<branch> -> commit sha
+	calls     []string                             //"METHOD path" の呼び出し履歴
+	encodings []string                             //作成したblobのencodingの履歴
+	failNext  []int                                //次のリクエストから順に返すエラーのステータスコード
+	failWhen  func(method string, path string) int //0以外を返した場合はそのステータスコードでエラーを返す
+
+	templateFiles   map[string]string //テンプレートから生成するファイル
+	templatePending int               //テンプレートからの生成が終わるまでにref取得APIが空のリポジトリを返す回数
+
+	//refの更新直前に1度だけ呼ばれる。他のクライアントによるpushの再現に使う
+	beforeUpdateRef func()
+}
+
+type fakeObject struct {
+	objType string
+	data    []byte
+}
+
+type fakeTreeEntry struct {
+	name string
+	mode string
+	typ  string
+	sha  string
+}
+
+// fakeを起動する。テスト終了時に停止する。
+func newFakeGitHub(t *testing.T, owner string, repo string) *fakeGitHub {
+	fake := &fakeGitHub{
+		owner:   owner,
+		repo:    repo,
+		token:   "test-token",
+		exists:  true,
+		objects: make(map[string]*fakeObject),
+		refs:    make(map[string]string),
+	}
+	fake.server = httptest.NewServer(fake)
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+// fakeに接続するGitInfoを作成する
+func (fake *fakeGitHub) gitInfo(t *testing.T, branch string) *service.GitInfo {
+	client := &githubapi.GitClient{
+		Token:      fake.token,
+		Owner:      fake.owner,
+		Repository: fake.repo,
+		Branch:     branch,
+		BaseUrl:    fake.server.URL,
+	}
+	gitInfo, err := service.GetGitInfoByClient(client, "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gitInfo
+}
+
+func (fake *fakeGitHub) put(objType string, data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", objType, len(data))
+	h.Write(data)
+	sha := hex.EncodeToString(h.Sum(nil))
+	fake.objects[sha] = &fakeObject{objType: objType, data: data}
+	return sha
+}
+
+func (fake *fakeGitHub) writeTree(entries []fakeTreeEntry) string {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].name, entries[j].name
+		if entries[i].typ == "tree" {
+			a += "/"
+		}
+		if entries[j].typ == "tree" {
+			b += "/"
+		}
+		return a < b
+	})
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		buf.WriteString(strings.TrimLeft(entry.mode, "0") + " " + entry.name + "\x00")
+		raw, _ := hex.DecodeString(entry.sha)
+		buf.Write(raw)
+	}
+	return fake.put("tree", buf.Bytes())
+}
+
+func (fake *fakeGitHub) readTree(sha string) []fakeTreeEntry {
+	obj := fake.objects[sha]
+	if obj == nil || obj.objType != "tree" {
+		return nil
+	}
+	var entries []fakeTreeEntry
+	data := obj.data
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		entry := fakeTreeEntry{
+			mode: string(data[:sp]),
+			name: string(data[sp+1 : nul]),
+			sha:  hex.EncodeToString(data[nul+1 : nul+21]),
+			typ:  "blob",
+		}
+		data = data[nul+21:]
+		switch entry.mode {
+		case "40000":
+			entry.mode = "040000"
+			entry.typ = "tree"
+		case "160000":
+			entry.typ = "commit"
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// treeをパスとエントリのmapに展開する。エントリのnameはフルパスになる
+func (fake *fakeGitHub) flatten(treeSha string, prefix string, files map[string]fakeTreeEntry) {
+	for _, entry := range fake.readTree(treeSha) {
+		path := prefix + entry.name
+		if entry.typ == "tree" {
+			fake.flatten(entry.sha, path+"/", files)
+			continue
+		}
+		entry.name = path
+		files[path] = entry
+	}
+}
+
+// パスとエントリのmapからtreeを作成する
+func (fake *fakeGitHub) buildTree(files map[string]fakeTreeEntry) string {
+	type dir struct {
+		files map[string]fakeTreeEntry
+		dirs  map[string]*dir
+	}
+	newDir := func() *dir { return &dir{make(map[string]fakeTreeEntry), make(map[string]*dir)} }
+	root := newDir()
+	for path, entry := range files {
+		parts := strings.Split(path, "/")
+		d := root
+		for _, part := range parts[:len(parts)-1] {
+			if d.dirs[part] == nil {
+				d.dirs[part] = newDir()
+			}
+			d = d.dirs[part]
+		}
+		entry.name = parts[len(parts)-1]
+		d.files[entry.name] = entry
+	}
+	var write func(d *dir) string
+	write = func(d *dir) string {
+		var entries []fakeTreeEntry
+		for _, entry := range d.files {
+			entries = append(entries, entry)
+		}
+		for name, sub := range d.dirs {
+			entries = append(entries, fakeTreeEntry{name: name, mode: "040000", typ: "tree", sha: write(sub)})
+		}
+		return fake.writeTree(entries)
+	}
+	return write(root)
+}
+
+// ブランチを指定のファイルで初期化(既にある場合は1コミット追加)し、コミットのshaを返す。.shは実行可能ファイルにする
+func (fake *fakeGitHub) seed(branch string, files map[string]string) string {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return fake.commitFiles(branch, files)
+}
+
+// ブランチにファイルの内容でコミットを追加する。呼び出し側でロックする
+func (fake *fakeGitHub) commitFiles(branch string, files map[string]string) string {
+	flat := make(map[string]fakeTreeEntry)
+	for path, content := range files {
+		mode := "100644"
+		if strings.HasSuffix(path, ".sh") {
+			mode = "100755"
+		}
+		flat[path] = fakeTreeEntry{name: path, mode: mode, typ: "blob", sha: fake.put("blob", []byte(content))}
+	}
+	var sb strings.Builder
+	sb.WriteString("tree " + fake.buildTree(flat) + "\n")
+	if parent, ok := fake.refs["refs/heads/"+branch]; ok {
+		sb.WriteString("parent " + parent + "\n")
+	}
+	sb.WriteString("author seed <seed@example.com> 0 +0000\ncommitter seed <seed@example.com> 0 +0000\n\nseed\n")
+	sha := fake.put("commit", []byte(sb.String()))
+	fake.refs["refs/heads/"+branch] = sha
+	return sha
+}
+
+// ブランチの全ファイルをパスとエントリのmapで返す
+func (fake *fakeGitHub) files(branch string) map[string]fakeTreeEntry {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	files := make(map[string]fakeTreeEntry)
+	if sha, ok := fake.refs["refs/heads/"+branch]; ok {
+		fake.flatten(fake.commitTree(sha), "", files)
+	}
+	return files
+}
+
+// ブランチのファイルの内容を返す
+func (fake *fakeGitHub) fileContent(branch string, path string) (string, bool) {
+	entry, ok := fake.files(branch)[path]
+	if !ok {
+		return "", false
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return string(fake.objects[entry.sha].data), true
+}
+
+// 指定の呼び出しの回数を返す
+func (fake *fakeGitHub) countCalls(method string, pathPrefix string) int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	count := 0
+	for _, call := range fake.calls {
+		if strings.HasPrefix(call, method+" "+pathPrefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func (fake *fakeGitHub) commitTree(sha string) string {
+	header, _, _ := strings.Cut(string(fake.objects[sha].data), "\n")
+	return strings.TrimPrefix(header, "tree ")
+}
+
+func (fake *fakeGitHub) commitParents(sha string) []string {
+	var parents []string
+	for _, line := range strings.Split(string(fake.objects[sha].data), "\n") {
+		if line == "" {
+			break
+		}
+		if parent, ok := strings.CutPrefix(line, "parent "); ok {
+			parents = append(parents, parent)
+		}
+	}
+	return parents
+}
+
+// commitのヘッダー(authorやcommitter)の名前とメールアドレスを返す
+func (fake *fakeGitHub) commitHeader(sha string, name string) string {
+	for _, line := range strings.Split(string(fake.objects[sha].data), "\n") {
+		if line == "" {
+			break
+		}
+		if value, ok := strings.CutPrefix(line, name+" "); ok {
+			return strings.TrimSuffix(value, " 0 +0000")
+		}
+	}
+	return ""
+}
+
+func (fake *fakeGitHub) commitJSON(sha string) map[string]any {
+	_, message, _ := strings.Cut(string(fake.objects[sha].data), "\n\n")
+	parents := []map[string]string{}
+	for _, parent := range fake.commitParents(sha) {
+		parents = append(parents, map[string]string{"sha": parent})
+	}
+	return map[string]any{"sha": sha, "tree": map[string]string{"sha": fake.commitTree(sha)}, "parents": parents, "message": message}
+}
+
+func (fake *fakeGitHub) isAncestor(ancestor string, sha string) bool {
+	if ancestor == sha {
+		return true
+	}
+	if fake.objects[sha] == nil {
+		return false
+	}
+	for _, parent := range fake.commitParents(sha) {
+		if fake.isAncestor(ancestor, parent) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeFakeMessage(w http.ResponseWriter, status int, message string) {
+	writeFakeJSON(w, status, map[string]string{"message": message})
+}
+
+func (fake *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	fake.mu.Lock()
+	fake.calls = append(fake.calls, r.Method+" "+r.URL.Path)
+	hook := fake.beforeUpdateRef
+	if r.Method == "PATCH" && strings.Contains(r.URL.Path, "/git/refs/") {
+		fake.beforeUpdateRef = nil
+	} else {
+		hook = nil
+	}
+	fake.mu.Unlock()
+	if hook != nil {
+		hook()
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer "+fake.token {
+		writeFakeMessage(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+	if len(fake.failNext) > 0 {
+		status := fake.failNext[0]
+		fake.failNext = fake.failNext[1:]
+		writeFakeMessage(w, status, http.StatusText(status))
+		return
+	}
+	if fake.failWhen != nil {
+		if status := fake.failWhen(r.Method, r.URL.Path); status != 0 {
+			writeFakeMessage(w, status, http.StatusText(status))
+			return
+		}
+	}
+	if r.URL.Path == "/graphql" && r.Method == "POST" {
+		fake.graphql(w, body)
+		return
+	}
+	prefix := fmt.Sprintf("/repos/%s/%s", fake.owner, fake.repo)
+	switch {
+	case r.URL.Path == "/user/repos" && r.Method == "POST":
+		fake.createRepo(w, body, nil)
+		return
+	case r.URL.Path == "/orgs/"+fake.owner+"/repos" && r.Method == "POST":
+		fake.createRepo(w, body, nil)
+		return
+	case strings.HasPrefix(r.URL.Path, "/repos/") && strings.HasSuffix(r.URL.Path, "/generate") && r.Method == "POST" && fake.templateFiles != nil:
+		fake.createRepo(w, body, fake.templateFiles)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, prefix) || !fake.exists {
+		writeFakeMessage(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	if fake.forbidden {
+		writeFakeMessage(w, http.StatusForbidden, "Resource not accessible by personal access token")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	switch {
+	case path == "" && r.Method == "GET":
+		if fake.scopes != nil {
+			w.Header().Set("X-OAuth-Scopes", strings.Join(fake.scopes, ", "))
+		}
+		writeFakeJSON(w, http.StatusOK, fake.repoJSON())
+	case path == "" && r.Method == "PATCH":
+		fake.updateRepo(w, body)
+	case strings.HasPrefix(path, "/git/ref/heads/") && r.Method == "GET":
+		fake.getRef(w, "refs/heads/"+strings.TrimPrefix(path, "/git/ref/heads/"))
+	case strings.HasPrefix(path, "/git/refs/heads/") && r.Method == "PATCH":
+		fake.updateRef(w, "refs/heads/"+strings.TrimPrefix(path, "/git/refs/heads/"), body)
+	case path == "/git/refs" && r.Method == "POST":
+		fake.createRef(w, body)
+	case path == "/git/blobs" && r.Method == "POST":
+		fake.createBlob(w, body)
+	case strings.HasPrefix(path, "/git/blobs/") && r.Method == "GET":
+		fake.getBlob(w, strings.TrimPrefix(path, "/git/blobs/"))
+	case path == "/git/trees" && r.Method == "POST":
+		fake.createTree(w, body)
+	case strings.HasPrefix(path, "/git/trees/") && r.Method == "GET":
+		fake.getTree(w, strings.TrimPrefix(path, "/git/trees/"), r.URL.Query().Get("recursive") != "")
+	case path == "/git/commits" && r.Method == "POST":
+		fake.createCommit(w, body)
+	case strings.HasPrefix(path, "/contents/") && (r.Method == "PUT" || r.Method == "DELETE"):
+		fake.writeContent(w, r.Method, strings.TrimPrefix(path, "/contents/"), body)
+	case strings.HasPrefix(path, "/git/commits/") && r.Method == "GET":
+		sha := strings.TrimPrefix(path, "/git/commits/")
+		if obj := fake.objects[sha]; obj == nil || obj.objType != "commit" {
+			writeFakeMessage(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, fake.commitJSON(sha))
+	default:
+		writeFakeMessage(w, http.StatusNotFound, "fake does not implement "+r.Method+" "+path)
+	}
+}
+
+func (fake *fakeGitHub) getRef(w http.ResponseWriter, ref string) {
+	if fake.templatePending > 0 {
+		fake.templatePending--
+		if fake.templatePending == 0 {
+			fake.commitFiles("main", fake.templateFiles)
+		}
+	}
+	if len(fake.refs) == 0 {
+		writeFakeMessage(w, http.StatusConflict, "Git Repository is empty.")
+		return
+	}
+	sha, ok := fake.refs[ref]
+	if !ok {
+		writeFakeMessage(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]any{"ref": ref, "object": map[string]string{"sha": sha, "type": "commit"}})
+}
+
+func (fake *fakeGitHub) repoJSON() map[string]any {
+	repo := map[string]any{
+		"name":           fake.repo,
+		"full_name":      fake.owner + "/" + fake.repo,
+		"private":        true,
+		"archived":       fake.archived,
+		"default_branch": "main",
+		"permissions":    map[string]bool{"admin": !fake.readOnly, "push": !fake.readOnly, "pull": true},
+	}
+	for key, value := range fake.settings {
+		repo[key] = value
+	}
+	return repo
+}
+
+// リポジトリを作成する。templateFilesを指定した場合はtemplatePendingの回数だけ生成を遅らせる
+func (fake *fakeGitHub) createRepo(w http.ResponseWriter, body []byte, templateFiles map[string]string) {
+	if fake.exists {
+		writeFakeMessage(w, http.StatusUnprocessableEntity, "name already exists on this account")
+		return
+	}
+	var req map[string]any
+	json.Unmarshal(body, &req)
+	if req["name"] != fake.repo {
+		writeFakeMessage(w, http.StatusUnprocessableEntity, "unexpected repository name")
+		return
+	}
+	fake.exists = true
+	fake.settings = req
+	switch {
+	case templateFiles != nil && fake.templatePending == 0:
+		fake.commitFiles("main", templateFiles)
+	case req["auto_init"] == true || req["license_template"] != nil || req["gitignore_template"] != nil:
+		fake.commitFiles("main", map[string]string{"README.md": "# " + fake.repo + "\n"})
+	}
+	writeFakeJSON(w, http.StatusCreated, fake.repoJSON())
+}
+
+func (fake *fakeGitHub) updateRepo(w http.ResponseWriter, body []byte) {
+	var req map[string]any
+	json.Unmarshal(body, &req)
+	if branch, ok := req["default_branch"].(string); ok {
+		if _, exists := fake.refs["refs/heads/"+branch]; !exists {
+			writeFakeMessage(w, http.StatusUnprocessableEntity, "Cannot update default branch for an empty repository.")
+			return
+		}
+	}
+	if fake.settings == nil {
+		fake.settings = make(map[string]any)
+	}
+	for key, value := range req {
+		fake.settings[key] = value
+	}
+	writeFakeJSON(w, http.StatusOK, fake.repoJSON())
+}
+
+func (fake *fakeGitHub) updateRef(w http.ResponseWriter, ref string, body []byte) {
+	var req struct {
+		Sha   string `json:"sha"`
+		Force bool   `json:"force"`
+	}
+	json.Unmarshal(body, &req)
+	old, ok := fake.refs[ref]
+	if !ok {
+		writeFakeMessage(w, http.StatusUnprocessableEntity, "Reference does not exist")
+		return
+	}
+	if !req.Force && !fake.isAncestor(old, req.Sha) {
+		writeFakeMessage(w, http.StatusUnprocessableEntity, "Update is not a fast forward")
+		return
+	}
+	fake.refs[ref] = req.Sha
+	writeFakeJSON(w, http.StatusOK, map[string]any{"ref": ref, "object": map[string]string{"sha": req.Sha, "type": "commit"}})
+}
+
+func (fake *fakeGitHub) createRef(w http.ResponseWriter, body []byte) {
+	var req struct {
+		Ref string `json:"ref"`
+		Sha string `json:"sha"`
+	}
+	json.Unmarshal(body, &req)
+	if !strings.HasPrefix(req.Ref, "refs/") {
+		writeFakeMessage(w, http.StatusUnprocessableEntity, "Reference name must start with 'refs/'")
+		return
+	}
+	if _, ok := fake.refs[req.Ref]; ok {
+		writeFakeMessage(w, http.StatusUnprocessableEntity, "Reference already exists")
+		return
+	}
+	fake.refs[req.Ref] = req.Sha
+	writeFakeJSON(w, http.StatusCreated, map[string]any{"ref": req.Ref, "object": map[string]string{"sha": req.Sha, "type": "commit"}})
+}
+
+func (fake *fakeGitHub) createBlob(w http.ResponseWriter, body []byte) {
+	var req struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	json.Unmarshal(body, &req)
+	fake.encodings = append(fake.encodings, req.Encoding)
+	data := []byte(req.Content)
+	switch req.Encoding {
+	case "utf-8":
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(req.Content)
+		if err != nil {
+			writeFakeMessage(w, http.StatusUnprocessableEntity, "invalid base64 content")
+			return
+		}
+		data = decoded
+	default:
+		writeFakeMessage(w, http.StatusUnprocessableEntity, "invalid encoding "+req.Encoding)
+		return
+	}
+	writeFakeJSON(w, http.StatusCreated, map[string]string{"sha": fake.put("blob", data)})
+}
+
+func (fake *fakeGitHub) getBlob(w http.ResponseWriter, sha string) {
+	obj := fake.objects[sha]
+	if obj == nil || obj.objType != "blob" {
+		writeFakeMessage(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	//GitHubと同じく60文字ごとに改行を入れる
+	encoded := base64.StdEncoding.EncodeToString(obj.data)
+	var lines []string
+	for len(encoded) > 60 {
+		lines = append(lines, encoded[:60])
+		encoded = encoded[60:]
+	}
+	lines = append(lines, encoded)
+	writeFakeJSON(w, http.StatusOK, map[string]any{"sha": sha, "size": len(obj.data), "content": strings.Join(lines, "\n") + "\n", "encoding": "base64"})
+}
+
+func (fake *fakeGitHub) createTree(w http.ResponseWriter, body []byte) {
+	var req struct {
+		BaseTree *string `json:"base_tree"`
+		Tree     []struct {
+			Path string  `json:"path"`
+			Mode string  `json:"mode"`
+			Type string  `json:"type"`
+			Sha  *string `json:"sha"`
+		} `json:"tree"`
+	}
+	json.Unmarshal(body, &req)
+	files := make(map[string]fakeTreeEntry)
+	if req.BaseTree != nil {
+		if obj := fake.objects[*req.BaseTree]; obj == nil || obj.objType != "tree" {
+			writeFakeMessage(w, http.StatusUnprocessableEntity, "base_tree is not a valid tree")
+			return
+		}
+		fake.flatten(*req.BaseTree, "", files)
+	}
+	removeUnder := func(path string) {
+		for name := range files {
+			if name == path || strings.HasPrefix(name, path+"/") {
+				delete(files, name)
+			}
+		}
+	}
+	for _, entry := range req.Tree {
+		removeUnder(entry.Path)
+		if entry.Sha == nil {
+			continue
+		}
+		if entry.Type == "tree" {
+			sub := make(map[string]fakeTreeEntry)
+			fake.flatten(*entry.Sha, entry.Path+"/", sub)
+			for name, subEntry := range sub {
+				files[name] = subEntry
+			}
+			continue
+		}
+		if entry.Type == "blob" && fake.objects[*entry.Sha] == nil {
+			writeFakeMessage(w, http.StatusUnprocessableEntity, "tree.sha "+*entry.Sha+" is not a valid blob")
+			return
+		}
+		files[entry.Path] = fakeTreeEntry{name: entry.Path, mode: entry.Mode, typ: entry.Type, sha: *entry.Sha}
+	}
+	writeFakeJSON(w, http.StatusCreated, map[string]any{"sha": fake.buildTree(files)})
+}
+
+func (fake *fakeGitHub) getTree(w http.ResponseWriter, sha string, recursive bool) {
+	if obj := fake.objects[sha]; obj == nil || obj.objType != "tree" {
+		writeFakeMessage(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	entries := []map[string]any{}
+	var walk func(treeSha string, prefix string)
+	walk = func(treeSha string, prefix string) {
+		for _, entry := range fake.readTree(treeSha) {
+			element := map[string]any{"path": prefix + entry.name, "mode": entry.mode, "type": entry.typ, "sha": entry.sha}
+			if entry.typ == "blob" {
+				element["size"] = len(fake.objects[entry.sha].data)
+			}
+			entries = append(entries, element)
+			if recursive && entry.typ == "tree" {
+				walk(entry.sha, prefix+entry.name+"/")
+			}
+		}
+	}
+	walk(sha, "")
+	writeFakeJSON(w, http.StatusOK, map[string]any{"sha": sha, "tree": entries, "truncated": false})
+}
+
+func (fake *fakeGitHub) createCommit(w http.ResponseWriter, body []byte) {
+	var req struct {
+		Message string   `json:"message"`
+		Tree    string   `json:"tree"`
+		Parents []string `json:"parents"`
+		Author  *struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"author"`
+	}
+	json.Unmarshal(body, &req)
+	if obj := fake.objects[req.Tree]; obj == nil || obj.objType != "tree" {
+		writeFakeMessage(w, http.StatusUnprocessableEntity, "tree is not a valid tree")
+		return
+	}
+	author := "unknown <unknown>"
+	if req.Author != nil {
+		author = fmt.Sprintf("%s <%s>", req.Author.Name, req.Author.Email)
+	}
+	var sb strings.Builder
+	sb.WriteString("tree " + req.Tree + "\n")
+	for _, parent := range req.Parents {
+		if obj := fake.objects[parent]; obj == nil || obj.objType != "commit" {
+			writeFakeMessage(w, http.StatusUnprocessableEntity, "parent "+parent+" is not a valid commit")
+			return
+		}
+		sb.WriteString("parent " + parent + "\n")
+	}
+	sb.WriteString("author " + author + " 0 +0000\ncommitter " + author + " 0 +0000\n\n" + req.Message)
+	sha := fake.put("commit", []byte(sb.String()))
+	writeFakeJSON(w, http.StatusCreated, fake.commitJSON(sha))
+}
+
+// GraphQL APIのうちcreateCommitOnBranchのみ実装する。作者はトークンのユーザー(graphql-bot)になる
+func (fake *fakeGitHub) graphql(w http.ResponseWriter, body []byte) {
+	var req struct {
+		Query     string `json:"query"`
+		Variables struct {
+			Input struct {
+				Branch struct {
+					RepositoryNameWithOwner string `json:"repositoryNameWithOwner"`
+					BranchName              string `json:"branchName"`
+				} `json:"branch"`
+				Message struct {
+					Headline string `json:"headline"`
+					Body     string `json:"body"`
+				} `json:"message"`
+				ExpectedHeadOid string `json:"expectedHeadOid"`
+				FileChanges     struct {
+					Additions []struct {
+						Path     string `json:"path"`
+						Contents string `json:"contents"`
+					} `json:"additions"`
+					Deletions []struct {
+						Path string `json:"path"`
+					} `json:"deletions"`
+				} `json:"fileChanges"`
+			} `json:"input"`
+		} `json:"variables"`
+	}
+	json.Unmarshal(body, &req)
+	writeError := func(errType string, message string) {
+		writeFakeJSON(w, http.StatusOK, map[string]any{"errors": []map[string]any{{"type": errType, "message": message, "path": []string{"createCommitOnBranch"}}}})
+	}
+	if !strings.Contains(req.Query, "createCommitOnBranch") {
+		writeError("INTERNAL", "fake does not implement the query")
+		return
+	}
+	input := req.Variables.Input
+	if input.Branch.RepositoryNameWithOwner != fake.owner+"/"+fake.repo || !fake.exists {
+		writeError("NOT_FOUND", "Could not resolve to a Repository")
+		return
+	}
+	ref := "refs/heads/" + input.Branch.BranchName
+	head, ok := fake.refs[ref]
+	if !ok {
+		writeError("NOT_FOUND", "Could not resolve to a Ref")
+		return
+	}
+	if head != input.ExpectedHeadOid {
+		writeError("STALE_DATA", fmt.Sprintf("Expected branch to point to \"%s\" but it did not. Pull and try again.", input.ExpectedHeadOid))
+		return
+	}
+	files := make(map[string]fakeTreeEntry)
+	fake.flatten(fake.commitTree(head), "", files)
+	for _, deletion := range input.FileChanges.Deletions {
+		if _, ok := files[deletion.Path]; !ok {
+			writeError("UNPROCESSABLE", "A path was requested for deletion which does not exist as of commit oid")
+			return
+		}
+		delete(files, deletion.Path)
+	}
+	for _, addition := range input.FileChanges.Additions {
+		data, err := base64.StdEncoding.DecodeString(addition.Contents)
+		if err != nil {
+			writeError("UNPROCESSABLE", "invalid base64 contents")
+			return
+		}
+		files[addition.Path] = fakeTreeEntry{name: addition.Path, mode: "100644", typ: "blob", sha: fake.put("blob", data)}
+	}
+	message := input.Message.Headline
+	if input.Message.Body != "" {
+		message += "\n\n" + input.Message.Body
+	}
+	treeSha := fake.buildTree(files)
+	commit := "tree " + treeSha + "\nparent " + head + "\nauthor graphql-bot <bot@example.com> 0 +0000\ncommitter GitHub <noreply@github.com> 0 +0000\n\n" + message
+	sha := fake.put("commit", []byte(commit))
+	fake.refs[ref] = sha
+	actor := func(name string, email string) map[string]string {
+		return map[string]string{"name": name, "email": email, "date": "1970-01-01T00:00:00Z"}
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"createCommitOnBranch": map[string]any{"commit": map[string]any{
+		"oid":       sha,
+		"url":       "https://github.com/" + fake.owner + "/" + fake.repo + "/commit/" + sha,
+		"message":   message,
+		"tree":      map[string]string{"oid": treeSha},
+		"author":    actor("graphql-bot", "bot@example.com"),
+		"committer": actor("GitHub", "noreply@github.com"),
+		"parents":   map[string]any{"nodes": []map[string]string{{"oid": head}}},
+	}}}})
+}
+
+// Contents APIによる1ファイルの作成・更新・削除
+func (fake *fakeGitHub) writeContent(w http.ResponseWriter, method string, path string, body []byte) {
+	var req struct {
+		Message string `json:"message"`
+		Content string `json:"content"`
+		Sha     string `json:"sha"`
+		Branch  string `json:"branch"`
+		Author  *struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"author"`
+		Committer *struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"committer"`
+	}
+	json.Unmarshal(body, &req)
+	ref := "refs/heads/" + req.Branch
+	head, ok := fake.refs[ref]
+	if !ok {
+		writeFakeMessage(w, http.StatusNotFound, "Branch "+req.Branch+" not found")
+		return
+	}
+	files := make(map[string]fakeTreeEntry)
+	fake.flatten(fake.commitTree(head), "", files)
+	current, exists := files[path]
+	switch {
+	case method == "DELETE" && !exists:
+		writeFakeMessage(w, http.StatusNotFound, "Not Found")
+		return
+	case exists && req.Sha == "":
+		writeFakeMessage(w, http.StatusUnprocessableEntity, "Invalid request.\n\n\"sha\" wasn't supplied.")
+		return
+	case exists && req.Sha != current.sha:
+		writeFakeMessage(w, http.StatusConflict, path+" does not match "+req.Sha)
+		return
+	}
+	status := http.StatusOK
+	var content any
+	if method == "DELETE" {
+		delete(files, path)
+	} else {
+		data, err := base64.StdEncoding.DecodeString(req.Content)
+		if err != nil {
+			writeFakeMessage(w, http.StatusUnprocessableEntity, "content is not valid Base64")
+			return
+		}
+		if !exists {
+			status = http.StatusCreated
+		}
+		sha := fake.put("blob", data)
+		files[path] = fakeTreeEntry{name: path, mode: "100644", typ: "blob", sha: sha}
+		content = map[string]any{"path": path, "sha": sha, "size": len(data)}
+	}
+	//committerを指定しない場合はトークンのユーザーになる
+	author, committer := "token-owner <token-owner@example.com>", "token-owner <token-owner@example.com>"
+	if req.Author != nil {
+		author = fmt.Sprintf("%s <%s>", req.Author.Name, req.Author.Email)
+	}
+	if req.Committer != nil {
+		committer = fmt.Sprintf("%s <%s>", req.Committer.Name, req.Committer.Email)
+	}
+	commit := "tree " + fake.buildTree(files) + "\nparent " + head + "\nauthor " + author + " 0 +0000\ncommitter " + committer + " 0 +0000\n\n" + req.Message
+	sha := fake.put("commit", []byte(commit))
+	fake.refs[ref] = sha
+	writeFakeJSON(w, status, map[string]any{"content": content, "commit": fake.commitJSON(sha)})
+}
@@ -0,0 +1,310 @@
+package test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	gitlabapi "github.com/daze-doragon/go-gituse/pkg/gitlabapi"
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// テスト用のGitLab APIのfake。オブジェクトとブランチはfakeGitHubと同じ方法で保持する。
+type fakeGitLab struct {
+	*fakeGitHub
+	gitlabServer *httptest.Server
+	project      string //"group/name"
+	pageSize     int    //一覧取得APIの1ページの最大件数
+}
+
+// fakeを起動する。テスト終了時に停止する。
+func newFakeGitLab(t *testing.T, project string) *fakeGitLab {
+	owner, repo := path.Split(project)
+	fake := &fakeGitLab{
+		fakeGitHub: newFakeGitHub(t, strings.TrimSuffix(owner, "/"), repo),
+		project:    project,
+		pageSize:   100,
+	}
+	fake.gitlabServer = httptest.NewServer(fake)
+	t.Cleanup(fake.gitlabServer.Close)
+	return fake
+}
+
+// fakeに接続するGitInfoを作成する
+func (fake *fakeGitLab) gitInfo(t *testing.T, branch string) *service.GitInfo {
+	client := &gitlabapi.GitlabClient{
+		Token:   fake.token,
+		Project: fake.project,
+		Branch:  branch,
+		BaseUrl: fake.gitlabServer.URL + "/api/v4",
+	}
+	gitInfo, err := service.GetGitInfoByProvider(service.NewGitlabProvider(client), "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gitInfo
+}
+
+func (fake *fakeGitLab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	fake.mu.Lock()
+	fake.calls = append(fake.calls, r.Method+" "+r.URL.EscapedPath())
+	hook := fake.beforeUpdateRef
+	if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/repository/commits") {
+		fake.beforeUpdateRef = nil
+	} else {
+		hook = nil
+	}
+	fake.mu.Unlock()
+	if hook != nil {
+		hook()
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if r.Header.Get("PRIVATE-TOKEN") != fake.token {
+		writeFakeMessage(w, http.StatusUnauthorized, "401 Unauthorized")
+		return
+	}
+	//プロジェクトのパスは%2Fでエンコードされる
+	prefix := "/api/v4/projects/" + url.PathEscape(fake.project)
+	escaped := r.URL.EscapedPath()
+	if !strings.HasPrefix(escaped, prefix) || !fake.exists {
+		writeFakeMessage(w, http.StatusNotFound, "404 Project Not Found")
+		return
+	}
+	rest, _ := url.PathUnescape(strings.TrimPrefix(escaped, prefix))
+	switch {
+	case rest == "" && r.Method == "GET":
+		writeFakeJSON(w, http.StatusOK, map[string]any{
+			"id":                  1,
+			"path_with_namespace": fake.project,
+			"default_branch":      "main",
+			"empty_repo":          len(fake.refs) == 0,
+		})
+	case rest == "/repository/branches" && r.Method == "GET":
+		var names []string
+		for ref := range fake.refs {
+			names = append(names, strings.TrimPrefix(ref, "refs/heads/"))
+		}
+		sort.Strings(names)
+		var branchList []any
+		for _, name := range names {
+			branchList = append(branchList, fake.branchJSON(name))
+		}
+		fake.writePage(w, r, branchList)
+	case strings.HasPrefix(rest, "/repository/branches/") && r.Method == "GET":
+		name := strings.TrimPrefix(rest, "/repository/branches/")
+		if _, ok := fake.refs["refs/heads/"+name]; !ok {
+			writeFakeMessage(w, http.StatusNotFound, "404 Branch Not Found")
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, fake.branchJSON(name))
+	case rest == "/repository/tree" && r.Method == "GET":
+		fake.listTree(w, r)
+	case strings.HasPrefix(rest, "/repository/blobs/") && r.Method == "GET":
+		sha := strings.TrimPrefix(rest, "/repository/blobs/")
+		obj := fake.objects[sha]
+		if obj == nil || obj.objType != "blob" {
+			writeFakeMessage(w, http.StatusNotFound, "404 Blob Not Found")
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]any{"sha": sha, "size": len(obj.data), "encoding": "base64", "content": base64.StdEncoding.EncodeToString(obj.data)})
+	case rest == "/repository/commits" && r.Method == "POST":
+		fake.createActionCommit(w, body)
+	default:
+		writeFakeMessage(w, http.StatusNotFound, "fake does not implement "+r.Method+" "+rest)
+	}
+}
+
+func (fake *fakeGitLab) branchJSON(name string) map[string]any {
+	return map[string]any{"name": name, "commit": fake.gitlabCommitJSON(fake.refs["refs/heads/"+name])}
+}
+
+func (fake *fakeGitLab) gitlabCommitJSON(sha string) map[string]any {
+	data := string(fake.objects[sha].data)
+	header, message, _ := strings.Cut(data, "\n\n")
+	author := ""
+	for _, line := range strings.Split(header, "\n") {
+		if strings.HasPrefix(line, "author ") {
+			author = strings.TrimPrefix(line, "author ")
+		}
+	}
+	name, email, _ := strings.Cut(author, " <")
+	email, _, _ = strings.Cut(email, ">")
+	parents := []string{}
+	parents = append(parents, fake.commitParents(sha)...)
+	return map[string]any{
+		"id":           sha,
+		"short_id":     sha[:8],
+		"title":        strings.SplitN(message, "\n", 2)[0],
+		"message":      message,
+		"author_name":  name,
+		"author_email": email,
+		"parent_ids":   parents,
+		"web_url":      "https://gitlab.example.com/" + fake.project + "/-/commit/" + sha,
+	}
+}
+
+// pageとper_pageに従って一覧を返し、次のページがある場合はX-Next-Pageを付ける
+func (fake *fakeGitLab) writePage(w http.ResponseWriter, r *http.Request, list []any) {
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage <= 0 || perPage > fake.pageSize {
+		perPage = fake.pageSize
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	start := min((page-1)*perPage, len(list))
+	end := min(start+perPage, len(list))
+	if end < len(list) {
+		w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+	}
+	if list == nil {
+		list = []any{}
+	}
+	writeFakeJSON(w, http.StatusOK, list[start:end])
+}
+
+func (fake *fakeGitLab) listTree(w http.ResponseWriter, r *http.Request) {
+	ref := r.URL.Query().Get("ref")
+	commitSha := ref
+	if sha, ok := fake.refs["refs/heads/"+ref]; ok {
+		commitSha = sha
+	}
+	if obj := fake.objects[commitSha]; obj == nil || obj.objType != "commit" {
+		writeFakeMessage(w, http.StatusNotFound, "404 Tree Not Found")
+		return
+	}
+	recursive := r.URL.Query().Get("recursive") == "true"
+	var list []any
+	var walk func(treeSha string, prefix string)
+	walk = func(treeSha string, prefix string) {
+		for _, entry := range fake.readTree(treeSha) {
+			list = append(list, map[string]string{"id": entry.sha, "name": entry.name, "type": entry.typ, "path": prefix + entry.name, "mode": entry.mode})
+			if recursive && entry.typ == "tree" {
+				walk(entry.sha, prefix+entry.name+"/")
+			}
+		}
+	}
+	walk(fake.commitTree(commitSha), "")
+	fake.writePage(w, r, list)
+}
+
+// commits APIのactionsを適用してコミットを作成する
+func (fake *fakeGitLab) createActionCommit(w http.ResponseWriter, body []byte) {
+	var req gitlabapi.CommitData
+	json.Unmarshal(body, &req)
+	ref := "refs/heads/" + req.Branch
+	head, exists := fake.refs[ref]
+	if !exists && len(fake.refs) > 0 {
+		writeFakeMessage(w, http.StatusBadRequest, "You can only create or edit files when you are on a branch")
+		return
+	}
+	//start_shaからブランチが進んでいる場合はfast-forwardできない
+	if req.Start_sha != "" && req.Start_sha != head {
+		writeFakeMessage(w, http.StatusBadRequest, "Could not update "+ref+". Please refresh and try again.")
+		return
+	}
+	files := make(map[string]fakeTreeEntry)
+	if exists {
+		fake.flatten(fake.commitTree(head), "", files)
+	}
+	fail := func(message string) {
+		writeFakeMessage(w, http.StatusBadRequest, message)
+	}
+	for _, action := range req.Actions {
+		current, found := files[action.File_path]
+		content := func() ([]byte, bool) {
+			if action.Encoding == "base64" {
+				data, err := base64.StdEncoding.DecodeString(action.Content)
+				return data, err == nil
+			}
+			return []byte(action.Content), true
+		}
+		mode := func(base string) string {
+			if action.Execute_filemode == nil {
+				return base
+			}
+			if *action.Execute_filemode {
+				return "100755"
+			}
+			return "100644"
+		}
+		switch action.Action {
+		case "create", "update":
+			if action.Action == "create" && found {
+				fail("A file with this name already exists")
+				return
+			}
+			if action.Action == "update" && !found {
+				fail("A file with this name doesn't exist")
+				return
+			}
+			data, ok := content()
+			if !ok {
+				fail("invalid base64")
+				return
+			}
+			for name := range files {
+				if strings.HasPrefix(name, action.File_path+"/") || strings.HasPrefix(action.File_path, name+"/") {
+					fail("A directory or file with this name already exists")
+					return
+				}
+			}
+			baseMode := "100644"
+			if found {
+				baseMode = current.mode
+			}
+			files[action.File_path] = fakeTreeEntry{name: action.File_path, mode: mode(baseMode), typ: "blob", sha: fake.put("blob", data)}
+		case "delete":
+			if !found {
+				fail("A file with this name doesn't exist")
+				return
+			}
+			delete(files, action.File_path)
+		case "move":
+			previous, ok := files[action.Previous_path]
+			if !ok || found {
+				fail("invalid move")
+				return
+			}
+			delete(files, action.Previous_path)
+			if action.Content != "" {
+				data, _ := content()
+				previous.sha = fake.put("blob", data)
+			}
+			previous.name = action.File_path
+			files[action.File_path] = previous
+		case "chmod":
+			if !found {
+				fail("A file with this name doesn't exist")
+				return
+			}
+			current.mode = mode(current.mode)
+			files[action.File_path] = current
+		default:
+			fail("unknown action " + action.Action)
+			return
+		}
+	}
+	author := fmt.Sprintf("%s <%s>", req.Author_name, req.Author_email)
+	commit := "tree " + fake.buildTree(files) + "\n"
+	if exists {
+		commit += "parent " + head + "\n"
+	}
+	commit += "author " + author + " 0 +0000\ncommitter " + author + " 0 +0000\n\n" + req.Commit_message
+	sha := fake.put("commit", []byte(commit))
+	fake.refs[ref] = sha
+	writeFakeJSON(w, http.StatusCreated, fake.gitlabCommitJSON(sha))
+}
@@ -0,0 +1,226 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestCreateCommitByFS(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n", "site/old.html": "old\n", "site/index.html": "index\n"})
+	gitInfo := fake.gitInfo(t, "main")
+
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("new index\n")},
+		"css/style.css": {Data: []byte("body {}\n")},
+		"img/logo.png":  {Data: []byte("\x89PNG\r\n\x00")},
+	}
+	plan, err := gitInfo.PlanCommitByFS("plan", fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Entries) != 3 || !plan.HasChanges() {
+		t.Errorf("unexpected plan\n%s", plan)
+	}
+
+	//ローカルのディレクトリと同じPrefix、Mirror、Progressを使える
+	var scanned int
+	option := &service.LocalDirOption{Prefix: "site", Mirror: true, Progress: func(p service.Progress) {
+		if p.Phase == service.PhaseScan && p.Path != "" {
+			scanned++
+		}
+	}}
+	if _, err := gitInfo.CreateCommitByFSWithOption("publish", fsys, option); err != nil {
+		t.Fatal(err)
+	}
+	if scanned != 3 {
+		t.Errorf("expected 3 scanned files, got %d", scanned)
+	}
+	files := fake.files("main")
+	if _, ok := files["site/old.html"]; ok || len(files) != 4 {
+		t.Errorf("unexpected files %v", files)
+	}
+	for path, content := range map[string]string{"site/index.html": "new index\n", "site/css/style.css": "body {}\n", "site/img/logo.png": "\x89PNG\r\n\x00", "README.md": "readme\n"} {
+		if got, _ := fake.fileContent("main", path); got != content {
+			t.Errorf("%s: expected %q, got %q", path, content, got)
+		}
+	}
+
+	//zipアーカイブもfs.FSとしてコミットできる
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range map[string]string{"docs/a.md": "a\n", "docs/b.md": "b\n"} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zipFS, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitInfo.CreateCommitByFS("add docs", zipFS); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fake.fileContent("main", "docs/b.md"); got != "b\n" {
+		t.Errorf("unexpected content %q", got)
+	}
+
+	if _, err := gitInfo.CreateCommitByFS("nil", nil); err == nil {
+		t.Error("nil fsys should be rejected.")
+	}
+}
+
+func TestFSFileModes(t *testing.T) {
+	fsys := fstest.MapFS{
+		".gitattributes":      {Data: []byte("*.txt text\n")},
+		"notes.txt":           {Data: []byte("a\r\nb\r\n")},
+		"docs/.gitattributes": {Data: []byte("*.md -text\n")},
+		"docs/guide.md":       {Data: []byte("guide\r\n")},
+		"guide":               {Data: []byte("docs/guide.md"), Mode: fs.ModeSymlink},
+		"run.sh":              {Data: []byte("echo run\n"), Mode: 0o755},
+		".git/HEAD":           {Data: []byte("ref: refs/heads/main\n")},
+		"vendor/lib/.git":     {Data: []byte("gitdir: ../../.git/modules/lib\n")},
+		"vendor/lib/lib.go":   {Data: []byte("package lib\n")},
+	}
+
+	//指定しない場合は.gitも含めて全てのファイルを通常のファイルとしてコミットする
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	gitInfo := fake.gitInfo(t, "main")
+	if _, err := gitInfo.CreateCommitByFS("add files", fsys); err != nil {
+		t.Fatal(err)
+	}
+	files := fake.files("main")
+	if len(files) != 10 {
+		t.Errorf("unexpected files %v", files)
+	}
+	for _, path := range []string{"guide", "run.sh", ".git/HEAD", "vendor/lib/.git"} {
+		if files[path].mode != "100644" {
+			t.Errorf("%s: expected 100644, got %+v", path, files[path])
+		}
+	}
+
+	fake = newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	gitInfo = fake.gitInfo(t, "main")
+	gitInfo.SetLineEndingNormalization(true)
+	option := &service.LocalDirOption{SkipGit: true, FileModes: true}
+	if _, err := gitInfo.CreateCommitByFSWithOption("add files", fsys, option); err != nil {
+		t.Fatal(err)
+	}
+	files = fake.files("main")
+	//.gitディレクトリとworktreeの.gitファイルはコミットしない
+	for _, skipped := range []string{".git/HEAD", "vendor/lib/.git"} {
+		if _, ok := files[skipped]; ok {
+			t.Errorf("%s should not be committed.", skipped)
+		}
+	}
+	if len(files) != 8 {
+		t.Errorf("unexpected files %v", files)
+	}
+	for path, mode := range map[string]string{"guide": "120000", "run.sh": "100755", "notes.txt": "100644", "vendor/lib/lib.go": "100644"} {
+		if files[path].mode != mode {
+			t.Errorf("%s: expected %s, got %+v", path, mode, files[path])
+		}
+	}
+	//シンボリックリンクはリンク先を内容にし、下位の.gitattributesはルートより優先する
+	for path, content := range map[string]string{"guide": "docs/guide.md", "notes.txt": "a\nb\n", "docs/guide.md": "guide\r\n"} {
+		if got, _ := fake.fileContent("main", path); got != content {
+			t.Errorf("%s: expected %q, got %q", path, content, got)
+		}
+	}
+}
+
+func TestLocalDirFileModes(t *testing.T) {
+	dir := writeLocalFiles(t, map[string]string{"local/build.sh": "echo build\n", "local/.git/config": "[core]\n"})
+	if err := os.Chmod(filepath.Join(dir, "local", "build.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("build.sh", filepath.Join(dir, "local", "link.sh")); err != nil {
+		t.Fatal(err)
+	}
+
+	//指定しない場合はシンボリックリンクをたどり、実行権限は既存のモードを変えない
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	gitInfo := fake.gitInfo(t, "main")
+	if _, err := gitInfo.CreateCommitByLocalDir("add local", dir); err != nil {
+		t.Fatal(err)
+	}
+	files := fake.files("main")
+	if _, ok := files["local/.git/config"]; !ok {
+		t.Error(".git should be committed by default.")
+	}
+	if files["local/build.sh"].mode != "100644" || files["local/link.sh"].mode != "100644" {
+		t.Errorf("unexpected modes %+v %+v", files["local/build.sh"], files["local/link.sh"])
+	}
+	if got, _ := fake.fileContent("main", "local/link.sh"); got != "echo build\n" {
+		t.Errorf("symlink should be followed by default. %q", got)
+	}
+
+	//GitLabでもシンボリックリンクを含むディレクトリをそのままコミットできる
+	gitlab := newFakeGitLab(t, "group/repo")
+	gitlab.seed("main", map[string]string{"README.md": "readme\n"})
+	if _, err := gitlab.gitInfo(t, "main").CreateCommitByLocalDir("add local", dir); err != nil {
+		t.Errorf("default walk should be accepted by GitLab. %v", err)
+	}
+
+	option := &service.LocalDirOption{SkipGit: true, FileModes: true}
+	fake = newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	if _, err := fake.gitInfo(t, "main").CreateCommitByLocalDirWithOption("add local", dir, option); err != nil {
+		t.Fatal(err)
+	}
+	files = fake.files("main")
+	if _, ok := files["local/.git/config"]; ok {
+		t.Error(".git should not be committed.")
+	}
+	if files["local/build.sh"].mode != "100755" || files["local/link.sh"].mode != "120000" {
+		t.Errorf("unexpected modes %+v %+v", files["local/build.sh"], files["local/link.sh"])
+	}
+	if got, _ := fake.fileContent("main", "local/link.sh"); got != "build.sh" {
+		t.Errorf("unexpected link target %q", got)
+	}
+
+	//GitLabはシンボリックリンクを扱えない
+	gitlab = newFakeGitLab(t, "group/other")
+	gitlab.seed("main", map[string]string{"README.md": "readme\n"})
+	if _, err := gitlab.gitInfo(t, "main").CreateCommitByLocalDirWithOption("add local", dir, option); !errors.Is(err, service.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestLocalPathSingleFile(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	gitInfo := fake.gitInfo(t, "main")
+	dir := writeLocalFiles(t, map[string]string{"sub/note.txt": "note\n"})
+
+	//ファイルを直接指定した場合はファイル名でコミットする
+	elementList, err := service.MakeCommitElementListByLocalPath(filepath.Join(dir, "sub", "note.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitInfo.CreateCommitByElement("add note", elementList); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fake.fileContent("main", "note.txt"); got != "note\n" {
+		t.Errorf("unexpected content %q", got)
+	}
+	if _, err := service.MakeCommitElementListByLocalPath(filepath.Join(dir, "missing")); err == nil {
+		t.Error("missing path should be rejected.")
+	}
+}
@@ -0,0 +1,119 @@
+package test
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestLineEndingNormalization(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	dir := writeLocalFiles(t, map[string]string{
+		".gitattributes": "*.dat binary\r\n*.bat eol=crlf\r\nkeep/** -text\r\n",
+		"a.txt":          "a\r\nb\r\n",
+		"run.bat":        "@echo off\r\n",
+		"data.dat":       "x\r\ny\r\n",
+		"keep/k.txt":     "k\r\n",
+		"image.png":      "\x89PNG\r\n\x00\x00",
+		"lonecr.txt":     "a\rb\r\n",
+	})
+	gitInfo := fake.gitInfo(t, "main")
+
+	//設定しない場合は変換しない
+	plan, err := gitInfo.PlanCommitByLocalDir("plan", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range plan.Entries {
+		if entry.Path == "a.txt" && entry.NewSize != 6 {
+			t.Errorf("a.txt should not be converted by default. %+v", entry)
+		}
+	}
+
+	gitInfo.SetLineEndingNormalization(true)
+	if _, err := gitInfo.CreateCommitByLocalDir("add files", dir); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		".gitattributes": "*.dat binary\n*.bat eol=crlf\nkeep/** -text\n",
+		"a.txt":          "a\nb\n",
+		"run.bat":        "@echo off\n",
+		"data.dat":       "x\r\ny\r\n",
+		"keep/k.txt":     "k\r\n",
+		"image.png":      "\x89PNG\r\n\x00\x00",
+		"lonecr.txt":     "a\rb\r\n",
+	}
+	for path, content := range want {
+		if got, _ := fake.fileContent("main", path); got != content {
+			t.Errorf("%s: expected %q, got %q", path, content, got)
+		}
+	}
+
+	//コミット済みの.gitattributesと下位のディレクトリの.gitattributesをMakeCommitElementByFileDataにも適用する
+	nested, _ := service.MakeCommitElementByFileData("docs/.gitattributes", "*.md -text\n", service.Utf8)
+	docs, _ := service.MakeCommitElementByFileData("docs/guide.md", "guide\r\n", service.Utf8)
+	dat, _ := service.MakeCommitElementByFileData("other.dat", base64.StdEncoding.EncodeToString([]byte("o\r\n")), service.FormattedBinary)
+	text, _ := service.MakeCommitElementByFileData("notes.md", "notes\r\n", service.Utf8)
+	if _, err := gitInfo.CreateCommitByElement("add docs", []*service.CommitElement{nested, docs, dat, text}); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{"docs/guide.md": "guide\r\n", "other.dat": "o\r\n", "notes.md": "notes\n"} {
+		if got, _ := fake.fileContent("main", path); got != content {
+			t.Errorf("%s: expected %q, got %q", path, content, got)
+		}
+	}
+
+	//同じコミットで.gitattributesを削除した場合は内容から判定する
+	remove, _ := service.MakeCommitElementForDelete(".gitattributes")
+	again, _ := service.MakeCommitElementByFileData("data.dat", "z\r\n", service.Utf8)
+	if _, err := gitInfo.CreateCommitByElement("remove attributes", []*service.CommitElement{remove, again}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fake.fileContent("main", "data.dat"); got != "z\n" {
+		t.Errorf("data.dat: expected LF, got %q", got)
+	}
+}
+
+func TestLineEndingNormalizationBlobCache(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	dir := writeLocalFiles(t, map[string]string{"a.txt": "a\r\n"})
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := service.OpenBlobCache(filepath.Join(t.TempDir(), "cache.json"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitInfo := fake.gitInfo(t, "main")
+	gitInfo.SetBlobCache(cache)
+	gitInfo.SetLineEndingNormalization(true)
+	if _, err := gitInfo.CreateCommitByLocalDir("add a", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	//キャッシュには変換後のshaとサイズを保存する
+	plan, err := gitInfo.PlanCommitByLocalDir("plan", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.HasChanges() || plan.Entries[0].NewSize != 2 {
+		t.Errorf("normalized file should be unchanged.\n%s", plan)
+	}
+
+	//変換しない場合はキャッシュを使わずに元の内容で比較する
+	gitInfo.SetLineEndingNormalization(false)
+	plan, err = gitInfo.PlanCommitByLocalDir("plan", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.HasChanges() || plan.Entries[0].NewSize != 3 {
+		t.Errorf("file with CRLF should be changed without normalization.\n%s", plan)
+	}
+}
@@ -0,0 +1,162 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestGitlabProvider(t *testing.T) {
+	fake := newFakeGitLab(t, "group/repo")
+	fake.pageSize = 2 //ページングを確認するため小さくする
+	seedSha := fake.seed("main", map[string]string{
+		"README.md":     "readme\n",
+		"old.txt":       "old\n",
+		"run.sh":        "echo run\n",
+		"docs/a.txt":    "a\n",
+		"docs/sub/b.md": "b\n",
+	})
+	gitInfo := fake.gitInfo(t, "main")
+
+	//読み込み
+	content, err := gitInfo.GetFileContent("docs/sub/b.md")
+	if err != nil || string(content) != "b\n" {
+		t.Fatalf("unexpected content %q %v", content, err)
+	}
+	if exists, err := gitInfo.IsExistRepo(); err != nil || !exists {
+		t.Errorf("repository should exist. %v", err)
+	}
+
+	//追加・更新・削除・移動を1コミットで作成する
+	add, _ := service.MakeCommitElementByFileData("new/file.txt", "new\n", service.Utf8)
+	modify, _ := service.MakeCommitElementByFileData("README.md", "updated\n", service.Utf8)
+	remove, _ := service.MakeCommitElementForDelete("old.txt")
+	move, _ := service.MakeCommitElementForMove("docs/a.txt", "docs/moved.txt")
+	script, _ := service.MakeCommitElementByFileData("run.sh", "echo updated\n", service.Utf8)
+	resp, err := gitInfo.CreateCommitByElement("update files", []*service.CommitElement{add, modify, remove, move, script})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.refs["refs/heads/main"] != resp.Sha || len(resp.Parents) != 1 || resp.Parents[0].Sha != seedSha || resp.Author.Name != "tester" {
+		t.Errorf("unexpected commit %+v", resp)
+	}
+	files := fake.files("main")
+	if _, ok := files["old.txt"]; ok {
+		t.Error("old.txt should be deleted.")
+	}
+	if _, ok := files["docs/a.txt"]; ok || files["docs/moved.txt"].sha == "" {
+		t.Errorf("docs/a.txt should be moved. %v", files)
+	}
+	if files["run.sh"].mode != "100755" {
+		t.Errorf("executable bit should be kept, got %s", files["run.sh"].mode)
+	}
+	for path, want := range map[string]string{"new/file.txt": "new\n", "README.md": "updated\n", "docs/moved.txt": "a\n"} {
+		if got, _ := fake.fileContent("main", path); got != want {
+			t.Errorf("%s: unexpected content %q", path, got)
+		}
+	}
+
+	//モードの変更はchmodにする
+	patch := "diff --git a/README.md b/README.md\nold mode 100644\nnew mode 100755\n"
+	if _, err := gitInfo.CreateCommitByPatch("make readme executable", patch); err != nil {
+		t.Fatal(err)
+	}
+	if fake.files("main")["README.md"].mode != "100755" {
+		t.Error("README.md should be executable.")
+	}
+
+	//CreateCommitChainはコミットを順に作成する
+	first, _ := service.MakeCommitElementByFileData("chain.txt", "1\n", service.Utf8)
+	second, _ := service.MakeCommitElementByFileData("chain.txt", "2\n", service.Utf8)
+	respList, err := gitInfo.CreateCommitChain([]*service.CommitGroup{
+		{Message: "first", Elements: []*service.CommitElement{first}},
+		{Message: "second", Elements: []*service.CommitElement{second}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(respList) != 2 || respList[1].Parents[0].Sha != respList[0].Sha || fake.refs["refs/heads/main"] != respList[1].Sha {
+		t.Errorf("unexpected chain %+v", respList)
+	}
+	if got, _ := fake.fileContent("main", "chain.txt"); got != "2\n" {
+		t.Errorf("unexpected content %q", got)
+	}
+
+	//途中で失敗した場合は作成済みのコミットもエラーと一緒に返す
+	third, _ := service.MakeCommitElementByFileData("chain.txt", "3\n", service.Utf8)
+	failing, _ := service.MakeCommitElementByReader("fail.txt", &failingReader{})
+	partial, err := gitInfo.CreateCommitChain([]*service.CommitGroup{
+		{Message: "third", Elements: []*service.CommitElement{third}},
+		{Message: "fail", Elements: []*service.CommitElement{failing}},
+	})
+	if !errors.Is(err, errReadFailed) {
+		t.Errorf("expected read error, got %v", err)
+	}
+	if len(partial) != 1 || fake.refs["refs/heads/main"] != partial[0].Sha {
+		t.Errorf("created commit should be returned with the error. %+v", partial)
+	}
+	respList = append(respList, partial...)
+
+	//ブランチの一覧
+	branchList, err := gitInfo.ListBranches()
+	if err != nil || len(branchList) != 1 || branchList[0].Name != "main" || branchList[0].Commit.Sha != respList[2].Sha {
+		t.Errorf("unexpected branches %+v %v", branchList, err)
+	}
+
+	//GitHub固有の機能はErrNotSupportedを返す
+	if _, err := gitInfo.Preflight(); !errors.Is(err, service.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestGitlabBranchMoved(t *testing.T) {
+	fake := newFakeGitLab(t, "group/repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	gitInfo := fake.gitInfo(t, "main")
+
+	//コミットの直前に他のクライアントがブランチを更新した場合は、新しいブランチの先頭から作り直す
+	var movedSha string
+	fake.beforeUpdateRef = func() {
+		movedSha = fake.seed("main", map[string]string{"README.md": "readme\n", "other.txt": "by others\n"})
+	}
+	modify, _ := service.MakeCommitElementByFileData("README.md", "mine\n", service.Utf8)
+	resp, err := gitInfo.CreateCommitByElement("update readme", []*service.CommitElement{modify})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Parents) != 1 || resp.Parents[0].Sha != movedSha {
+		t.Errorf("commit should be rebuilt on %s, got %+v", movedSha, resp.Parents)
+	}
+	if fake.countCalls("POST", "/api/v4/projects/group%2Frepo/repository/commits") != 2 {
+		t.Errorf("expected a retry, got %v", fake.calls)
+	}
+	if got, _ := fake.fileContent("main", "other.txt"); got != "by others\n" {
+		t.Errorf("concurrent change should be kept. got %q", got)
+	}
+
+	//他のクライアントが同じファイルを追加した場合も、新しい内容を元に更新として作り直す
+	fake.beforeUpdateRef = func() {
+		fake.seed("main", map[string]string{"README.md": "mine\n", "other.txt": "by others\n", "new.txt": "by others\n"})
+	}
+	add, _ := service.MakeCommitElementByFileData("new.txt", "mine\n", service.Utf8)
+	if _, err := gitInfo.CreateCommitByElement("add new", []*service.CommitElement{add}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fake.fileContent("main", "new.txt"); got != "mine\n" {
+		t.Errorf("unexpected content %q", got)
+	}
+}
+
+func TestGitlabEmptyProject(t *testing.T) {
+	fake := newFakeGitLab(t, "group/empty")
+	gitInfo := fake.gitInfo(t, "main")
+	dir := writeLocalFiles(t, map[string]string{"a.txt": "a\n", "dir/b.txt": "b\n"})
+	resp, err := gitInfo.CreateCommitByLocalDir("initial commit", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Parents) != 0 || fake.refs["refs/heads/main"] != resp.Sha || len(fake.files("main")) != 2 {
+		t.Errorf("unexpected initial commit %+v %v", resp, fake.files("main"))
+	}
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// endpointがsuffixで終わるリクエストの直前に1度だけfnを呼ぶHook
+type beforeRequestHook struct {
+	suffix string
+	fn     func()
+}
+
+func (hook *beforeRequestHook) RequestStart(ctx context.Context, info *githubapi.RequestInfo) context.Context {
+	if strings.HasSuffix(info.Endpoint, hook.suffix) && hook.fn != nil {
+		fn := hook.fn
+		hook.fn = nil
+		fn()
+	}
+	return ctx
+}
+
+func (hook *beforeRequestHook) RequestEnd(ctx context.Context, info *githubapi.RequestInfo, result *githubapi.RequestResult) {
+}
+
+func TestGraphqlBackend(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	seedSha := fake.seed("main", map[string]string{"README.md": "readme\n", "old.txt": "old\n", "run.sh": "echo run\n"})
+	hook := &beforeRequestHook{suffix: "/graphql"}
+	client := &githubapi.GitClient{
+		Token:      fake.token,
+		Owner:      fake.owner,
+		Repository: fake.repo,
+		Branch:     "main",
+		BaseUrl:    fake.server.URL,
+		Hooks:      []githubapi.Hook{hook},
+	}
+	gitInfo, err := service.GetGitInfoByClient(client, "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitInfo.SetCommitBackend(service.BackendGraphql)
+
+	//追加・更新・削除はcreateCommitOnBranchで1回のリクエストで作成する
+	add, _ := service.MakeCommitElementByFileData("docs/new.txt", "new\n", service.Utf8)
+	modify, _ := service.MakeCommitElementByFileData("README.md", "updated\n", service.Utf8)
+	remove, _ := service.MakeCommitElementForDelete("old.txt")
+	resp, err := gitInfo.CreateCommitByElement("update docs\n\ndetails", []*service.CommitElement{add, modify, remove})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.countCalls("POST", "/graphql") != 1 || fake.countCalls("POST", "/repos/owner/repo/git/") != 0 {
+		t.Errorf("commit should be created by a single graphql request. %v", fake.calls)
+	}
+	if fake.refs["refs/heads/main"] != resp.Sha || len(resp.Parents) != 1 || resp.Parents[0].Sha != seedSha {
+		t.Errorf("unexpected commit %+v", resp)
+	}
+	if resp.Message != "update docs\n\ndetails" || resp.Author.Name != "graphql-bot" {
+		t.Errorf("unexpected message or author %q %q", resp.Message, resp.Author.Name)
+	}
+	files := fake.files("main")
+	if _, ok := files["old.txt"]; ok || len(files) != 3 {
+		t.Errorf("unexpected files %v", files)
+	}
+	if content, _ := fake.fileContent("main", "docs/new.txt"); content != "new\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	//実行ビットのあるファイルはREST APIで作成する
+	script, _ := service.MakeCommitElementByFileData("run.sh", "echo updated\n", service.Utf8)
+	if _, err := gitInfo.CreateCommitByElement("update script", []*service.CommitElement{script}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.countCalls("POST", "/graphql") != 1 || fake.countCalls("POST", "/repos/owner/repo/git/commits") != 1 {
+		t.Errorf("commit should fall back to the git data API. %v", fake.calls)
+	}
+	if entry := fake.files("main")["run.sh"]; entry.mode != "100755" {
+		t.Errorf("executable bit should be kept, got %s", entry.mode)
+	}
+
+	//ブランチが更新された場合は最新のコミットを元に作り直す
+	var movedSha string
+	hook.fn = func() { movedSha = fake.seed("main", map[string]string{"other.txt": "other\n"}) }
+	add, _ = service.MakeCommitElementByFileData("retry.txt", "retry\n", service.Utf8)
+	resp, err = gitInfo.CreateCommitByElement("retry", []*service.CommitElement{add})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.countCalls("POST", "/graphql") != 3 {
+		t.Errorf("graphql should be called again after the branch moved. %v", fake.calls)
+	}
+	if resp.Parents[0].Sha != movedSha || fake.refs["refs/heads/main"] != resp.Sha {
+		t.Errorf("commit should be created on the moved branch %+v", resp)
+	}
+}
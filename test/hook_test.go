@@ -0,0 +1,230 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// 作成したスパンを記録するTracer
+type recordTracer struct {
+	spans []*recordSpan
+}
+
+type recordSpan struct {
+	name  string
+	attrs map[string]any
+	ended bool
+}
+
+func (tracer *recordTracer) Start(ctx context.Context, spanName string) (context.Context, githubapi.Span) {
+	span := &recordSpan{name: spanName, attrs: make(map[string]any)}
+	tracer.spans = append(tracer.spans, span)
+	return ctx, span
+}
+
+func (span *recordSpan) SetAttribute(key string, value any) { span.attrs[key] = value }
+func (span *recordSpan) RecordError(err error)              { span.attrs["error"] = err.Error() }
+func (span *recordSpan) End()                               { span.ended = true }
+
+func TestHooks(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+
+	var logBuf bytes.Buffer
+	stats := &githubapi.StatsHook{}
+	tracer := &recordTracer{}
+	client := &githubapi.GitClient{
+		Token:      fake.token,
+		Owner:      fake.owner,
+		Repository: fake.repo,
+		Branch:     "main",
+		BaseUrl:    fake.server.URL,
+		MaxRetries: 2,
+		RetryWait:  time.Millisecond,
+		Hooks: []githubapi.Hook{
+			&githubapi.SlogHook{Logger: slog.New(slog.NewTextHandler(&logBuf, nil))},
+			stats,
+			&githubapi.TracingHook{Tracer: tracer},
+		},
+	}
+	gitInfo, err := service.GetGitInfoByClient(client, "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//一時的なエラーは再試行する
+	fake.failNext = []int{503, 502}
+	element, err := service.MakeCommitElementByFileData("a.txt", "a\n", service.Utf8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitInfo.CreateCommitByElement("add a.txt", []*service.CommitElement{element}); err != nil {
+		t.Fatal(err)
+	}
+	result := stats.Stats()
+	if result.Retries != 2 || result.Failures != 0 {
+		t.Errorf("unexpected stats %+v", result)
+	}
+	if result.Requests != len(tracer.spans) || result.ByMethod["PUT"] != 1 {
+		t.Errorf("requests %d, spans %d, by method %v", result.Requests, len(tracer.spans), result.ByMethod)
+	}
+	for _, span := range tracer.spans {
+		if !span.ended || span.attrs["http.response.status_code"] == nil {
+			t.Errorf("span is not completed. %+v", span)
+		}
+	}
+	if tracer.spans[0].attrs["http.request.resend_count"] != 2 {
+		t.Errorf("first request should be retried twice. %+v", tracer.spans[0].attrs)
+	}
+	if !strings.Contains(logBuf.String(), "retries=2") || !strings.Contains(logBuf.String(), "method=PUT") {
+		t.Errorf("unexpected log.\n%s", logBuf.String())
+	}
+
+	//再試行回数を超えた場合とクライアントエラーはそのまま返す
+	fake.failNext = []int{503, 503, 503}
+	if _, err := gitInfo.GetRepoState(); err == nil {
+		t.Error("error should be returned after retries are exhausted.")
+	}
+	fake.failNext = []int{404, 503}
+	before := stats.Stats()
+	if _, err := client.GetTree("0000000000000000000000000000000000000000", false); err == nil {
+		t.Error("404 should be returned.")
+	}
+	fake.failNext = nil
+	if after := stats.Stats(); after.Retries != before.Retries || after.Failures != before.Failures+1 {
+		t.Errorf("404 should not be retried. before %+v after %+v", before, after)
+	}
+	if !strings.Contains(logBuf.String(), "level=WARN") {
+		t.Errorf("failed request should be logged at warn.\n%s", logBuf.String())
+	}
+}
+
+func TestRetryOnlyReads(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	client := &githubapi.GitClient{
+		Token:      fake.token,
+		Owner:      fake.owner,
+		Repository: fake.repo,
+		Branch:     "main",
+		BaseUrl:    fake.server.URL,
+		MaxRetries: 2,
+		RetryWait:  time.Millisecond,
+	}
+	gitInfo, err := service.GetGitInfoByClient(client, "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//2ファイルの変更にしてgit data APIでコミットする
+	elements := func(content string) []*service.CommitElement {
+		a, _ := service.MakeCommitElementByFileData("a.txt", content, service.Utf8)
+		b, _ := service.MakeCommitElementByFileData("b.txt", content, service.Utf8)
+		return []*service.CommitElement{a, b}
+	}
+	failFirstBlob := func(status int) {
+		failed := false
+		fake.failWhen = func(method string, path string) int {
+			if method == "POST" && strings.HasSuffix(path, "/git/blobs") && !failed {
+				failed = true
+				return status
+			}
+			return 0
+		}
+	}
+
+	//書き込みは処理された可能性があるため502では再試行しない
+	failFirstBlob(502)
+	blobs := fake.countCalls("POST", "/repos/owner/repo/git/blobs")
+	if _, err := gitInfo.CreateCommitByElement("add files", elements("1\n")); err == nil {
+		t.Error("502 on a write should be returned.")
+	}
+	if count := fake.countCalls("POST", "/repos/owner/repo/git/blobs") - blobs; count != 1 {
+		t.Errorf("write should not be retried after 502, got %d requests", count)
+	}
+
+	//429は処理されていないため書き込みも再試行する
+	failFirstBlob(429)
+	if _, err := gitInfo.CreateCommitByElement("add files", elements("2\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fake.fileContent("main", "b.txt"); got != "2\n" {
+		t.Errorf("unexpected content %q", got)
+	}
+
+	//読み込みは502でも再試行する
+	fake.failWhen = nil
+	fake.failNext = []int{502}
+	if _, err := gitInfo.GetFileContent("a.txt"); err != nil {
+		t.Errorf("read should be retried after 502. %v", err)
+	}
+}
+
+type hookValueKey struct{}
+
+// contextに値を追加し、受け取ったcontextの値を記録するHook
+type valueHook struct {
+	value    string
+	received []any
+}
+
+func (hook *valueHook) RequestStart(ctx context.Context, info *githubapi.RequestInfo) context.Context {
+	hook.received = append(hook.received, ctx.Value(hookValueKey{}))
+	return context.WithValue(ctx, hookValueKey{}, hook.value)
+}
+
+func (hook *valueHook) RequestEnd(ctx context.Context, info *githubapi.RequestInfo, result *githubapi.RequestResult) {
+	hook.received = append(hook.received, ctx.Value(hookValueKey{}))
+}
+
+// 送信したhttp.Requestのcontextの値を記録するRoundTripper
+type contextTransport struct {
+	values []any
+}
+
+func (transport *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.values = append(transport.values, req.Context().Value(hookValueKey{}))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestHookContext(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	transport := &contextTransport{}
+	first := &valueHook{value: "first"}
+	second := &valueHook{value: "second"}
+	client := &githubapi.GitClient{
+		Token:      fake.token,
+		Owner:      fake.owner,
+		Repository: fake.repo,
+		Branch:     "main",
+		BaseUrl:    fake.server.URL,
+		HttpClient: &http.Client{Transport: transport},
+		MaxRetries: 1,
+		RetryWait:  time.Millisecond,
+		Hooks:      []githubapi.Hook{first, second},
+	}
+
+	//再試行を含め、Hookが返したcontextでリクエストを送る
+	fake.failNext = []int{503}
+	if _, err := client.GetLatestRef(); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.values) != 2 || transport.values[0] != "second" || transport.values[1] != "second" {
+		t.Errorf("request should carry the context of the hooks. %v", transport.values)
+	}
+	//後のHookは前のHookのcontextを受け取る
+	if len(first.received) != 2 || first.received[0] != nil || first.received[1] != "first" {
+		t.Errorf("unexpected contexts of the first hook %v", first.received)
+	}
+	if len(second.received) != 2 || second.received[0] != "first" || second.received[1] != "second" {
+		t.Errorf("unexpected contexts of the second hook %v", second.received)
+	}
+}
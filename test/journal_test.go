@@ -0,0 +1,127 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// 指定したファイルを持つローカルディレクトリを作成する
+func writeLocalFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for path, content := range files {
+		localPath := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(localPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// n回目の呼び出しで失敗させる
+func failNth(method string, pathSuffix string, n int) func(string, string) int {
+	count := 0
+	return func(m string, path string) int {
+		if m == method && strings.HasSuffix(path, pathSuffix) {
+			count++
+			if count == n {
+				return 500
+			}
+		}
+		return 0
+	}
+}
+
+func TestJournalResume(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	dir := writeLocalFiles(t, map[string]string{"a.txt": "a\n", "b.txt": "b\n", "c.txt": "c\n"})
+	journal, err := service.OpenJournal(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	gitInfo := fake.gitInfo(t, "main")
+	gitInfo.SetJournal(journal)
+
+	//2件目のblobで失敗した場合、再開時は残りのblobのみアップロードする
+	fake.failWhen = failNth("POST", "/git/blobs", 2)
+	if _, err := gitInfo.CreateCommitByLocalDir("add files", dir); err == nil {
+		t.Fatal("commit should fail.")
+	}
+	if !journal.Pending() {
+		t.Fatal("journal should have the failed commit.")
+	}
+	fake.failWhen = nil
+	respList, err := gitInfo.ResumeCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := fake.countCalls("POST", "/repos/owner/repo/git/blobs"); count != 4 {
+		t.Errorf("blob should be uploaded 4 times including the failed one, got %d", count)
+	}
+	if fake.refs["refs/heads/main"] != respList[0].Sha || respList[0].Message != "add files" {
+		t.Errorf("branch is not updated to the resumed commit. %v", fake.refs)
+	}
+	if len(fake.files("main")) != 4 {
+		t.Errorf("unexpected files %v", fake.files("main"))
+	}
+	if journal.Pending() {
+		t.Error("journal should be cleared after the commit is completed.")
+	}
+	if _, err := gitInfo.ResumeCommit(); !errors.Is(err, service.ErrNothingToResume) {
+		t.Errorf("expected ErrNothingToResume, got %v", err)
+	}
+
+	//refの更新で失敗した場合はrefの更新のみ行う
+	dir = writeLocalFiles(t, map[string]string{"d.txt": "d\n", "d2.txt": "d2\n"})
+	fake.failWhen = failNth("PATCH", "/git/refs/heads/main", 1)
+	if _, err := gitInfo.CreateCommitByLocalDir("add d", dir); err == nil {
+		t.Fatal("commit should fail.")
+	}
+	fake.failWhen = nil
+	blobs, trees, commits := fake.countCalls("POST", "/repos/owner/repo/git/blobs"), fake.countCalls("POST", "/repos/owner/repo/git/trees"), fake.countCalls("POST", "/repos/owner/repo/git/commits")
+	if _, err := gitInfo.ResumeCommit(); err != nil {
+		t.Fatal(err)
+	}
+	if fake.countCalls("POST", "/repos/owner/repo/git/blobs") != blobs || fake.countCalls("POST", "/repos/owner/repo/git/trees") != trees || fake.countCalls("POST", "/repos/owner/repo/git/commits") != commits {
+		t.Error("only the ref should be updated on resume.")
+	}
+	if content, _ := fake.fileContent("main", "d.txt"); content != "d\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	//再実行した場合もアップロード済みのblobは使う
+	dir = writeLocalFiles(t, map[string]string{"e.txt": "e\n", "f.txt": "f\n"})
+	fake.failWhen = failNth("POST", "/git/trees", 1)
+	if _, err := gitInfo.CreateCommitByLocalDir("add e f", dir); err == nil {
+		t.Fatal("commit should fail.")
+	}
+	fake.failWhen = nil
+	blobs = fake.countCalls("POST", "/repos/owner/repo/git/blobs")
+	if _, err := gitInfo.CreateCommitByLocalDir("add e f", dir); err != nil {
+		t.Fatal(err)
+	}
+	if fake.countCalls("POST", "/repos/owner/repo/git/blobs") != blobs {
+		t.Error("uploaded blobs should not be uploaded again.")
+	}
+
+	//記録後にブランチが更新された場合は再開しない
+	dir = writeLocalFiles(t, map[string]string{"g.txt": "g\n", "g2.txt": "g2\n"})
+	fake.failWhen = failNth("POST", "/git/commits", 1)
+	if _, err := gitInfo.CreateCommitByLocalDir("add g", dir); err == nil {
+		t.Fatal("commit should fail.")
+	}
+	fake.failWhen = nil
+	fake.seed("main", map[string]string{"other.txt": "other\n"})
+	if _, err := gitInfo.ResumeCommit(); !errors.Is(err, service.ErrBranchMoved) {
+		t.Errorf("expected ErrBranchMoved, got %v", err)
+	}
+}
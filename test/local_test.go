@@ -0,0 +1,227 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gitobj "github.com/daze-doragon/go-gituse/pkg/gitobj"
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// gitコマンドがある場合はリポジトリを検証する
+func gitCommand(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed.")
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=seed", "GIT_AUTHOR_EMAIL=seed@example.com", "GIT_COMMITTER_NAME=seed", "GIT_COMMITTER_EMAIL=seed@example.com", "GIT_CONFIG_GLOBAL=/dev/null")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func TestLocalRepository(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	repo, err := gitobj.InitBare(repoPath, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitInfo, err := service.GetGitInfoByLocalRepository(repoPath, "main", "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//空のリポジトリへの最初のコミット
+	dir := writeLocalFiles(t, map[string]string{"README.md": "hello\n", "docs/a.txt": "a\n", "run.sh": "echo run\n"})
+	resp, err := gitInfo.CreateCommitByLocalDir("initial commit", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Parents) != 0 {
+		t.Errorf("initial commit should not have parents. %+v", resp.Parents)
+	}
+
+	//オブジェクトを独立に組み立てて、バイト単位で一致することを確認する
+	blob := func(content string) string { return gitobj.HashObject("blob", []byte(content)) }
+	docsTree, _ := gitobj.EncodeTree([]*gitobj.TreeEntry{{Mode: "100644", Name: "a.txt", Sha: blob("a\n")}})
+	rootTree, _ := gitobj.EncodeTree([]*gitobj.TreeEntry{
+		{Mode: "100644", Name: "run.sh", Sha: blob("echo run\n")},
+		{Mode: "040000", Name: "docs", Sha: gitobj.HashObject("tree", docsTree)},
+		{Mode: "100644", Name: "README.md", Sha: blob("hello\n")},
+	})
+	wantTree := "100644 README.md\x00"
+	if !strings.HasPrefix(string(rootTree), wantTree) || !strings.Contains(string(rootTree), "40000 docs\x00") {
+		t.Errorf("unexpected tree encoding %q", rootTree)
+	}
+	if resp.Tree.Sha != gitobj.HashObject("tree", rootTree) {
+		t.Errorf("unexpected tree %s", resp.Tree.Sha)
+	}
+	when, err := time.Parse(time.RFC3339, resp.Author.Date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCommit := "tree " + resp.Tree.Sha + "\n" +
+		"author tester <tester@example.com> " + strconv.FormatInt(when.Unix(), 10) + " " + when.Format("-0700") + "\n" +
+		"committer tester <tester@example.com> " + strconv.FormatInt(when.Unix(), 10) + " " + when.Format("-0700") + "\n" +
+		"\ninitial commit"
+	objType, data, err := repo.ReadObject(resp.Sha)
+	if err != nil || objType != "commit" || string(data) != wantCommit {
+		t.Errorf("unexpected commit object %s %q %v", objType, data, err)
+	}
+	if gitobj.HashObject("commit", []byte(wantCommit)) != resp.Sha {
+		t.Error("commit sha does not match its content.")
+	}
+	if ref, _ := os.ReadFile(filepath.Join(repoPath, "refs", "heads", "main")); string(ref) != resp.Sha+"\n" {
+		t.Errorf("unexpected ref file %q", ref)
+	}
+
+	//変更、削除、移動、モード変更
+	modify, _ := service.MakeCommitElementByFileData("README.md", "updated\n", service.Utf8)
+	remove, _ := service.MakeCommitElementForDelete("docs/a.txt")
+	move, _ := service.MakeCommitElementForMove("run.sh", "bin/run.sh")
+	second, err := gitInfo.CreateCommitByElement("second commit", []*service.CommitElement{modify, remove, move})
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch := "diff --git a/bin/run.sh b/bin/run.sh\nold mode 100644\nnew mode 100755\n"
+	third, err := gitInfo.CreateCommitByPatch("make run.sh executable", patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.ReadCommit(third.Sha)
+	if err != nil || len(commit.Parents) != 1 || commit.Parents[0] != second.Sha {
+		t.Fatalf("unexpected commit %+v %v", commit, err)
+	}
+	entries, _ := repo.ReadTree(commit.Tree)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Mode+" "+entry.Name)
+	}
+	if strings.Join(names, ",") != "100644 README.md,040000 bin" {
+		t.Errorf("unexpected root tree %v", names)
+	}
+	binEntries, _ := repo.ReadTree(entries[1].Sha)
+	if len(binEntries) != 1 || binEntries[0].Mode != "100755" || binEntries[0].Sha != blob("echo run\n") {
+		t.Errorf("unexpected bin tree %+v", binEntries[0])
+	}
+
+	//読み込み
+	content, err := gitInfo.GetFileContent("README.md")
+	if err != nil || string(content) != "updated\n" {
+		t.Errorf("unexpected content %q %v", content, err)
+	}
+	branchList, err := gitInfo.ListBranches()
+	if err != nil || len(branchList) != 1 || branchList[0].Name != "main" || branchList[0].Commit.Sha != third.Sha {
+		t.Errorf("unexpected branches %+v %v", branchList, err)
+	}
+
+	//gitで検証する
+	gitCommand(t, repoPath, "fsck", "--strict", "--no-dangling")
+	if out := gitCommand(t, repoPath, "log", "--format=%s", "main"); out != "make run.sh executable\nsecond commit\ninitial commit\n" {
+		t.Errorf("unexpected log %q", out)
+	}
+	if out := gitCommand(t, repoPath, "cat-file", "-p", "main:README.md"); out != "updated\n" {
+		t.Errorf("unexpected content %q", out)
+	}
+}
+
+func TestLocalRepositoryPacked(t *testing.T) {
+	//gitで作成し、gcでpackしたリポジトリにコミットする
+	work := t.TempDir()
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	gitCommand(t, work, "init", "--bare", "-b", "main", repoPath)
+	gitCommand(t, work, "clone", repoPath, "clone")
+	clone := filepath.Join(work, "clone")
+	large := strings.Repeat("line of text for delta compression\n", 200)
+	for i, suffix := range []string{"first\n", "second\n"} {
+		os.WriteFile(filepath.Join(clone, "large.txt"), []byte(large+suffix), 0644)
+		os.MkdirAll(filepath.Join(clone, "dir"), 0755)
+		os.WriteFile(filepath.Join(clone, "dir", "keep.txt"), []byte("keep\n"), 0644)
+		gitCommand(t, clone, "add", "-A")
+		gitCommand(t, clone, "commit", "-m", "commit "+strconv.Itoa(i))
+	}
+	gitCommand(t, clone, "push", "origin", "main")
+	gitCommand(t, repoPath, "gc", "--aggressive")
+	gitCommand(t, repoPath, "pack-refs", "--all")
+	if _, err := os.Stat(filepath.Join(repoPath, "refs", "heads", "main")); err == nil {
+		t.Fatal("ref should be packed.")
+	}
+
+	gitInfo, err := service.GetGitInfoByLocalRepository(repoPath, "", "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := gitInfo.GetFileContent("large.txt")
+	if err != nil || string(content) != large+"second\n" {
+		t.Fatalf("unexpected content %d bytes %v", len(content), err)
+	}
+	//古い版はdeltaとして格納される
+	repo, _ := gitobj.Open(repoPath)
+	oldSha := strings.TrimSpace(gitCommand(t, repoPath, "rev-parse", "main~1:large.txt"))
+	if _, data, err := repo.ReadObject(oldSha); err != nil || string(data) != large+"first\n" {
+		t.Errorf("unexpected old content %d bytes %v", len(data), err)
+	}
+	if objType, size, err := repo.ObjectInfo(oldSha); err != nil || objType != "blob" || size != len(large+"first\n") {
+		t.Errorf("unexpected object info %s %d %v", objType, size, err)
+	}
+	head := strings.TrimSpace(gitCommand(t, repoPath, "rev-parse", "main"))
+	add, _ := service.MakeCommitElementByFileData("dir/new.txt", "new\n", service.Utf8)
+	resp, err := gitInfo.CreateCommitByElement("add new.txt", []*service.CommitElement{add})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Parents) != 1 || resp.Parents[0].Sha != head {
+		t.Errorf("unexpected parents %+v", resp.Parents)
+	}
+	gitCommand(t, repoPath, "fsck", "--strict", "--no-dangling")
+	if out := gitCommand(t, repoPath, "ls-tree", "-r", "--name-only", "main"); out != "dir/keep.txt\ndir/new.txt\nlarge.txt\n" {
+		t.Errorf("unexpected files %q", out)
+	}
+}
+
+func TestLocalRepositoryRefLock(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	repo, err := gitobj.InitBare(repoPath, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitInfo, err := service.GetGitInfoByLocalRepository(repoPath, "main", "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	add, _ := service.MakeCommitElementByFileData("a.txt", "a\n", service.Utf8)
+	first, err := gitInfo.CreateCommitByElement("first", []*service.CommitElement{add})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//想定と異なる値の場合は更新しない
+	if err := repo.UpdateRef("refs/heads/main", first.Sha, strings.Repeat("0", 40)); !errors.Is(err, gitobj.ErrRefMoved) {
+		t.Errorf("expected ErrRefMoved, got %v", err)
+	}
+
+	//他のプロセスがロックしている場合はエラーにする
+	lockPath := filepath.Join(repoPath, "refs", "heads", "main.lock")
+	os.WriteFile(lockPath, nil, 0644)
+	modify, _ := service.MakeCommitElementByFileData("a.txt", "b\n", service.Utf8)
+	if _, err := gitInfo.CreateCommitByElement("second", []*service.CommitElement{modify}); !errors.Is(err, gitobj.ErrRefLocked) {
+		t.Errorf("expected ErrRefLocked, got %v", err)
+	}
+	if sha, _ := repo.ReadRef("refs/heads/main"); sha != first.Sha {
+		t.Errorf("branch should not be updated. %s", sha)
+	}
+	os.Remove(lockPath)
+	if _, err := gitInfo.CreateCommitByElement("second", []*service.CommitElement{modify}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestMoveAndCopy(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{
+		"README.md":        "readme\n",
+		"docs/a.md":        "a\n",
+		"docs/sub/b.md":    "b\n",
+		"scripts/build.sh": "echo build\n",
+		"old/name.txt":     "name\n",
+	})
+	gitInfo := fake.gitInfo(t, "main")
+	before := fake.files("main")
+
+	//ファイルとディレクトリのコピー、移動を1コミットで作成する
+	copyFile, err := service.MakeCommitElementForCopy("README.md", "docs/README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copyDir, _ := service.MakeCommitElementForCopy("docs", "archive/docs")
+	moveFile, _ := service.MakeCommitElementForMove("old/name.txt", "new/name.txt")
+	moveDir, _ := service.MakeCommitElementForMove("/scripts/", "bin")
+	if _, err := gitInfo.CreateCommitByElement("reorganize", []*service.CommitElement{copyFile, copyDir, moveFile, moveDir}); err != nil {
+		t.Fatal(err)
+	}
+
+	//既存のblobのshaとモードを再利用し、blobはアップロードしない
+	if count := fake.countCalls("POST", "/repos/owner/repo/git/blobs"); count != 0 {
+		t.Errorf("move and copy should not upload blobs, got %d", count)
+	}
+	after := fake.files("main")
+	for dest, source := range map[string]string{
+		"docs/README.md":        "README.md",
+		"archive/docs/a.md":     "docs/a.md",
+		"archive/docs/sub/b.md": "docs/sub/b.md",
+		"new/name.txt":          "old/name.txt",
+		"bin/build.sh":          "scripts/build.sh",
+	} {
+		if after[dest].sha != before[source].sha || after[dest].mode != before[source].mode {
+			t.Errorf("%s should reuse %s. %+v %+v", dest, source, after[dest], before[source])
+		}
+	}
+	//コピー元は残り、移動元は削除される
+	for _, kept := range []string{"README.md", "docs/a.md", "docs/sub/b.md"} {
+		if _, ok := after[kept]; !ok {
+			t.Errorf("%s should be kept.", kept)
+		}
+	}
+	for _, removed := range []string{"old/name.txt", "scripts/build.sh"} {
+		if _, ok := after[removed]; ok {
+			t.Errorf("%s should be removed.", removed)
+		}
+	}
+	if after["bin/build.sh"].mode != "100755" {
+		t.Errorf("executable mode should be kept. %+v", after["bin/build.sh"])
+	}
+
+	//既存のファイルと同じ内容へのコピーは変更なしになる
+	same, _ := service.MakeCommitElementForCopy("README.md", "docs/README.md")
+	plan, err := gitInfo.PlanCommitByElement("copy again", []*service.CommitElement{same})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.HasChanges() {
+		t.Errorf("copy of the same content should be unchanged.\n%s", plan)
+	}
+
+	//移動元は他の削除と同じくサイズなしで表示する
+	move, _ := service.MakeCommitElementForMove("docs/a.md", "docs/moved.md")
+	plan, err = gitInfo.PlanCommitByElement("move again", []*service.CommitElement{move})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range plan.Entries {
+		if entry.Path == "docs/a.md" && (entry.Action != service.ActionDelete || entry.OldSize != 2 || entry.NewSize != -1) {
+			t.Errorf("unexpected entry of the move source %+v", *entry)
+		}
+	}
+	if !strings.Contains(plan.String(), "  D  docs/a.md (2 bytes)\n") {
+		t.Errorf("unexpected summary\n%s", plan)
+	}
+
+	missing, _ := service.MakeCommitElementForCopy("missing.txt", "copied.txt")
+	if _, err := gitInfo.CreateCommitByElement("copy missing", []*service.CommitElement{missing}); err == nil {
+		t.Error("missing source should be rejected.")
+	}
+	for name, paths := range map[string][2]string{
+		"empty":        {"", "a"},
+		"same":         {"docs", "/docs/"},
+		"inside":       {"docs", "docs/sub/docs"},
+		"empty toPath": {"docs", "/"},
+	} {
+		if _, err := service.MakeCommitElementForCopy(paths[0], paths[1]); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// line1からlineNまでのファイル内容
+func numberedLines(n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "line%d\n", i)
+	}
+	return sb.String()
+}
+
+const modifyLine5Patch = `diff --git a/a.txt b/a.txt
+index 1111111..2222222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -3,5 +3,5 @@
+ line3
+ line4
+-line5
++LINE5
+ line6
+ line7
+`
+
+func TestParsePatch(t *testing.T) {
+	patch := `diff --git a/mod.txt b/mod.txt
+index 1111111..2222222 100644
+--- a/mod.txt
++++ b/mod.txt
+@@ -1,2 +1,3 @@ func main
+ keep
+-old
++new
++added
+diff --git a/new.txt b/new.txt
+new file mode 100755
+index 0000000..3333333
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++created
+\ No newline at end of file
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+index 4444444..0000000
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+diff --git a/from.txt b/to.txt
+similarity index 100%
+rename from from.txt
+rename to to.txt
+diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+diff --git a/image.png b/image.png
+Binary files a/image.png and b/image.png differ
+`
+	fileList, err := service.ParsePatch(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileList) != 6 {
+		t.Fatalf("expected 6 files, got %d", len(fileList))
+	}
+	mod := fileList[0]
+	if mod.OldPath != "mod.txt" || mod.NewPath != "mod.txt" || mod.OldMode != "100644" || len(mod.Hunks) != 1 {
+		t.Errorf("unexpected modify %+v", mod)
+	}
+	hunk := mod.Hunks[0]
+	if hunk.OldStart != 1 || hunk.OldLines != 2 || hunk.NewStart != 1 || hunk.NewLines != 3 || hunk.Header != "func main" || len(hunk.Lines) != 4 {
+		t.Errorf("unexpected hunk %+v", hunk)
+	}
+	if created := fileList[1]; !created.IsNew || created.OldPath != "" || created.NewMode != "100755" || !created.Hunks[0].NewNoEOL {
+		t.Errorf("unexpected new file %+v", created)
+	}
+	if gone := fileList[2]; !gone.IsDelete || gone.NewPath != "" || gone.OldPath != "gone.txt" {
+		t.Errorf("unexpected deleted file %+v", gone)
+	}
+	if renamed := fileList[3]; !renamed.IsRename || renamed.OldPath != "from.txt" || renamed.NewPath != "to.txt" || len(renamed.Hunks) != 0 {
+		t.Errorf("unexpected rename %+v", renamed)
+	}
+	if chmod := fileList[4]; chmod.OldMode != "100644" || chmod.NewMode != "100755" {
+		t.Errorf("unexpected mode change %+v", chmod)
+	}
+	if !fileList[5].IsBinary {
+		t.Errorf("binary patch should be detected %+v", fileList[5])
+	}
+
+	//diff --gitのない通常のunified diff
+	plain, err := service.ParsePatch("--- a.txt\t2024-01-01\n+++ a.txt\t2024-01-02\n@@ -1 +1 @@\n-a\n+b\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain) != 1 || plain[0].OldPath != "a.txt" || plain[0].NewPath != "a.txt" || len(plain[0].Hunks) != 1 {
+		t.Errorf("unexpected plain diff %+v", plain[0])
+	}
+
+	for name, invalid := range map[string]string{
+		"empty":          "",
+		"no header":      "@@ -1 +1 @@\n-a\n+b\n",
+		"truncated hunk": "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n a\n",
+		"invalid line":   "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n*a\n",
+	} {
+		if _, err := service.ParsePatch(invalid); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCreateCommitByPatch(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	//hunkの記載位置より2行後ろにずれた内容
+	fake.seed("main", map[string]string{
+		"a.txt":    "extra1\nextra2\n" + numberedLines(10),
+		"gone.txt": "bye\n",
+		"from.txt": "one\ntwo\n",
+	})
+	gitInfo := fake.gitInfo(t, "main")
+	patch := modifyLine5Patch + `diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++hello
++world
+\ No newline at end of file
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+diff --git a/from.txt b/to.txt
+similarity index 50%
+rename from from.txt
+rename to to.txt
+--- a/from.txt
++++ b/to.txt
+@@ -1,2 +1,2 @@
+ one
+-two
++TWO
+`
+	if _, err := gitInfo.CreateCommitByPatch("apply patch", patch); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"a.txt":   "extra1\nextra2\n" + strings.Replace(numberedLines(10), "line5\n", "LINE5\n", 1),
+		"new.txt": "hello\nworld",
+		"to.txt":  "one\nTWO\n",
+	}
+	for path, content := range want {
+		if got, _ := fake.fileContent("main", path); got != content {
+			t.Errorf("%s: expected %q, got %q", path, content, got)
+		}
+	}
+	files := fake.files("main")
+	if _, ok := files["gone.txt"]; ok {
+		t.Error("gone.txt should be deleted.")
+	}
+	if _, ok := files["from.txt"]; ok {
+		t.Error("from.txt should be renamed.")
+	}
+}
+
+func TestPatchConflict(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"a.txt": "a\nb\nc\n", "exists.txt": "x\n"})
+	gitInfo := fake.gitInfo(t, "main")
+	before := fake.refs["refs/heads/main"]
+
+	patch := modifyLine5Patch + `diff --git a/missing.txt b/missing.txt
+--- a/missing.txt
++++ b/missing.txt
+@@ -1 +1 @@
+-m
++n
+diff --git a/exists.txt b/exists.txt
+new file mode 100644
+--- /dev/null
++++ b/exists.txt
+@@ -0,0 +1 @@
++y
+`
+	_, err := gitInfo.CreateCommitByPatch("conflict", patch)
+	var conflict *service.PatchConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected PatchConflictError, got %v", err)
+	}
+	//全ファイルの結果をまとめて返す
+	reasons := make(map[string]string)
+	for _, result := range conflict.Results {
+		if !result.Applied {
+			reasons[result.Path] = result.Reason
+		}
+	}
+	if reasons["a.txt"] != "context does not match." || reasons["missing.txt"] != "file does not exist in branch." || reasons["exists.txt"] != "file already exists in branch." {
+		t.Errorf("unexpected results %v", reasons)
+	}
+	if !strings.Contains(err.Error(), "a.txt hunk #1 (line 3)") {
+		t.Errorf("unexpected message %s", err)
+	}
+	if fake.refs["refs/heads/main"] != before {
+		t.Error("branch should not be updated on conflict.")
+	}
+}
+
+func TestPatchBranchMoved(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"a.txt": numberedLines(10), "b.txt": "b\n"})
+	gitInfo := fake.gitInfo(t, "main")
+	//2ファイルの変更にしてgit data APIでコミットする
+	patch := modifyLine5Patch + `diff --git a/b.txt b/b.txt
+--- a/b.txt
++++ b/b.txt
+@@ -1 +1 @@
+-b
++B
+`
+
+	//他のコミットが別の行を変更した場合は、新しい内容にパッチを適用し直して両方の変更を残す
+	fake.beforeUpdateRef = func() {
+		fake.seed("main", map[string]string{"a.txt": strings.Replace(numberedLines(10), "line1\n", "first\n", 1), "b.txt": "b\n"})
+	}
+	if _, err := gitInfo.CreateCommitByPatch("apply", patch); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(strings.Replace(numberedLines(10), "line1\n", "first\n", 1), "line5\n", "LINE5\n", 1)
+	if got, _ := fake.fileContent("main", "a.txt"); got != want {
+		t.Errorf("concurrent change should be kept. got %q", got)
+	}
+
+	//他のコミットが同じ行を変更した場合は、古い内容で上書きせずにコンフリクトにする
+	fake.seed("main", map[string]string{"a.txt": numberedLines(10), "b.txt": "b\n"})
+	concurrent := strings.Replace(numberedLines(10), "line5\n", "five\n", 1)
+	fake.beforeUpdateRef = func() {
+		fake.seed("main", map[string]string{"a.txt": concurrent, "b.txt": "b\n"})
+	}
+	_, err := gitInfo.CreateCommitByPatch("apply", patch)
+	var conflict *service.PatchConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected PatchConflictError, got %v", err)
+	}
+	if got, _ := fake.fileContent("main", "a.txt"); got != concurrent {
+		t.Errorf("concurrent change should not be reverted. got %q", got)
+	}
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestPlanCommit(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	baseSha := fake.seed("main", map[string]string{
+		"README.md": "readme\n",
+		"keep.txt":  "keep\n",
+		"old.txt":   "old\n",
+		"run.sh":    "echo run\n",
+		"bin/run":   "echo run\n",
+	})
+	gitInfo := fake.gitInfo(t, "main")
+
+	add, _ := service.MakeCommitElementByFileData("new.txt", "new\n", service.Utf8)
+	modify, _ := service.MakeCommitElementByFileData("README.md", "updated readme\n", service.Utf8)
+	remove, _ := service.MakeCommitElementForDelete("old.txt")
+	unchanged, _ := service.MakeCommitElementByFileData("keep.txt", "keep\n", service.Utf8)
+	//同じ内容の実行可能ファイルをコピーするとモードだけが変わる
+	modeChange, _ := service.MakeCommitElementForCopy("run.sh", "bin/run")
+	plan, err := gitInfo.PlanCommitByElement("plan", []*service.CommitElement{add, modify, remove, unchanged, modeChange})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//書き込みのAPIは呼ばない
+	for _, call := range fake.calls {
+		if !strings.HasPrefix(call, "GET ") {
+			t.Errorf("plan should not write. %s", call)
+		}
+	}
+	if len(fake.files("main")) != 5 || fake.refs["refs/heads/main"] != baseSha {
+		t.Error("branch should not be changed by plan.")
+	}
+
+	if plan.BaseCommitSha != baseSha || plan.Owner != "owner" || plan.Branch != "main" || plan.Message != "plan" || !plan.HasChanges() {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+	want := map[string]service.PlanEntry{
+		"new.txt":   {Action: service.ActionAdd, NewMode: "100644", OldSize: -1, NewSize: 4},
+		"README.md": {Action: service.ActionModify, OldMode: "100644", NewMode: "100644", OldSize: 7, NewSize: 15},
+		"old.txt":   {Action: service.ActionDelete, OldMode: "100644", OldSize: 4, NewSize: -1},
+		"keep.txt":  {Action: service.ActionUnchanged, OldMode: "100644", NewMode: "100644", OldSize: 5, NewSize: 5},
+		"bin/run":   {Action: service.ActionModeChange, OldMode: "100644", NewMode: "100755", OldSize: 9, NewSize: 9},
+	}
+	if len(plan.Entries) != len(want) {
+		t.Fatalf("unexpected entries\n%s", plan)
+	}
+	for _, entry := range plan.Entries {
+		expected := want[entry.Path]
+		if entry.Action != expected.Action || entry.OldMode != expected.OldMode || entry.NewMode != expected.NewMode || entry.OldSize != expected.OldSize || entry.NewSize != expected.NewSize {
+			t.Errorf("%s: expected %+v, got %+v", entry.Path, expected, *entry)
+		}
+		if (entry.Action == service.ActionDelete) != (entry.NewSha == "") || (entry.Action == service.ActionAdd) != (entry.OldSha == "") {
+			t.Errorf("%s: unexpected sha %+v", entry.Path, *entry)
+		}
+	}
+
+	expected := "owner/repo main (base: " + baseSha[:7] + ")\n" +
+		"  A  new.txt (100644, 4 bytes)\n" +
+		"  M  README.md (7 bytes -> 15 bytes)\n" +
+		"  D  old.txt (4 bytes)\n" +
+		"  T  bin/run (100644 -> 100755)\n" +
+		"1 added, 1 modified, 1 deleted, 1 mode changed, 1 unchanged"
+	if plan.String() != expected {
+		t.Errorf("unexpected summary\n%s\nexpected\n%s", plan, expected)
+	}
+
+	//変更がない場合
+	plan, err = gitInfo.PlanCommitByElement("plan", []*service.CommitElement{unchanged})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.HasChanges() || !strings.HasSuffix(plan.String(), "0 added, 0 modified, 0 deleted, 0 mode changed, 1 unchanged") {
+		t.Errorf("unexpected plan\n%s", plan)
+	}
+
+	//空のリポジトリ
+	empty := newFakeGitHub(t, "owner", "empty")
+	plan, err = empty.gitInfo(t, "main").PlanCommitByElement("plan", []*service.CommitElement{add})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.BaseCommitSha != "" || !strings.Contains(plan.String(), "(base: empty repository)") || plan.Entries[0].Action != service.ActionAdd {
+		t.Errorf("unexpected plan\n%s", plan)
+	}
+}
@@ -0,0 +1,123 @@
+package test
+
+import (
+	"testing"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// 項目ごとの結果を返す
+func preflightStatuses(t *testing.T, gitInfo *service.GitInfo) (*service.PreflightReport, map[string]service.PreflightStatus) {
+	t.Helper()
+	report, err := gitInfo.Preflight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(map[string]service.PreflightStatus)
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status
+	}
+	return report, statuses
+}
+
+func TestPreflight(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+
+	//classic tokenはスコープとpush権限で判定する
+	fake.token = "ghp_classic"
+	fake.scopes = []string{"repo", "read:org"}
+	report, statuses := preflightStatuses(t, fake.gitInfo(t, "main"))
+	if !report.Ok() || report.TokenType != "classic" || len(report.Scopes) != 2 || report.DefaultBranch != "main" {
+		t.Errorf("unexpected report\n%s", report)
+	}
+	for _, name := range []string{service.CheckToken, service.CheckRepository, service.CheckBranch, service.CheckContentWrite} {
+		if statuses[name] != service.PreflightPassed {
+			t.Errorf("%s should pass\n%s", name, report)
+		}
+	}
+
+	//スコープのないclassic tokenは空のヘッダが返る
+	fake.scopes = []string{}
+	report, statuses = preflightStatuses(t, fake.gitInfo(t, "main"))
+	if report.Ok() || statuses[service.CheckContentWrite] != service.PreflightFailed || report.Scopes == nil {
+		t.Errorf("token without repo scope should fail\n%s", report)
+	}
+	//public_repoは非公開リポジトリには書き込めない
+	fake.scopes = []string{"public_repo"}
+	if report, statuses = preflightStatuses(t, fake.gitInfo(t, "main")); statuses[service.CheckContentWrite] != service.PreflightFailed {
+		t.Errorf("public_repo should not write a private repository\n%s", report)
+	}
+	//スコープがあってもpush権限がない場合は失敗
+	fake.scopes = []string{"repo"}
+	fake.readOnly = true
+	if report, statuses = preflightStatuses(t, fake.gitInfo(t, "main")); statuses[service.CheckContentWrite] != service.PreflightFailed {
+		t.Errorf("user without push permission should fail\n%s", report)
+	}
+	fake.readOnly = false
+
+	//X-OAuth-Scopesヘッダが返されない場合はスコープを確認できない
+	fake.scopes = nil
+	report, statuses = preflightStatuses(t, fake.gitInfo(t, "main"))
+	if !report.Ok() || report.Scopes != nil || statuses[service.CheckContentWrite] != service.PreflightUnknown {
+		t.Errorf("scopes of classic token without header should be unknown\n%s", report)
+	}
+
+	//fine-grained tokenはpush権限のみ確認できる
+	fake.token = "github_pat_fine"
+	report, statuses = preflightStatuses(t, fake.gitInfo(t, "main"))
+	if !report.Ok() || report.TokenType != "fine-grained" || statuses[service.CheckContentWrite] != service.PreflightUnknown {
+		t.Errorf("unexpected fine-grained report\n%s", report)
+	}
+	fake.readOnly = true
+	if report, statuses = preflightStatuses(t, fake.gitInfo(t, "main")); report.Ok() || statuses[service.CheckContentWrite] != service.PreflightFailed {
+		t.Errorf("fine-grained token without push should fail\n%s", report)
+	}
+	fake.readOnly = false
+
+	//アーカイブされたリポジトリには書き込めない
+	fake.archived = true
+	report, statuses = preflightStatuses(t, fake.gitInfo(t, "main"))
+	if report.Ok() || statuses[service.CheckRepository] != service.PreflightFailed || statuses[service.CheckContentWrite] != service.PreflightFailed {
+		t.Errorf("archived repository should fail\n%s", report)
+	}
+	fake.archived = false
+}
+
+func TestPreflightBranchAndRepository(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.token = "github_pat_fine"
+
+	//空のリポジトリは最初のコミットでブランチを作成する
+	report, statuses := preflightStatuses(t, fake.gitInfo(t, "main"))
+	if !report.Ok() || statuses[service.CheckBranch] != service.PreflightPassed {
+		t.Errorf("empty repository should pass\n%s", report)
+	}
+
+	//ブランチがない場合は作成できるため警告にする
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	report, statuses = preflightStatuses(t, fake.gitInfo(t, "feature"))
+	if !report.Ok() || statuses[service.CheckBranch] != service.PreflightWarning || report.Check(service.CheckBranch).Detail == "" {
+		t.Errorf("missing branch should be a warning\n%s", report)
+	}
+
+	//トークンが無効な場合とリポジトリにアクセスできない場合
+	gitInfo := fake.gitInfo(t, "main")
+	fake.token = "github_pat_other"
+	report, statuses = preflightStatuses(t, gitInfo)
+	if report.Ok() || statuses[service.CheckToken] != service.PreflightFailed || statuses[service.CheckContentWrite] != service.PreflightSkipped {
+		t.Errorf("invalid token should fail\n%s", report)
+	}
+	fake.token = "github_pat_fine"
+	fake.forbidden = true
+	report, statuses = preflightStatuses(t, gitInfo)
+	if report.Ok() || statuses[service.CheckToken] != service.PreflightPassed || statuses[service.CheckRepository] != service.PreflightFailed {
+		t.Errorf("forbidden repository should fail\n%s", report)
+	}
+	fake.forbidden = false
+	fake.exists = false
+	report, statuses = preflightStatuses(t, gitInfo)
+	if report.Ok() || statuses[service.CheckRepository] != service.PreflightFailed || statuses[service.CheckBranch] != service.PreflightSkipped {
+		t.Errorf("missing repository should fail\n%s", report)
+	}
+}
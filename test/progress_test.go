@@ -0,0 +1,65 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestProgress(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"same.txt": "same\n"})
+	dir := t.TempDir()
+	files := map[string]string{"a.txt": "aaaa", "sub/b.txt": "bb", "same.txt": "same\n"}
+	for path, content := range files {
+		localPath := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(localPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gitInfo := fake.gitInfo(t, "main")
+	var progressList []service.Progress
+	gitInfo.SetProgressFunc(func(progress service.Progress) {
+		progressList = append(progressList, progress)
+	})
+	if _, err := gitInfo.CreateCommitByLocalDir("progress", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var phases []service.ProgressPhase
+	last := make(map[service.ProgressPhase]service.Progress)
+	for _, progress := range progressList {
+		if len(phases) == 0 || phases[len(phases)-1] != progress.Phase {
+			phases = append(phases, progress.Phase)
+		}
+		last[progress.Phase] = progress
+	}
+	expected := []service.ProgressPhase{service.PhaseScan, service.PhaseHash, service.PhaseUpload, service.PhaseTree, service.PhaseCommit, service.PhaseRef}
+	if len(phases) != len(expected) {
+		t.Fatalf("unexpected phases %v", phases)
+	}
+	for i := range expected {
+		if phases[i] != expected[i] {
+			t.Fatalf("unexpected phases %v", phases)
+		}
+	}
+	if scan := last[service.PhaseScan]; scan.Current != 3 {
+		t.Errorf("scan: %+v", scan)
+	}
+	if hash := last[service.PhaseHash]; hash.Current != 3 || hash.Total != 3 || hash.Bytes != 11 {
+		t.Errorf("hash: %+v", hash)
+	}
+	//変更のないsame.txtはアップロードしない
+	if upload := last[service.PhaseUpload]; upload.Current != 2 || upload.Total != 2 || upload.Bytes != 6 || upload.TotalBytes != 6 {
+		t.Errorf("upload: %+v", upload)
+	}
+	if ref := last[service.PhaseRef]; ref.Current != 1 || ref.Group != 1 || ref.Groups != 1 || ref.Attempt != 1 {
+		t.Errorf("ref: %+v", ref)
+	}
+}
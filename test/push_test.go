@@ -0,0 +1,270 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	gitobj "github.com/daze-doragon/go-gituse/pkg/gitobj"
+	gitpush "github.com/daze-doragon/go-gituse/pkg/gitpush"
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+// git http-backendでrootのリポジトリを公開するサーバー。パスワードがtokenのBasic認証を要求する。
+// beforePushはgit-receive-packの処理前に呼ばれる
+type gitHttpServer struct {
+	*httptest.Server
+	pushes     atomic.Int32
+	beforePush func()
+}
+
+func newGitHttpServer(t *testing.T, root string, token string) *gitHttpServer {
+	t.Helper()
+	gitCommand(t, root, "--version")
+	execPath := strings.TrimSpace(gitCommand(t, root, "--exec-path"))
+	backend := &cgi.Handler{
+		Path: filepath.Join(execPath, "git-http-backend"),
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1", "GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1"},
+	}
+	server := &gitHttpServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, password, ok := r.BasicAuth(); !ok || password != token {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/git-receive-pack") {
+			server.pushes.Add(1)
+			//net/http/cgiはchunkedのリクエストに対応していないため、読み込んでから渡す
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			r.TransferEncoding = nil
+			if server.beforePush != nil {
+				server.beforePush()
+			}
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// pushを受け付けるbareリポジトリを作成する
+func initPushRepository(t *testing.T) (string, *gitobj.Repository) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed.")
+	}
+	root := t.TempDir()
+	repoPath := filepath.Join(root, "repo.git")
+	repo, err := gitobj.InitBare(repoPath, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitCommand(t, repoPath, "config", "http.receivepack", "true")
+	return root, repo
+}
+
+func TestPushProvider(t *testing.T) {
+	root, repo := initPushRepository(t)
+	server := newGitHttpServer(t, root, "secret")
+	remote := &gitpush.Remote{Url: server.URL + "/repo.git", Token: "secret"}
+	gitInfo, err := service.GetGitInfoByProvider(service.NewPushProvider(service.NewLocalProvider(repo, "main"), remote), "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//空のリポジトリに5,000ファイルのコミットを1回のpushで作成する
+	files := map[string]string{"README.md": "hello\n"}
+	for i := 0; i < 5000; i++ {
+		files["data/"+strconv.Itoa(i%50)+"/"+strconv.Itoa(i)+".txt"] = strconv.Itoa(i) + "\n"
+	}
+	resp, err := gitInfo.CreateCommitByLocalDir("initial commit", writeLocalFiles(t, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.pushes.Load() != 1 {
+		t.Errorf("expected 1 push, got %d", server.pushes.Load())
+	}
+	repoPath := filepath.Join(root, "repo.git")
+	if head := strings.TrimSpace(gitCommand(t, repoPath, "rev-parse", "main")); head != resp.Sha {
+		t.Errorf("branch is at %s, expected %s", head, resp.Sha)
+	}
+	if out := gitCommand(t, repoPath, "ls-tree", "-r", "--name-only", "main"); strings.Count(out, "\n") != 5001 {
+		t.Errorf("unexpected file count %d", strings.Count(out, "\n"))
+	}
+
+	//既存のブランチへのコミット。変更のないディレクトリはそのまま使う
+	dataTree := strings.TrimSpace(gitCommand(t, repoPath, "rev-parse", "main:data/1"))
+	modify, _ := service.MakeCommitElementByFileData("data/0/0.txt", "changed\n", service.Utf8)
+	remove, _ := service.MakeCommitElementForDelete("README.md")
+	second, err := gitInfo.CreateCommitByElement("second", []*service.CommitElement{modify, remove})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Parents) != 1 || second.Parents[0].Sha != resp.Sha {
+		t.Errorf("unexpected parents %+v", second.Parents)
+	}
+	if server.pushes.Load() != 2 {
+		t.Errorf("expected 2 pushes, got %d", server.pushes.Load())
+	}
+	if out := gitCommand(t, repoPath, "show", "main:data/0/0.txt"); out != "changed\n" {
+		t.Errorf("unexpected content %q", out)
+	}
+	if out := strings.TrimSpace(gitCommand(t, repoPath, "rev-parse", "main:data/1")); out != dataTree {
+		t.Errorf("unchanged directory was rewritten. %s", out)
+	}
+	if out := gitCommand(t, repoPath, "ls-tree", "--name-only", "main"); out != "data\n" {
+		t.Errorf("unexpected root %q", out)
+	}
+	gitCommand(t, repoPath, "fsck", "--strict", "--no-dangling")
+
+	//ジャーナルのblobやtreeはリモートにないため再開できない
+	if _, err := gitInfo.ResumeCommit(); err == nil {
+		t.Error("ResumeCommit should fail.")
+	}
+}
+
+func TestPushCommitChain(t *testing.T) {
+	root, repo := initPushRepository(t)
+	server := newGitHttpServer(t, root, "secret")
+	remote := &gitpush.Remote{Url: server.URL + "/repo.git", Token: "secret"}
+	gitInfo, err := service.GetGitInfoByProvider(service.NewPushProvider(service.NewLocalProvider(repo, "main"), remote), "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//2つ目のコミットはpush前の1つ目のtreeとblobを元にする
+	add, _ := service.MakeCommitElementByFileData("dir/a.txt", "a\n", service.Utf8)
+	move, _ := service.MakeCommitElementForMove("dir/a.txt", "b.txt")
+	respList, err := gitInfo.CreateCommitChain([]*service.CommitGroup{
+		{Message: "add", Elements: []*service.CommitElement{add}},
+		{Message: "move", Elements: []*service.CommitElement{move}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(respList) != 2 || server.pushes.Load() != 1 {
+		t.Fatalf("expected 2 commits in 1 push, got %d commits %d pushes", len(respList), server.pushes.Load())
+	}
+	repoPath := filepath.Join(root, "repo.git")
+	if out := gitCommand(t, repoPath, "ls-tree", "-r", "--name-only", "main"); out != "b.txt\n" {
+		t.Errorf("unexpected files %q", out)
+	}
+	if out := gitCommand(t, repoPath, "ls-tree", "-r", "--name-only", "main~1"); out != "dir/a.txt\n" {
+		t.Errorf("unexpected files of the first commit %q", out)
+	}
+	gitCommand(t, repoPath, "fsck", "--strict", "--no-dangling")
+}
+
+func TestPushBranchMoved(t *testing.T) {
+	root, repo := initPushRepository(t)
+	server := newGitHttpServer(t, root, "secret")
+	local, err := service.GetGitInfoByLocalRepository(filepath.Join(root, "repo.git"), "main", "other", "other@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	add, _ := service.MakeCommitElementByFileData("a.txt", "a\n", service.Utf8)
+	if _, err := local.CreateCommitByElement("first", []*service.CommitElement{add}); err != nil {
+		t.Fatal(err)
+	}
+
+	//最初のpushの直前に他のコミットでブランチを進める
+	var moved *githubapi.CreateCommitResponse
+	server.beforePush = func() {
+		if moved != nil {
+			return
+		}
+		other, _ := service.MakeCommitElementByFileData("other.txt", "other\n", service.Utf8)
+		moved, err = local.CreateCommitByElement("other", []*service.CommitElement{other})
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	remote := &gitpush.Remote{Url: server.URL + "/repo.git", Token: "secret"}
+	gitInfo, err := service.GetGitInfoByProvider(service.NewPushProvider(service.NewLocalProvider(repo, "main"), remote), "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mine, _ := service.MakeCommitElementByFileData("b.txt", "b\n", service.Utf8)
+	resp, err := gitInfo.CreateCommitByElement("mine", []*service.CommitElement{mine})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.pushes.Load() != 2 {
+		t.Errorf("expected 2 pushes, got %d", server.pushes.Load())
+	}
+	if moved == nil || len(resp.Parents) != 1 || resp.Parents[0].Sha != moved.Sha {
+		t.Errorf("commit should be rebuilt on the moved branch. %+v", resp.Parents)
+	}
+	repoPath := filepath.Join(root, "repo.git")
+	if out := gitCommand(t, repoPath, "ls-tree", "--name-only", "main"); out != "a.txt\nb.txt\nother.txt\n" {
+		t.Errorf("unexpected files %q", out)
+	}
+	gitCommand(t, repoPath, "fsck", "--strict", "--no-dangling")
+
+	//ブランチの作成時に既に存在する場合もErrBranchMovedにする
+	provider := service.NewPushProvider(service.NewLocalProvider(repo, "main"), remote)
+	blobSha, _ := provider.PutBlob([]byte("c\n"))
+	treeSha, _ := provider.PutTree("", []*githubapi.TreeDataElement{{Path: "c.txt", Mode: "100644", Type: "blob", Sha: blobSha}})
+	commit, err := provider.PutCommit(&githubapi.CommitData{Message: "orphan", Tree: treeSha})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.UpdateBranch(commit.Sha, ""); !errors.Is(err, service.ErrBranchMoved) {
+		t.Errorf("expected ErrBranchMoved, got %v", err)
+	}
+}
+
+func TestPushAuthentication(t *testing.T) {
+	root, repo := initPushRepository(t)
+	server := newGitHttpServer(t, root, "secret")
+	remote := &gitpush.Remote{Url: server.URL + "/repo.git", TokenSource: githubapi.StaticTokenSource("wrong")}
+	gitInfo, err := service.GetGitInfoByProvider(service.NewPushProvider(service.NewLocalProvider(repo, "main"), remote), "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	add, _ := service.MakeCommitElementByFileData("a.txt", "a\n", service.Utf8)
+	_, err = gitInfo.CreateCommitByElement("first", []*service.CommitElement{add})
+	var httpErr *gitpush.HttpError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "repo.git", "refs", "heads", "main")); err == nil {
+		t.Error("branch should not be created.")
+	}
+}
+
+func TestGithubRemoteUrl(t *testing.T) {
+	cases := map[string]string{
+		"":                                "https://github.com/owner/repo.git",
+		"https://ghe.example.com/api/v3":  "https://ghe.example.com/owner/repo.git",
+		"https://ghe.example.com/api/v3/": "https://ghe.example.com/owner/repo.git",
+		"http://127.0.0.1:8080":           "http://127.0.0.1:8080/owner/repo.git",
+	}
+	for baseUrl, want := range cases {
+		client := &githubapi.GitClient{Owner: "owner", Repository: "repo", BaseUrl: baseUrl}
+		if got := client.RemoteUrl(); got != want {
+			t.Errorf("%q: got %s, want %s", baseUrl, got, want)
+		}
+	}
+	client := &githubapi.GitClient{Owner: "owner", Repository: "repo", GitUrl: "https://git.example.com/r.git"}
+	if got := service.GithubRemote(client).Url; got != "https://git.example.com/r.git" {
+		t.Errorf("GitUrl should be used. %s", got)
+	}
+}
@@ -0,0 +1,134 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestCreateRepo(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.exists = false
+	gitInfo := fake.gitInfo(t, "main")
+
+	//オプションを省略した場合は認証ユーザの非公開リポジトリを作成する
+	repoResp, err := gitInfo.CreateRepo(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.countCalls("POST", "/user/repos") != 1 || fake.settings["private"] != true || len(fake.refs) != 0 {
+		t.Errorf("unexpected repository %+v %v", fake.settings, fake.refs)
+	}
+	if repoResp.Full_name != "owner/repo" {
+		t.Errorf("unexpected response %+v", repoResp)
+	}
+	if _, err := gitInfo.CreateRepo(nil); err == nil {
+		t.Error("existing repository should be rejected.")
+	}
+
+	//organizationのinternalリポジトリを作成し、初期ブランチからデフォルトブランチを作成する
+	fake = newFakeGitHub(t, "owner", "repo")
+	fake.exists = false
+	gitInfo = fake.gitInfo(t, "main")
+	repoResp, err = gitInfo.CreateRepo(&service.CreateRepoOption{
+		Organization:  true,
+		Visibility:    "internal",
+		Description:   "tools",
+		AutoInit:      true,
+		DefaultBranch: "trunk",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.countCalls("POST", "/orgs/owner/repos") != 1 || fake.settings["visibility"] != "internal" || fake.settings["description"] != "tools" {
+		t.Errorf("unexpected repository %+v", fake.settings)
+	}
+	if repoResp.Default_branch != "trunk" || fake.refs["refs/heads/trunk"] != fake.refs["refs/heads/main"] {
+		t.Errorf("default branch should be trunk. %+v %v", repoResp, fake.refs)
+	}
+
+	//作成前に確認できる誤り
+	for name, option := range map[string]*service.CreateRepoOption{
+		"internal for user":   {Visibility: "internal"},
+		"unknown visibility":  {Visibility: "secret"},
+		"template repository": {TemplateOwner: "acme"},
+		"internal template":   {Organization: true, Visibility: "internal", TemplateOwner: "acme", TemplateRepository: "template"},
+	} {
+		if _, err := gitInfo.CreateRepo(option); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCreateRepoFromTemplate(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.exists = false
+	fake.templateFiles = map[string]string{"README.md": "template\n", "main.go": "package main\n"}
+	//生成は非同期で、3回目の確認でブランチが作成される
+	fake.templatePending = 3
+	gitInfo := fake.gitInfo(t, "main")
+	repoResp, err := gitInfo.CreateRepo(&service.CreateRepoOption{
+		Visibility:         "public",
+		TemplateOwner:      "acme",
+		TemplateRepository: "template",
+		DefaultBranch:      "trunk",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.countCalls("POST", "/repos/acme/template/generate") != 1 || fake.settings["private"] != false || fake.settings["owner"] != "owner" {
+		t.Errorf("unexpected repository %+v", fake.settings)
+	}
+	if repoResp.Default_branch != "trunk" {
+		t.Errorf("default branch should be trunk. %+v", repoResp)
+	}
+	if got, _ := fake.fileContent("trunk", "main.go"); got != "package main\n" {
+		t.Errorf("template content should be on trunk. %q", got)
+	}
+
+	//生成が終わらない場合はリポジトリとエラーを返す
+	fake = newFakeGitHub(t, "owner", "repo")
+	fake.exists = false
+	fake.templateFiles = map[string]string{"README.md": "template\n"}
+	fake.templatePending = 1000
+	gitInfo = fake.gitInfo(t, "main")
+	repoResp, err = gitInfo.CreateRepo(&service.CreateRepoOption{
+		TemplateOwner:      "acme",
+		TemplateRepository: "template",
+		TemplateTimeout:    300 * time.Millisecond,
+	})
+	if err == nil || !strings.Contains(err.Error(), "was not generated") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	if repoResp == nil || repoResp.Full_name != "owner/repo" {
+		t.Errorf("created repository should be returned. %+v", repoResp)
+	}
+}
+
+func TestUpdateRepoSettings(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"README.md": "readme\n"})
+	fake.seed("develop", map[string]string{"README.md": "readme\n"})
+	gitInfo := fake.gitInfo(t, "main")
+
+	//nilの項目は送らない
+	description, wiki, branch := "new description", false, "develop"
+	repoResp, err := gitInfo.UpdateRepoSettings(&githubapi.UpdateRepoData{Description: &description, Has_wiki: &wiki, Default_branch: &branch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.settings) != 3 || fake.settings["has_wiki"] != false || fake.settings["description"] != description {
+		t.Errorf("unexpected settings %+v", fake.settings)
+	}
+	if repoResp.Default_branch != "develop" {
+		t.Errorf("unexpected response %+v", repoResp)
+	}
+
+	missing := "missing"
+	if _, err := gitInfo.UpdateRepoSettings(&githubapi.UpdateRepoData{Default_branch: &missing}); err == nil {
+		t.Error("missing default branch should be rejected.")
+	}
+}
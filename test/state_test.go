@@ -0,0 +1,111 @@
+package test
+
+import (
+	"testing"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestGetRepoState(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+
+	//コミットがない
+	state, err := fake.gitInfo(t, "main").GetRepoState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.State != service.RepoEmpty || state.DefaultBranch != "main" {
+		t.Errorf("empty repository: got %+v", state)
+	}
+	empty, err := fake.gitInfo(t, "main").IsEmptyRepository()
+	if err != nil || !empty {
+		t.Errorf("IsEmptyRepository should be true. %v %v", empty, err)
+	}
+
+	//ブランチが存在する
+	head := fake.seed("main", map[string]string{"README.md": "readme\n"})
+	state, err = fake.gitInfo(t, "main").GetRepoState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.State != service.RepoReady || state.HeadSha != head {
+		t.Errorf("ready repository: got %+v, head %s", state, head)
+	}
+
+	//別のブランチが存在しない。前方一致するブランチがあっても存在しない扱いにする
+	fake.seed("feature-x", map[string]string{"README.md": "x\n"})
+	state, err = fake.gitInfo(t, "feature").GetRepoState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.State != service.RepoBranchMissing {
+		t.Errorf("missing branch: got %+v", state)
+	}
+
+	//トークンが無効
+	gitInfo := fake.gitInfo(t, "main")
+	fake.token = "rotated-token"
+	state, err = gitInfo.GetRepoState()
+	fake.token = "test-token"
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.State != service.RepoInaccessible {
+		t.Errorf("invalid token: got %+v", state)
+	}
+
+	//アクセスが拒否された
+	fake.forbidden = true
+	state, err = fake.gitInfo(t, "main").GetRepoState()
+	fake.forbidden = false
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.State != service.RepoInaccessible || state.Detail == "" {
+		t.Errorf("forbidden: got %+v", state)
+	}
+
+	//リポジトリが存在しない
+	exists, err := fake.gitInfo(t, "main").IsExistRepo()
+	if err != nil || !exists {
+		t.Errorf("IsExistRepo should be true. %v %v", exists, err)
+	}
+	fake.exists = false
+	state, err = fake.gitInfo(t, "main").GetRepoState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.State != service.RepoNotFound {
+		t.Errorf("nonexistent repository: got %+v", state)
+	}
+	exists, err = fake.gitInfo(t, "main").IsExistRepo()
+	if err != nil || exists {
+		t.Errorf("IsExistRepo should be false. %v %v", exists, err)
+	}
+}
+
+func TestCommitToEmptyRepository(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	gitInfo := fake.gitInfo(t, "main")
+	element, err := service.MakeCommitElementByFileData("README.md", "hello\n", service.Utf8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := gitInfo.CreateCommitByElement("first commit", []*service.CommitElement{element})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.refs["refs/heads/main"] != resp.Sha {
+		t.Errorf("branch should be created at the first commit. refs: %v", fake.refs)
+	}
+	if content, _ := fake.fileContent("main", "README.md"); content != "hello\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+	state, err := gitInfo.GetRepoState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.State != service.RepoReady {
+		t.Errorf("got %+v", state)
+	}
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gitobj "github.com/daze-doragon/go-gituse/pkg/gitobj"
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestSubmoduleElement(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	gitmodules := "# pinned libraries\n[submodule \"core\"]\n\tpath = libs/core\n\turl = https://example.com/core.git\n"
+	fake.seed("main", map[string]string{"README.md": "readme\n", ".gitmodules": gitmodules})
+	oldPin := strings.Repeat("1", 40)
+	newPin := strings.Repeat("2", 40)
+	//seedはblobのみのため、gitlinkは最初のコミットで追加する
+	fake.mu.Lock()
+	files := make(map[string]fakeTreeEntry)
+	fake.flatten(fake.commitTree(fake.refs["refs/heads/main"]), "", files)
+	files["libs/core"] = fakeTreeEntry{name: "libs/core", mode: "160000", typ: "commit", sha: oldPin}
+	tree := fake.buildTree(files)
+	fake.refs["refs/heads/main"] = fake.put("commit", []byte("tree "+tree+"\nparent "+fake.refs["refs/heads/main"]+"\nauthor seed <seed@example.com> 0 +0000\ncommitter seed <seed@example.com> 0 +0000\n\nadd submodule\n"))
+	fake.mu.Unlock()
+	gitInfo := fake.gitInfo(t, "main")
+
+	//既存のサブモジュールの参照先だけを更新する。.gitmodulesは変更しない
+	bump, err := service.MakeCommitElementForSubmodule("libs/core", newPin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := gitInfo.PlanCommitByElement("bump core", []*service.CommitElement{bump})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Entries) != 1 || plan.Entries[0].Action != service.ActionModify || plan.Entries[0].OldSha != oldPin || plan.Entries[0].NewMode != "160000" {
+		t.Errorf("unexpected plan %+v", plan.Entries[0])
+	}
+	if _, err := gitInfo.CreateCommitByElement("bump core", []*service.CommitElement{bump}); err != nil {
+		t.Fatal(err)
+	}
+	entry := fake.files("main")["libs/core"]
+	if entry.mode != "160000" || entry.typ != "commit" || entry.sha != newPin {
+		t.Errorf("unexpected gitlink %+v", entry)
+	}
+	if content, _ := fake.fileContent("main", ".gitmodules"); content != gitmodules {
+		t.Errorf(".gitmodules should not be changed. %q", content)
+	}
+	if count := fake.countCalls("POST", "/repos/owner/repo/git/blobs"); count != 0 {
+		t.Errorf("gitlink should not upload blobs. %d", count)
+	}
+
+	//登録されていないパスはurlがなければエラーにする
+	unknown, _ := service.MakeCommitElementForSubmodule("libs/other", newPin, nil)
+	if _, err := gitInfo.CreateCommitByElement("add other", []*service.CommitElement{unknown}); err == nil || !strings.Contains(err.Error(), "is not a submodule") {
+		t.Errorf("expected not a submodule error, got %v", err)
+	}
+	//ファイルのパスはサブモジュールにできない
+	onFile, _ := service.MakeCommitElementForSubmodule("README.md", newPin, &service.SubmoduleOption{Url: "https://example.com/readme.git"})
+	if _, err := gitInfo.CreateCommitByElement("replace readme", []*service.CommitElement{onFile}); err == nil {
+		t.Error("a file should not be replaced by a submodule.")
+	}
+	if _, err := service.MakeCommitElementForSubmodule("libs/core", "not-a-sha", nil); err == nil {
+		t.Error("invalid sha should be rejected.")
+	}
+
+	//新しいサブモジュールの追加と既存のurlの変更を1コミットで行い、.gitmodulesにまとめる
+	add, _ := service.MakeCommitElementForSubmodule("libs/ui", oldPin, &service.SubmoduleOption{Url: "https://example.com/ui.git", Name: "ui", Branch: "stable"})
+	move, _ := service.MakeCommitElementForSubmodule("libs/core", newPin, &service.SubmoduleOption{Url: "https://example.com/new-core.git"})
+	if _, err := gitInfo.CreateCommitByElement("add ui", []*service.CommitElement{add, move}); err != nil {
+		t.Fatal(err)
+	}
+	want := "# pinned libraries\n[submodule \"core\"]\n\tpath = libs/core\n\turl = https://example.com/new-core.git\n" +
+		"[submodule \"ui\"]\n\tpath = libs/ui\n\turl = https://example.com/ui.git\n\tbranch = stable\n"
+	if content, _ := fake.fileContent("main", ".gitmodules"); content != want {
+		t.Errorf("unexpected .gitmodules %q", content)
+	}
+	if entry := fake.files("main")["libs/ui"]; entry.mode != "160000" || entry.sha != oldPin {
+		t.Errorf("unexpected gitlink %+v", entry)
+	}
+
+	//.gitmodulesを別の要素でも変更する場合はエラーにする
+	other, _ := service.MakeCommitElementForSubmodule("libs/api", oldPin, &service.SubmoduleOption{Url: "https://example.com/api.git"})
+	edit, _ := service.MakeCommitElementByFileData(".gitmodules", "", service.Utf8)
+	if _, err := gitInfo.CreateCommitByElement("conflict", []*service.CommitElement{other, edit}); err == nil {
+		t.Error("conflicting .gitmodules changes should be rejected.")
+	}
+}
+
+func TestSubmoduleLocalRepository(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	if _, err := gitobj.InitBare(repoPath, "main"); err != nil {
+		t.Fatal(err)
+	}
+	gitInfo, err := service.GetGitInfoByLocalRepository(repoPath, "main", "tester", "tester@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin := strings.Repeat("a", 40)
+	readme, _ := service.MakeCommitElementByFileData("README.md", "readme\n", service.Utf8)
+	sub, _ := service.MakeCommitElementForSubmodule("vendor/lib", pin, &service.SubmoduleOption{Url: "https://example.com/lib.git"})
+	if _, err := gitInfo.CreateCommitByElement("add lib", []*service.CommitElement{readme, sub}); err != nil {
+		t.Fatal(err)
+	}
+	//gitで読める形式になっていることを確認する
+	if out := gitCommand(t, repoPath, "ls-tree", "main", "vendor/lib"); out != "160000 commit "+pin+"\tvendor/lib\n" {
+		t.Errorf("unexpected tree %q", out)
+	}
+	gitCommand(t, repoPath, "show", "main:.gitmodules")
+	if out := gitCommand(t, repoPath, "config", "--blob", "main:.gitmodules", "submodule.vendor/lib.url"); out != "https://example.com/lib.git\n" {
+		t.Errorf("unexpected url %q", out)
+	}
+	gitCommand(t, repoPath, "fsck", "--strict", "--no-dangling")
+}
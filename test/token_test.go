@@ -0,0 +1,228 @@
+package test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	githubapi "github.com/daze-doragon/go-gituse/pkg/githubapi"
+)
+
+// テスト用の固定のGitHub Appの秘密鍵(PKCS#1)
+func readAppPrivateKey(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("./test_data/app_private_key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// installation access token APIのfake。JWTを検証し、lifetimeの有効期限でトークンを発行する。
+type fakeTokenEndpoint struct {
+	mu        sync.Mutex
+	server    *httptest.Server
+	publicKey *rsa.PublicKey
+	appId     string
+	lifetime  time.Duration
+	issued    int
+	status    int //0以外の場合はそのステータスコードでエラーを返す
+}
+
+func newFakeTokenEndpoint(t *testing.T, publicKey *rsa.PublicKey, appId string) *fakeTokenEndpoint {
+	endpoint := &fakeTokenEndpoint{publicKey: publicKey, appId: appId, lifetime: time.Hour}
+	endpoint.server = httptest.NewServer(endpoint)
+	t.Cleanup(endpoint.server.Close)
+	return endpoint
+}
+
+func (endpoint *fakeTokenEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+	if r.Method != "POST" || r.URL.Path != "/app/installations/42/access_tokens" {
+		writeFakeMessage(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	if endpoint.status != 0 {
+		writeFakeMessage(w, endpoint.status, http.StatusText(endpoint.status))
+		return
+	}
+	if err := endpoint.verifyJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); err != nil {
+		writeFakeMessage(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	endpoint.issued++
+	writeFakeJSON(w, http.StatusCreated, map[string]any{
+		"token":       fmt.Sprintf("ghs_%d", endpoint.issued),
+		"expires_at":  time.Now().Add(endpoint.lifetime).UTC().Format(time.RFC3339),
+		"permissions": map[string]string{"contents": "write", "metadata": "read"},
+	})
+}
+
+// RS256の署名、発行者、有効期間を確認する
+func (endpoint *fakeTokenEndpoint) verifyJWT(jwt string) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return errors.New("jwt should have 3 parts.")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	headerData, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	if err := json.Unmarshal(headerData, &header); err != nil || header.Alg != "RS256" {
+		return fmt.Errorf("unexpected header %s", headerData)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(endpoint.publicKey, crypto.SHA256, hashed[:], signature); err != nil {
+		return fmt.Errorf("invalid signature. %w", err)
+	}
+	var claims struct {
+		Iat int64  `json:"iat"`
+		Exp int64  `json:"exp"`
+		Iss string `json:"iss"`
+	}
+	claimsData, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(claimsData, &claims); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	//GitHubはiatが現在より後、expが10分より先のJWTを受け付けない
+	if claims.Iss != endpoint.appId || claims.Iat > now || claims.Exp <= now || claims.Exp > now+600 {
+		return fmt.Errorf("unexpected claims %s", claimsData)
+	}
+	return nil
+}
+
+func TestAppTokenSource(t *testing.T) {
+	keyPEM := readAppPrivateKey(t)
+	source, err := githubapi.NewAppTokenSource("12345", 42, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := newFakeTokenEndpoint(t, &source.PrivateKey.PublicKey, "12345")
+	source.BaseUrl = endpoint.server.URL
+
+	if source.Permissions() != nil {
+		t.Error("permissions should be nil before the first token.")
+	}
+	//有効期限まで十分ある場合は発行済みのトークンを使う
+	for i := 0; i < 3; i++ {
+		token, err := source.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "ghs_1" {
+			t.Errorf("unexpected token %s", token)
+		}
+	}
+	if endpoint.issued != 1 || source.Permissions()["contents"] != "write" {
+		t.Errorf("token should be issued once. issued %d, permissions %v", endpoint.issued, source.Permissions())
+	}
+
+	//有効期限がRefreshBefore(デフォルト5分)より近い場合は再発行する
+	endpoint.lifetime = 4 * time.Minute
+	refreshing, _ := githubapi.NewAppTokenSource("12345", 42, keyPEM)
+	refreshing.BaseUrl = endpoint.server.URL
+	first, _ := refreshing.Token()
+	second, _ := refreshing.Token()
+	if first == second || endpoint.issued != 3 {
+		t.Errorf("token close to expiry should be refreshed. %s %s issued %d", first, second, endpoint.issued)
+	}
+	refreshing.RefreshBefore = time.Minute
+	third, _ := refreshing.Token()
+	fourth, _ := refreshing.Token()
+	if third != second || fourth != second || endpoint.issued != 3 {
+		t.Errorf("token should be reused with a shorter RefreshBefore. %s %s issued %d", third, fourth, endpoint.issued)
+	}
+
+	//GitClientはTokenSourceのトークンで認証する
+	client := &githubapi.GitClient{Token: "ignored", TokenSource: refreshing}
+	if token, err := client.GetToken(); err != nil || token != fourth {
+		t.Errorf("unexpected token %s %v", token, err)
+	}
+
+	//PKCS#8の鍵も読み込める
+	block, _ := pem.Decode(keyPEM)
+	pkcs1, _ := x509.ParsePKCS1PrivateKey(block.Bytes)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(pkcs1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := githubapi.NewAppTokenSource("12345", 42, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})); err != nil {
+		t.Errorf("PKCS#8 key should be accepted. %v", err)
+	}
+	if _, err := githubapi.NewAppTokenSource("12345", 42, []byte("not a key")); err == nil {
+		t.Error("invalid key should be rejected.")
+	}
+
+	//受け付けられないJWTとAPIのエラーはそのまま返す
+	other, _ := githubapi.NewAppTokenSource("99999", 42, keyPEM)
+	other.BaseUrl = endpoint.server.URL
+	var apiErr *githubapi.ApiError
+	if _, err := other.Token(); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %v", err)
+	}
+	endpoint.status = http.StatusNotFound
+	refreshing.RefreshBefore = time.Hour
+	if _, err := refreshing.Token(); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %v", err)
+	}
+}
+
+func TestEnvTokenSource(t *testing.T) {
+	t.Setenv("GITUSE_TEST_TOKEN", "env-token")
+	source := githubapi.EnvTokenSource("GITUSE_TEST_TOKEN")
+	if token, err := source.Token(); err != nil || token != "env-token" {
+		t.Errorf("unexpected token %s %v", token, err)
+	}
+	//呼び出しのたびに読み込む
+	t.Setenv("GITUSE_TEST_TOKEN", "rotated")
+	if token, _ := source.Token(); token != "rotated" {
+		t.Errorf("token should be read on every call. %s", token)
+	}
+	t.Setenv("GITUSE_TEST_TOKEN", "")
+	if _, err := source.Token(); err == nil {
+		t.Error("empty variable should be rejected.")
+	}
+}
+
+func TestFileTokenSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("  file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	source := githubapi.FileTokenSource(path)
+	if token, err := source.Token(); err != nil || token != "file-token" {
+		t.Errorf("unexpected token %q %v", token, err)
+	}
+	//ファイルの更新に追従する
+	os.WriteFile(path, []byte("rotated\n"), 0o600)
+	if token, _ := source.Token(); token != "rotated" {
+		t.Errorf("token should be read on every call. %q", token)
+	}
+	os.WriteFile(path, []byte("\n"), 0o600)
+	if _, err := source.Token(); err == nil {
+		t.Error("empty file should be rejected.")
+	}
+	if _, err := githubapi.FileTokenSource(filepath.Join(t.TempDir(), "missing")).Token(); err == nil {
+		t.Error("missing file should be rejected.")
+	}
+}
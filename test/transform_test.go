@@ -0,0 +1,95 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestUpdateJSONValue(t *testing.T) {
+	content := "{\n    \"name\": \"app\",\n    \"version\": \"1.0.0\",\n    \"deps\": {\n        \"lib\": 1.5\n    },\n    \"list\": [1, 2]\n}\n"
+	updated, err := service.UpdateJSONValue("deps.lib", 2)([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\n    \"name\": \"app\",\n    \"version\": \"1.0.0\",\n    \"deps\": {\n        \"lib\": 2\n    },\n    \"list\": [\n        1,\n        2\n    ]\n}\n"
+	if string(updated) != expected {
+		t.Errorf("unexpected json.\n%s", updated)
+	}
+
+	updated, err = service.UpdateJSONValue("new.key", "value")(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(updated) != "{\n  \"new\": {\n    \"key\": \"value\"\n  }\n}\n" {
+		t.Errorf("unexpected json.\n%s", updated)
+	}
+
+	_, err = service.UpdateJSONValue("name.sub", 1)([]byte(content))
+	if err == nil {
+		t.Error("setting a key under a string should fail.")
+	}
+}
+
+func TestUpdateYAMLValue(t *testing.T) {
+	content := "# config\nimage:\n  name: app\n  tag: v1 # pinned\nreplicas: 2\nlist:\n  - name: x\n"
+	updated, err := service.UpdateYAMLValue("image.tag", "v2")([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# config\nimage:\n  name: app\n  tag: v2 # pinned\nreplicas: 2\nlist:\n  - name: x\n"
+	if string(updated) != expected {
+		t.Errorf("unexpected yaml.\n%s", updated)
+	}
+
+	updated, err = service.UpdateYAMLValue("replicas", "3")([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(updated) != "# config\nimage:\n  name: app\n  tag: v1 # pinned\nreplicas: \"3\"\nlist:\n  - name: x\n" {
+		t.Errorf("unexpected yaml.\n%s", updated)
+	}
+
+	_, err = service.UpdateYAMLValue("image", "x")([]byte(content))
+	if err == nil {
+		t.Error("updating a mapping should fail.")
+	}
+	_, err = service.UpdateYAMLValue("image.missing", "x")([]byte(content))
+	if err == nil {
+		t.Error("updating a missing key should fail.")
+	}
+}
+
+func TestTransformBranchMoved(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"package.json": "{\"name\": \"app\", \"version\": \"1.0.0\"}\n", "b.txt": "b\n"})
+	gitInfo := fake.gitInfo(t, "main")
+
+	//変換関数に渡された内容を記録する
+	var inputs []string
+	bump := service.UpdateJSONValue("version", "2.0.0")
+	element, err := service.MakeCommitElementByTransform("package.json", func(content []byte) ([]byte, error) {
+		inputs = append(inputs, string(content))
+		return bump(content)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//2ファイルの変更にしてgit data APIでコミットする
+	other, _ := service.MakeCommitElementByFileData("b.txt", "B\n", service.Utf8)
+
+	//他のコミットが同じファイルを変更した場合は、新しい内容で変換し直して両方の変更を残す
+	moved := "{\"name\": \"renamed\", \"version\": \"1.0.0\"}\n"
+	fake.beforeUpdateRef = func() { fake.seed("main", map[string]string{"package.json": moved, "b.txt": "b\n"}) }
+	if _, err := gitInfo.CreateCommitByElement("bump version", []*service.CommitElement{element, other}); err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != 2 || inputs[1] != moved {
+		t.Errorf("transform should be re-evaluated on the moved branch. %q", inputs)
+	}
+	got, _ := fake.fileContent("main", "package.json")
+	if !strings.Contains(got, "\"renamed\"") || !strings.Contains(got, "\"2.0.0\"") {
+		t.Errorf("both changes should be kept. %q", got)
+	}
+}
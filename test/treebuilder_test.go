@@ -0,0 +1,64 @@
+package test
+
+import (
+	"testing"
+
+	service "github.com/daze-doragon/go-gituse/pkg/service"
+)
+
+func TestTreeBuilderReusesSubtrees(t *testing.T) {
+	fake := newFakeGitHub(t, "owner", "repo")
+	fake.seed("main", map[string]string{"a/b/c.txt": "c\n", "a/b/d.txt": "d\n", "a/x/y.txt": "y\n", "z.txt": "z\n"})
+	gitInfo := fake.gitInfo(t, "main")
+	subtree := func(path string) string {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		sha := fake.commitTree(fake.refs["refs/heads/main"])
+		for _, name := range []string{"a", path} {
+			found := ""
+			for _, entry := range fake.readTree(sha) {
+				if entry.name == name {
+					found = entry.sha
+				}
+			}
+			sha = found
+		}
+		return sha
+	}
+	unchanged := subtree("x")
+
+	//変更のあるa/b、a、new、ルートの4つだけを作成し、a/xは元のtreeを参照する
+	modify, _ := service.MakeCommitElementByFileData("a/b/c.txt", "changed\n", service.Utf8)
+	remove, _ := service.MakeCommitElementForDelete("a/b/d.txt")
+	add, _ := service.MakeCommitElementByFileData("new/n.txt", "n\n", service.Utf8)
+	if _, err := gitInfo.CreateCommitByElement("change", []*service.CommitElement{modify, remove, add}); err != nil {
+		t.Fatal(err)
+	}
+	if count := fake.countCalls("POST", "/repos/owner/repo/git/trees"); count != 4 {
+		t.Errorf("expected 4 trees, got %d. %v", count, fake.calls)
+	}
+	if sha := subtree("x"); sha != unchanged {
+		t.Errorf("unchanged subtree was rebuilt. %s", sha)
+	}
+	files := fake.files("main")
+	if len(files) != 4 || files["a/b/c.txt"].sha == "" || files["new/n.txt"].sha == "" {
+		t.Errorf("unexpected files %v", files)
+	}
+	if content, _ := fake.fileContent("main", "a/b/c.txt"); content != "changed\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	//空になったディレクトリはtreeを作らずに親から取り除く
+	removeY, _ := service.MakeCommitElementForDelete("a/x/y.txt")
+	removeC, _ := service.MakeCommitElementForDelete("a/b/c.txt")
+	if _, err := gitInfo.CreateCommitByElement("remove a", []*service.CommitElement{removeY, removeC}); err != nil {
+		t.Fatal(err)
+	}
+	if count := fake.countCalls("POST", "/repos/owner/repo/git/trees"); count != 5 {
+		t.Errorf("expected only the root tree, got %d trees. %v", count, fake.calls)
+	}
+	files = fake.files("main")
+	if _, ok := files["z.txt"]; len(files) != 2 || !ok || files["new/n.txt"].sha == "" {
+		t.Errorf("unexpected files %v", files)
+	}
+}